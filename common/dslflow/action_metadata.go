@@ -40,14 +40,20 @@ type (
 		Description          string         `yaml:"description" json:"description"`                       // 动作描述
 		RequiredArgumentKeys []string       `yaml:"required_argument_keys" json:"required_argument_keys"` // 必传参数键
 		ArgumentType         reflect.Type   `yaml:"-" json:"-"`                                           // 输入参数类型
+		ResponseType         reflect.Type   `yaml:"-" json:"-"`                                           // 返回数据类型
+		ArgumentSchema       JSONSchema     `yaml:"argument_schema" json:"argument_schema,omitempty"`     // 输入参数的 JSON Schema，为空时根据 ArgumentType 生成
+		ResponseSchema       JSONSchema     `yaml:"response_schema" json:"response_schema,omitempty"`     // 返回数据的 JSON Schema，为空时根据 ResponseType 生成
 		Responses            []ReturnConfig `yaml:"responses" json:"responses"`                           // 返回参数元数据
+		CacheTags            []string       `yaml:"cache_tags" json:"cache_tags"`                         // query 类型的结果缓存时附带的标签，namespace 默认也是标签
+		Invalidates          []string       `yaml:"invalidates" json:"invalidates"`                       // update 类型执行成功后失效的缓存 namespace 或标签，默认为自己的 namespace
 	}
 
 	// ReturnConfig 返回参数元数据（描述返回字段的结构）
 	ReturnConfig struct {
 		Name        string `yaml:"name" json:"name"`               // 返回字段名称
-		Type        string `yaml:"type" json:"type"`               // 字段类型（如 string、int、[]string）
+		Type        string `yaml:"type" json:"type"`               // 字段类型（如 string、int、float64、bool、object、[]string），为空时不检查类型
 		Required    bool   `yaml:"required" json:"required"`       // 是否必须返回该字段
+		Coerce      bool   `yaml:"coerce" json:"coerce,omitempty"` // 类型不匹配时尝试转换，比如 "1" 转为 int、1 转为 string
 		Description string `yaml:"description" json:"description"` // 字段描述
 	}
 )
@@ -65,6 +71,10 @@ func (am *ActionMetadata) checkArguments(arguments any) error {
 		}
 	}
 
+	if err := am.ArgumentSchema.validate(arguments); err != nil {
+		return fmt.Errorf("arguments do not match schema: %w", err)
+	}
+
 	// 检查必填参数
 	if len(am.RequiredArgumentKeys) > 0 {
 		missingArgs := am.findMissingRequiredArgs(arguments)
@@ -76,17 +86,30 @@ func (am *ActionMetadata) checkArguments(arguments any) error {
 	return nil
 }
 
-// 检查返回数据是否符合要求
-func (am *ActionMetadata) checkResponses(retData any) error {
+// 检查返回数据是否符合要求，字段配置了 coerce 并且做了类型转换时返回转换后的数据
+func (am *ActionMetadata) checkResponses(retData any) (any, error) {
+	if err := am.ResponseSchema.validate(retData); err != nil {
+		return retData, fmt.Errorf("response does not match schema: %w", err)
+	}
 	if len(am.Responses) == 0 {
-		return nil
+		return retData, nil
 	}
 
-	missingFields := am.findMissingRequiredFields(retData)
-	if len(missingFields) > 0 {
-		return fmt.Errorf("missing required response fields: %v", missingFields)
+	retData, err := am.checkResponseFields(retData)
+	if err != nil {
+		return retData, fmt.Errorf("invalid response fields: %w", err)
+	}
+	return retData, nil
+}
+
+// resolveSchemas 没有配置 schema 时根据输入输出的类型生成
+func (am *ActionMetadata) resolveSchemas() {
+	if am.ArgumentSchema == nil {
+		am.ArgumentSchema = TypeJSONSchema(am.ArgumentType)
+	}
+	if am.ResponseSchema == nil {
+		am.ResponseSchema = TypeJSONSchema(am.ResponseType)
 	}
-	return nil
 }
 
 // Execute 执行动作并返回结果
@@ -109,7 +132,7 @@ func (am *ActionMetadata) Execute(ctx context.Context, arguments any) (any, erro
 	}
 
 	// 4. 验证返回数据
-	if err := am.checkResponses(retData); err != nil {
+	if retData, err = am.checkResponses(retData); err != nil {
 		return retData, fmt.Errorf("invalid response data: %w", err)
 	}
 
@@ -146,24 +169,3 @@ func (am *ActionMetadata) findMissingRequiredArgs(arguments any) []string {
 
 	return missing
 }
-
-// 查找缺失的必填返回字段
-func (am *ActionMetadata) findMissingRequiredFields(retData any) []string {
-	jsonStr := conv.String(retData)
-	if !cond.IsJson(jsonStr) {
-		return nil
-	}
-
-	missing := make([]string, 0)
-	lo.ForEach(am.Responses, func(config ReturnConfig, _ int) {
-		if config.Name == "" || !config.Required {
-			return
-		}
-
-		if !gjson.Get(jsonStr, config.Name).Exists() {
-			missing = append(missing, config.Name)
-		}
-	})
-
-	return missing
-}
@@ -0,0 +1,247 @@
+package dslflow
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/magic-lib/go-plat-utils/conv"
+	"github.com/samber/lo"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	responseKindAny     = "any"
+	responseKindString  = "string"
+	responseKindInteger = "integer"
+	responseKindNumber  = "number"
+	responseKindBoolean = "boolean"
+	responseKindObject  = "object"
+	responseKindArray   = "array"
+)
+
+// responseKindOf ReturnConfig.Type 支持的写法，数组写成 []T 或者 array
+func responseKindOf(name string) (string, bool) {
+	switch strings.ToLower(name) {
+	case "", "any", "interface{}":
+		return responseKindAny, true
+	case "string":
+		return responseKindString, true
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "integer":
+		return responseKindInteger, true
+	case "float", "float32", "float64", "number":
+		return responseKindNumber, true
+	case "bool", "boolean":
+		return responseKindBoolean, true
+	case "object", "map", "map[string]any", "map[string]interface{}":
+		return responseKindObject, true
+	case "array", "slice":
+		return responseKindArray, true
+	}
+	return "", false
+}
+
+// responseType 解析后的返回字段类型
+type responseType struct {
+	name string // 配置中的写法，错误信息中使用
+	kind string
+	elem *responseType // 数组元素的类型
+}
+
+func parseResponseType(s string) (*responseType, error) {
+	name := strings.TrimSpace(s)
+	if elem, ok := strings.CutPrefix(name, "[]"); ok {
+		elemType, err := parseResponseType(elem)
+		if err != nil {
+			return nil, err
+		}
+		return &responseType{name: name, kind: responseKindArray, elem: elemType}, nil
+	}
+	kind, ok := responseKindOf(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown response type %q", s)
+	}
+	rt := &responseType{name: name, kind: kind}
+	if kind == responseKindArray {
+		rt.elem = &responseType{name: responseKindAny, kind: responseKindAny}
+	}
+	return rt, nil
+}
+
+// checkResponseConfigs 注册时检查返回字段的类型是否支持
+func (am *ActionMetadata) checkResponseConfigs() error {
+	for _, rc := range am.Responses {
+		if _, err := parseResponseType(rc.Type); err != nil {
+			return fmt.Errorf("response %s of %s: %w", rc.Name, getActionKey(am.Namespace, am.Activity), err)
+		}
+	}
+	return nil
+}
+
+// checkResponseFields 按 Responses 检查返回字段，name 中的 . 表示嵌套字段，经过数组时检查每个元素，也可以写下标，比如 items.0.id
+// 配置了 coerce 的字段类型不匹配时尝试转换，有转换时返回转换后的数据，类型和原数据一致，否则返回原数据
+func (am *ActionMetadata) checkResponseFields(retData any) (any, error) {
+	data, err := toJSONValue(retData, false)
+	if err != nil {
+		return retData, err
+	}
+	if _, ok := data.(map[string]any); !ok {
+		// 返回字段都是可选的时候，不是对象的返回没有需要检查的字段
+		if !lo.ContainsBy(am.Responses, func(rc ReturnConfig) bool { return rc.Name != "" && rc.Required }) {
+			return retData, nil
+		}
+		return retData, fmt.Errorf("expected an object response, got %s", jsonTypeName(data))
+	}
+
+	errs, coerced := make([]string, 0), false
+	for _, rc := range am.Responses {
+		if rc.Name == "" {
+			continue
+		}
+		rt, err := parseResponseType(rc.Type)
+		if err != nil {
+			rt = &responseType{name: rc.Type, kind: responseKindAny}
+		}
+		lookupResponseField(data, nil, strings.Split(rc.Name, "."), "", func(path string, v any, found bool, set func(any)) {
+			switch {
+			case !found:
+				if rc.Required {
+					errs = append(errs, fmt.Sprintf("%s: required field is missing, expected %s", path, rt.name))
+				}
+				return
+			case v == nil:
+				if rc.Required {
+					errs = append(errs, fmt.Sprintf("%s: expected %s, got null", path, rt.name))
+				}
+				return
+			}
+			if nv, changed := rt.match(v, rc.Coerce, path, &errs); changed {
+				set(nv)
+				coerced = true
+			}
+		})
+	}
+	if len(errs) > 0 {
+		return retData, errors.New(strings.Join(errs, "; "))
+	}
+	if coerced {
+		return restoreResponseType(retData, data)
+	}
+	return retData, nil
+}
+
+// restoreResponseType 转换后的数据还原为原数据的类型，比如结构体、json 字符串
+func restoreResponseType(retData any, data any) (any, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return retData, fmt.Errorf("marshal coerced response failed: %w", err)
+	}
+	t := reflect.TypeOf(retData)
+	switch {
+	case t == reflect.TypeOf(data):
+		return data, nil
+	case t.Kind() == reflect.String:
+		return reflect.ValueOf(string(raw)).Convert(t).Interface(), nil
+	}
+	value := reflect.New(t)
+	if err = json.Unmarshal(raw, value.Interface()); err != nil {
+		return retData, fmt.Errorf("coerced response cannot be converted to %s: %w", t, err)
+	}
+	return value.Elem().Interface(), nil
+}
+
+// lookupResponseField 按路径查找字段，找到或者找不到时都会回调，set 用来写回转换后的值
+func lookupResponseField(v any, set func(any), segs []string, path string, visit func(path string, v any, found bool, set func(any))) {
+	if len(segs) == 0 {
+		visit(path, v, true, set)
+		return
+	}
+	seg, rest := segs[0], segs[1:]
+	switch val := v.(type) {
+	case map[string]any:
+		child, ok := val[seg]
+		childPath := strings.TrimPrefix(path+"."+seg, ".")
+		if !ok {
+			visit(strings.Join(append([]string{childPath}, rest...), "."), nil, false, nil)
+			return
+		}
+		lookupResponseField(child, func(nv any) { val[seg] = nv }, rest, childPath, visit)
+	case []any:
+		if idx, err := strconv.Atoi(seg); err == nil {
+			childPath := fmt.Sprintf("%s[%d]", path, idx)
+			if idx < 0 || idx >= len(val) {
+				visit(strings.Join(append([]string{childPath}, rest...), "."), nil, false, nil)
+				return
+			}
+			lookupResponseField(val[idx], func(nv any) { val[idx] = nv }, rest, childPath, visit)
+			return
+		}
+		for i := range val {
+			lookupResponseField(val[i], func(nv any) { val[i] = nv }, segs, fmt.Sprintf("%s[%d]", path, i), visit)
+		}
+	default:
+		visit(strings.TrimPrefix(path+"."+strings.Join(segs, "."), "."), nil, false, nil)
+	}
+}
+
+// match 检查值的类型，返回转换后的值和是否有转换
+func (rt *responseType) match(v any, coerce bool, path string, errs *[]string) (any, bool) {
+	if rt.kind == responseKindAny || isJSONType(v, rt.kind) {
+		if list, ok := v.([]any); ok && rt.kind == responseKindArray {
+			changed := false
+			for i, item := range list {
+				if item == nil {
+					continue
+				}
+				if nv, itemChanged := rt.elem.match(item, coerce, fmt.Sprintf("%s[%d]", path, i), errs); itemChanged {
+					list[i], changed = nv, true
+				}
+			}
+			return list, changed
+		}
+		return v, false
+	}
+	if coerce {
+		if nv, ok := coerceResponseValue(v, rt.kind); ok {
+			return nv, true
+		}
+	}
+	*errs = append(*errs, fmt.Sprintf("%s: expected %s, got %s", path, rt.name, jsonTypeName(v)))
+	return v, false
+}
+
+// coerceResponseValue 只转换标量：数字、bool 转字符串，字符串形式的数字、bool 转为对应类型
+func coerceResponseValue(v any, kind string) (any, bool) {
+	switch kind {
+	case responseKindString:
+		switch v.(type) {
+		case float64, bool:
+			return conv.String(v), true
+		}
+	case responseKindInteger:
+		if str, ok := v.(string); ok {
+			if num, err := strconv.ParseInt(strings.TrimSpace(str), 10, 64); err == nil {
+				return float64(num), true
+			}
+		}
+	case responseKindNumber:
+		if str, ok := v.(string); ok {
+			if num, err := strconv.ParseFloat(strings.TrimSpace(str), 64); err == nil {
+				return num, true
+			}
+		}
+	case responseKindBoolean:
+		switch val := v.(type) {
+		case string:
+			if b, err := strconv.ParseBool(strings.TrimSpace(val)); err == nil {
+				return b, true
+			}
+		case float64:
+			if val == 0 || val == 1 {
+				return val == 1, true
+			}
+		}
+	}
+	return nil, false
+}
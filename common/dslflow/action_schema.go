@@ -0,0 +1,356 @@
+package dslflow
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/magic-lib/go-plat-utils/cond"
+	"github.com/samber/lo"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// JSONSchema action 输入输出的 JSON Schema，只使用 type/properties/required/items/additionalProperties/enum/anyOf 等常用关键字
+type JSONSchema map[string]any
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// TypeJSONSchema 根据 Go 类型生成 JSON Schema，字段名取 json tag，validate/binding tag 中有 required 的字段为必填，
+// description tag 作为字段描述，t 为 nil 或 interface 时返回 nil，表示不限制
+func TypeJSONSchema(t reflect.Type) JSONSchema {
+	if t == nil || t.Kind() == reflect.Interface {
+		return nil
+	}
+	return (&typeSchemaBuilder{visiting: make(map[reflect.Type]bool)}).schema(t)
+}
+
+type typeSchemaBuilder struct {
+	visiting map[reflect.Type]bool // 正在生成的结构体，递归引用自己时不再展开
+}
+
+func (b *typeSchemaBuilder) schema(t reflect.Type) map[string]any {
+	if t.Kind() == reflect.Ptr {
+		return nullable(b.schema(t.Elem()))
+	}
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	if t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType) {
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if b.visiting[t] {
+			return map[string]any{"type": "object"}
+		}
+		b.visiting[t] = true
+		defer delete(b.visiting, t)
+		properties, required := make(map[string]any), make([]string, 0)
+		b.structFields(t, properties, &required)
+		schema := map[string]any{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			sort.Strings(required)
+			schema["required"] = required
+		}
+		return schema
+	case reflect.Map:
+		schema := map[string]any{"type": "object"}
+		if t.Elem().Kind() != reflect.Interface {
+			schema["additionalProperties"] = b.schema(t.Elem())
+		}
+		return schema
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]any{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Array:
+		return map[string]any{"type": "array", "items": b.schema(t.Elem()), "minItems": t.Len(), "maxItems": t.Len()}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	}
+	return map[string]any{}
+}
+
+// structFields 和 encoding/json 一致，没有 json 名称的匿名结构体字段展开到外层
+func (b *typeSchemaBuilder) structFields(t reflect.Type, properties map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			b.structFields(ft, properties, required)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		name = lo.Ternary(name != "", name, f.Name)
+		schema := b.schema(f.Type)
+		if desc := f.Tag.Get("description"); desc != "" {
+			schema = lo.Assign(schema, map[string]any{"description": desc})
+		}
+		properties[name] = schema
+		if hasRequiredTag(f.Tag) {
+			*required = append(*required, name)
+		}
+	}
+}
+
+func hasRequiredTag(tag reflect.StructTag) bool {
+	for _, key := range []string{"validate", "binding"} {
+		if lo.Contains(strings.Split(tag.Get(key), ","), "required") {
+			return true
+		}
+	}
+	return false
+}
+
+// validate 检查数据是否满足 schema，返回所有不满足的字段
+// 数据先转换成 json 的表示，字符串形式的 json 参数会先解析，schema 本身是字符串时不解析
+func (s JSONSchema) validate(value any) error {
+	if len(s) == 0 {
+		return nil
+	}
+	data, err := toJSONValue(value, schemaAllows(s, "string"))
+	if err != nil {
+		return err
+	}
+	errs := make([]string, 0)
+	validateSchema(s, data, "$", &errs)
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func toJSONValue(value any, keepString bool) (any, error) {
+	if str, ok := value.(string); ok {
+		if keepString || !cond.IsJson(str) {
+			return str, nil
+		}
+		var data any
+		if err := json.Unmarshal([]byte(str), &data); err != nil {
+			return str, nil
+		}
+		return data, nil
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("marshal value failed: %w", err)
+	}
+	var data any
+	if err = json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("unmarshal value failed: %w", err)
+	}
+	return data, nil
+}
+
+func validateSchema(schema map[string]any, v any, path string, errs *[]string) {
+	if anyOf, ok := schema["anyOf"].([]any); ok {
+		for _, sub := range anyOf {
+			subErrs := make([]string, 0)
+			if subSchema, ok := asSchemaMap(sub); ok {
+				validateSchema(subSchema, v, path, &subErrs)
+			}
+			if len(subErrs) == 0 {
+				return
+			}
+		}
+		*errs = append(*errs, fmt.Sprintf("%s: %s matches none of the allowed schemas", path, jsonTypeName(v)))
+		return
+	}
+	if types := schemaTypes(schema); len(types) > 0 && !lo.ContainsBy(types, func(typ string) bool { return isJSONType(v, typ) }) {
+		*errs = append(*errs, fmt.Sprintf("%s: expected %s, got %s", path, strings.Join(types, " or "), jsonTypeName(v)))
+		return
+	}
+	if enum, ok := schema["enum"]; ok {
+		values := toAnySlice(enum)
+		if !lo.ContainsBy(values, func(e any) bool { return reflect.DeepEqual(e, v) }) {
+			*errs = append(*errs, fmt.Sprintf("%s: %v is not one of %v", path, v, values))
+		}
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		if str, isStr := v.(string); isStr {
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(str) {
+				*errs = append(*errs, fmt.Sprintf("%s: %q does not match %s", path, str, pattern))
+			}
+		}
+	}
+	if minimum, ok := schema["minimum"]; ok {
+		if num, isNum := v.(float64); isNum && num < toFloat(minimum) {
+			*errs = append(*errs, fmt.Sprintf("%s: %v is less than %v", path, num, minimum))
+		}
+	}
+
+	switch val := v.(type) {
+	case map[string]any:
+		for _, key := range toStringSlice(schema["required"]) {
+			if _, ok := val[key]; !ok {
+				*errs = append(*errs, fmt.Sprintf("%s.%s: required field is missing", path, key))
+			}
+		}
+		properties, _ := asSchemaMap(schema["properties"])
+		keys := lo.Keys(val)
+		sort.Strings(keys)
+		for _, key := range keys {
+			if prop, ok := asSchemaMap(properties[key]); ok {
+				validateSchema(prop, val[key], path+"."+key, errs)
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					*errs = append(*errs, fmt.Sprintf("%s.%s: unknown field", path, key))
+				}
+			default:
+				if extraSchema, ok := asSchemaMap(extra); ok {
+					validateSchema(extraSchema, val[key], path+"."+key, errs)
+				}
+			}
+		}
+	case []any:
+		if items, ok := asSchemaMap(schema["items"]); ok {
+			for i, item := range val {
+				validateSchema(items, item, fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+		}
+		if minItems, ok := schema["minItems"]; ok && float64(len(val)) < toFloat(minItems) {
+			*errs = append(*errs, fmt.Sprintf("%s: expected at least %v items, got %d", path, minItems, len(val)))
+		}
+		if maxItems, ok := schema["maxItems"]; ok && float64(len(val)) > toFloat(maxItems) {
+			*errs = append(*errs, fmt.Sprintf("%s: expected at most %v items, got %d", path, maxItems, len(val)))
+		}
+	}
+}
+
+// asSchemaMap schema 可能是代码生成的，也可能是从 json/yaml 中解析的
+func asSchemaMap(v any) (map[string]any, bool) {
+	switch s := v.(type) {
+	case JSONSchema:
+		return s, true
+	case map[string]any:
+		return s, true
+	}
+	return nil, false
+}
+
+func schemaAllows(schema map[string]any, typ string) bool {
+	if lo.Contains(schemaTypes(schema), typ) {
+		return true
+	}
+	if anyOf, ok := schema["anyOf"].([]any); ok {
+		return lo.ContainsBy(anyOf, func(sub any) bool {
+			subSchema, ok := asSchemaMap(sub)
+			return ok && schemaAllows(subSchema, typ)
+		})
+	}
+	return false
+}
+
+func schemaTypes(schema map[string]any) []string {
+	if typ, ok := schema["type"].(string); ok {
+		return []string{typ}
+	}
+	return toStringSlice(schema["type"])
+}
+
+func isJSONType(v any, typ string) bool {
+	switch typ {
+	case "null":
+		return v == nil
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		num, ok := v.(float64)
+		return ok && num == math.Trunc(num)
+	}
+	return true
+}
+
+func jsonTypeName(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		return lo.Ternary(val == math.Trunc(val), "integer", "number")
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func toAnySlice(v any) []any {
+	switch list := v.(type) {
+	case []any:
+		return list
+	case []string:
+		return lo.ToAnySlice(list)
+	}
+	return nil
+}
+
+func toStringSlice(v any) []string {
+	switch list := v.(type) {
+	case []string:
+		return list
+	case []any:
+		return lo.FilterMap(list, func(item any, _ int) (string, bool) {
+			str, ok := item.(string)
+			return str, ok
+		})
+	}
+	return nil
+}
+
+func toFloat(v any) float64 {
+	switch num := v.(type) {
+	case int:
+		return float64(num)
+	case float64:
+		return num
+	}
+	return 0
+}
@@ -0,0 +1,19 @@
+// schemagen 生成工作流定义的 JSON Schema，通过 go generate 调用
+package main
+
+import (
+	"fmt"
+	"github.com/magic-lib/workflow/common/dslflow"
+	"os"
+)
+
+func main() {
+	fileName := "workflow.schema.json"
+	if len(os.Args) > 1 {
+		fileName = os.Args[1]
+	}
+	if err := dslflow.WriteWorkflowJSONSchema(fileName); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
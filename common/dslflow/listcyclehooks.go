@@ -3,12 +3,16 @@ package dslflow
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/magic-lib/workflow/common/errorflow"
+	"github.com/samber/lo"
+	"time"
 )
 
 type (
 	LifecycleEvent string
 	LifecycleHooks map[LifecycleEvent]*Activity
+	HookPolicy     string // 钩子执行失败时的处理策略
 )
 
 const (
@@ -19,6 +23,20 @@ const (
 	LifecycleEventOnTimeout  LifecycleEvent = "timeout"
 )
 
+const (
+	HookPolicyIgnore HookPolicy = "ignore" // 钩子失败只打印日志，默认策略
+	HookPolicyAbort  HookPolicy = "abort"  // start 钩子失败时不再执行主动作，其他钩子失败仍然只打印日志
+)
+
+var (
+	lifecycleEventList = []LifecycleEvent{
+		LifecycleEventOnStart, LifecycleEventOnComplete, LifecycleEventOnSuccess, LifecycleEventOnError, LifecycleEventOnTimeout,
+	}
+	hookPolicyList = []HookPolicy{HookPolicyIgnore, HookPolicyAbort}
+
+	defaultHookTimeout = 30 * time.Second // 钩子没有配置超时时间时使用
+)
+
 // GetHookAction 获取钩子行为
 func (lhs LifecycleHooks) getHookAction(e LifecycleEvent) *Activity {
 	hook, ok := lhs[e]
@@ -28,28 +46,69 @@ func (lhs LifecycleHooks) getHookAction(e LifecycleEvent) *Activity {
 	return nil
 }
 
-// Execute 执行钩子
-func (lhs LifecycleHooks) Execute(ctx context.Context, am ActionExecutor, param any) (any, error) {
-	_, _ = lhs.executeByEvent(LifecycleEventOnStart)
+// Execute 执行主动作，并在各个生命周期触发对应的钩子
+// vars 为 activity 的输入参数，钩子中可以通过 {{hook.event}}、{{hook.arguments}}、{{hook.result}}、{{hook.error}} 获取执行信息
+func (lhs LifecycleHooks) Execute(ctx context.Context, am ActionExecutor, vars map[string]any, param any, policy HookPolicy) (any, error) {
+	if err := lhs.executeByEvent(ctx, LifecycleEventOnStart, vars, param, nil, nil); err != nil {
+		if policy == HookPolicyAbort {
+			return nil, fmt.Errorf("start hook failed: %w", err)
+		}
+		logWarn(ctx, "start hook failed", "error", err)
+	}
+
 	retInfo, err := am.ActionExecute(ctx, param)
+	var hookErr error
 	if err != nil {
 		if errorflow.IsTimeoutError(err) || errors.Is(err, context.DeadlineExceeded) {
-			_, _ = lhs.executeByEvent(LifecycleEventOnTimeout)
+			hookErr = lhs.executeByEvent(ctx, LifecycleEventOnTimeout, vars, param, retInfo, err)
 		} else {
-			_, _ = lhs.executeByEvent(LifecycleEventOnError)
+			hookErr = lhs.executeByEvent(ctx, LifecycleEventOnError, vars, param, retInfo, err)
 		}
 	} else {
-		_, _ = lhs.executeByEvent(LifecycleEventOnSuccess)
+		hookErr = lhs.executeByEvent(ctx, LifecycleEventOnSuccess, vars, param, retInfo, err)
+	}
+	if hookErr != nil {
+		logWarn(ctx, "hook failed", "error", hookErr)
+	}
+	if hookErr = lhs.executeByEvent(ctx, LifecycleEventOnComplete, vars, param, retInfo, err); hookErr != nil {
+		logWarn(ctx, "complete hook failed", "error", hookErr)
 	}
-	_, _ = lhs.executeByEvent(LifecycleEventOnComplete)
 	return retInfo, err
 }
 
-func (lhs LifecycleHooks) executeByEvent(e LifecycleEvent) (any, error) {
+// executeByEvent 执行某个事件的钩子，钩子不受主动作超时的影响，使用自己的超时时间
+func (lhs LifecycleHooks) executeByEvent(ctx context.Context, e LifecycleEvent, vars map[string]any, param any, result any, err error) error {
 	actionRun := lhs.getHookAction(e)
-	if actionRun != nil {
-		//actionRun.Execute()
-		return nil, nil
+	if actionRun == nil {
+		return nil
 	}
-	return nil, nil
+
+	timeout := defaultHookTimeout
+	if actionRun.Timeout > 0 {
+		timeout = time.Duration(actionRun.Timeout) * time.Second
+	}
+	hookCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	// json 字符串转为 map，模版中才能按路径引用，比如 {{hook.arguments.name}}
+	hookInfo := map[string]any{
+		"event":   string(e),
+		Arguments: param,
+		Result:    result,
+		"error":   "",
+	}
+	for _, k := range []string{Arguments, Result} {
+		if m := createMap(hookInfo[k]); len(m) > 0 {
+			hookInfo[k] = m
+		}
+	}
+	if err != nil {
+		hookInfo["error"] = err.Error()
+	}
+	hookVars := lo.Assign(vars, map[string]any{Hook: hookInfo})
+
+	if _, hookErr := actionRun.Execute(hookCtx, hookVars); hookErr != nil {
+		return fmt.Errorf("%s hook %s: %w", e, activityName(actionRun), hookErr)
+	}
+	return nil
 }
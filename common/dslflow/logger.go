@@ -0,0 +1,118 @@
+package dslflow
+
+import (
+	"context"
+	"log/slog"
+)
+
+type (
+	// Logger 工作流执行日志，args 为 key、value 交替的字段，和 log/slog 一致
+	// 每条日志会带上 run_id、path（节点路径）、activity_id、action（namespace/activity），重试时带上 attempt
+	Logger interface {
+		Debug(ctx context.Context, msg string, args ...any)
+		Info(ctx context.Context, msg string, args ...any)
+		Warn(ctx context.Context, msg string, args ...any)
+		Error(ctx context.Context, msg string, args ...any)
+	}
+
+	nopLogger  struct{}
+	slogLogger struct {
+		l *slog.Logger
+	}
+
+	loggerKey   struct{}
+	logAttrsKey struct{}
+)
+
+// NopLogger 不输出任何日志，默认使用
+func NopLogger() Logger {
+	return nopLogger{}
+}
+
+func (nopLogger) Debug(context.Context, string, ...any) {}
+func (nopLogger) Info(context.Context, string, ...any)  {}
+func (nopLogger) Warn(context.Context, string, ...any)  {}
+func (nopLogger) Error(context.Context, string, ...any) {}
+
+// NewSlogLogger 使用 log/slog 输出日志，l 为空时使用 slog.Default()
+func NewSlogLogger(l *slog.Logger) Logger {
+	if l == nil {
+		l = slog.Default()
+	}
+	return &slogLogger{l: l}
+}
+
+func (s *slogLogger) Debug(ctx context.Context, msg string, args ...any) {
+	s.l.DebugContext(ctx, msg, args...)
+}
+
+func (s *slogLogger) Info(ctx context.Context, msg string, args ...any) {
+	s.l.InfoContext(ctx, msg, args...)
+}
+
+func (s *slogLogger) Warn(ctx context.Context, msg string, args ...any) {
+	s.l.WarnContext(ctx, msg, args...)
+}
+
+func (s *slogLogger) Error(ctx context.Context, msg string, args ...any) {
+	s.l.ErrorContext(ctx, msg, args...)
+}
+
+// WithLogger 设置本次执行使用的日志，优先于 Workflow.Logger
+func WithLogger(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// withLogAttrs 之后的日志都带上这些字段，已有的同名字段被覆盖，比如进入子节点时的 path
+func withLogAttrs(ctx context.Context, args ...any) context.Context {
+	attrs, _ := ctx.Value(logAttrsKey{}).([]any)
+	newAttrs := append([]any{}, attrs...)
+	for i := 0; i+1 < len(args); i += 2 {
+		replaced := false
+		for j := 0; j+1 < len(newAttrs); j += 2 {
+			if newAttrs[j] == args[i] {
+				newAttrs[j+1] = args[i+1]
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			newAttrs = append(newAttrs, args[i], args[i+1])
+		}
+	}
+	return context.WithValue(ctx, logAttrsKey{}, newAttrs)
+}
+
+// getLogger 当前执行使用的日志：WithLogger > Workflow.Logger > NopLogger，Workflow.Logger 在执行开始时放入 context
+func getLogger(ctx context.Context) Logger {
+	if l, ok := ctx.Value(loggerKey{}).(Logger); ok && l != nil {
+		return l
+	}
+	return nopLogger{}
+}
+
+// logArgs 日志的字段：run_id、context 中记录的字段，再加上 args
+func logArgs(ctx context.Context, args []any) []any {
+	attrs, _ := ctx.Value(logAttrsKey{}).([]any)
+	all := make([]any, 0, len(attrs)+len(args)+2)
+	if runID := RunID(ctx); runID != "" {
+		all = append(all, "run_id", runID)
+	}
+	return append(append(all, attrs...), args...)
+}
+
+func logDebug(ctx context.Context, msg string, args ...any) {
+	getLogger(ctx).Debug(ctx, msg, logArgs(ctx, args)...)
+}
+
+func logInfo(ctx context.Context, msg string, args ...any) {
+	getLogger(ctx).Info(ctx, msg, logArgs(ctx, args)...)
+}
+
+func logWarn(ctx context.Context, msg string, args ...any) {
+	getLogger(ctx).Warn(ctx, msg, logArgs(ctx, args)...)
+}
+
+func logError(ctx context.Context, msg string, args ...any) {
+	getLogger(ctx).Error(ctx, msg, logArgs(ctx, args)...)
+}
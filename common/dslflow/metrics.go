@@ -0,0 +1,61 @@
+package dslflow
+
+import (
+	"context"
+	"time"
+)
+
+type (
+	// Metrics 工作流执行指标，action 为 namespace/activity，activity 为 activity 的 id，没有 id 时为 action
+	// 缓存命中率 = 命中次数 / (命中次数 + 未命中次数)
+	Metrics interface {
+		ActionExecuted(ctx context.Context, action string, duration time.Duration, err error)       // action 执行一次，缓存命中时不执行
+		ActionRetried(ctx context.Context, action string)                                           // action 执行失败后准备重试
+		CacheLookup(ctx context.Context, activity string, hit bool)                                 // activity 查询缓存的结果
+		RunStarted(ctx context.Context, workflow string)                                            // 工作流开始执行，包括 Resume
+		RunFinished(ctx context.Context, workflow string, status RunStatus, duration time.Duration) // 工作流执行结束，status 为最终状态
+		BackgroundStarted(ctx context.Context, workflow string)                                     // onexit: exit 之后的流程开始在后台执行
+		BackgroundFinished(ctx context.Context, workflow string)                                    // 后台执行的流程结束
+	}
+
+	nopMetrics struct{}
+
+	metricsKey struct{}
+)
+
+func (nopMetrics) ActionExecuted(context.Context, string, time.Duration, error)  {}
+func (nopMetrics) ActionRetried(context.Context, string)                         {}
+func (nopMetrics) CacheLookup(context.Context, string, bool)                     {}
+func (nopMetrics) RunStarted(context.Context, string)                            {}
+func (nopMetrics) RunFinished(context.Context, string, RunStatus, time.Duration) {}
+func (nopMetrics) BackgroundStarted(context.Context, string)                     {}
+func (nopMetrics) BackgroundFinished(context.Context, string)                    {}
+
+// WithMetrics 设置本次执行使用的 Metrics，优先于 Workflow.Metrics，子流程使用父流程的 Metrics
+func WithMetrics(ctx context.Context, m Metrics) context.Context {
+	return context.WithValue(ctx, metricsKey{}, m)
+}
+
+func getMetrics(ctx context.Context) Metrics {
+	if m, ok := ctx.Value(metricsKey{}).(Metrics); ok && m != nil {
+		return m
+	}
+	return nopMetrics{}
+}
+
+// workflowName 当前执行的工作流名称，用作指标的 workflow 标签
+func workflowName(ctx context.Context) string {
+	if rs := getRunState(ctx); rs != nil && rs.workflow != nil {
+		return rs.workflow.Name
+	}
+	return ""
+}
+
+// startBackground 记录 onexit: exit 之后在后台执行的流程，返回的函数在后台流程结束时调用
+func startBackground(ctx context.Context) func() {
+	m, name := getMetrics(ctx), workflowName(ctx)
+	m.BackgroundStarted(ctx, name)
+	return func() {
+		m.BackgroundFinished(ctx, name)
+	}
+}
@@ -0,0 +1,240 @@
+package dslflow
+
+import (
+	"context"
+	"fmt"
+	"github.com/samber/lo"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	metricActionExecutions   = "dslflow_action_executions_total"
+	metricActionFailures     = "dslflow_action_failures_total"
+	metricActionDuration     = "dslflow_action_duration_seconds"
+	metricActionRetries      = "dslflow_action_retries_total"
+	metricCacheRequests      = "dslflow_activity_cache_requests_total"
+	metricWorkflowRuns       = "dslflow_workflow_runs_total"
+	metricWorkflowDuration   = "dslflow_workflow_duration_seconds"
+	metricWorkflowInFlight   = "dslflow_workflow_runs_in_flight"
+	metricBackgroundInFlight = "dslflow_workflow_background_in_flight"
+)
+
+// DefaultMetricBuckets 耗时直方图默认的桶，单位秒，和 Prometheus 客户端的默认值一致
+var DefaultMetricBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type (
+	metricDesc struct {
+		name string
+		kind string // counter/gauge/histogram
+		help string
+	}
+
+	// metricFamily 一个指标下按标签区分的值，key 为渲染好的标签
+	metricFamily struct {
+		values     map[string]float64
+		histograms map[string]*histogram
+	}
+
+	histogram struct {
+		counts []uint64 // 每个桶的数量，不累计
+		count  uint64
+		sum    float64
+	}
+
+	// MemoryMetrics 在进程内记录指标，实现了 http.Handler，按 Prometheus 文本格式输出
+	MemoryMetrics struct {
+		mu       sync.Mutex
+		buckets  []float64
+		families map[string]*metricFamily
+	}
+)
+
+var metricDescs = []metricDesc{
+	{metricActionExecutions, "counter", "Number of action executions."},
+	{metricActionFailures, "counter", "Number of failed action executions."},
+	{metricActionDuration, "histogram", "Action execution latency in seconds."},
+	{metricActionRetries, "counter", "Number of action retries."},
+	{metricCacheRequests, "counter", "Number of activity cache lookups by result."},
+	{metricWorkflowRuns, "counter", "Number of finished workflow runs by status."},
+	{metricWorkflowDuration, "histogram", "Workflow run duration in seconds."},
+	{metricWorkflowInFlight, "gauge", "Number of workflow runs in progress."},
+	{metricBackgroundInFlight, "gauge", "Number of onexit continuations running in background."},
+}
+
+// NewMemoryMetrics 新建进程内指标，buckets 为空时使用 DefaultMetricBuckets
+func NewMemoryMetrics(buckets ...float64) *MemoryMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultMetricBuckets
+	}
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+	m := &MemoryMetrics{buckets: buckets, families: make(map[string]*metricFamily)}
+	for _, desc := range metricDescs {
+		m.families[desc.name] = &metricFamily{values: make(map[string]float64), histograms: make(map[string]*histogram)}
+	}
+	return m
+}
+
+func (m *MemoryMetrics) ActionExecuted(_ context.Context, action string, duration time.Duration, err error) {
+	labels := metricLabels("action", action)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.families[metricActionExecutions].values[labels]++
+	if err != nil {
+		m.families[metricActionFailures].values[labels]++
+	}
+	m.observe(metricActionDuration, labels, duration.Seconds())
+}
+
+func (m *MemoryMetrics) ActionRetried(_ context.Context, action string) {
+	m.add(metricActionRetries, metricLabels("action", action), 1)
+}
+
+func (m *MemoryMetrics) CacheLookup(_ context.Context, activity string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.add(metricCacheRequests, metricLabels("activity", activity, "result", result), 1)
+}
+
+func (m *MemoryMetrics) RunStarted(_ context.Context, workflow string) {
+	m.add(metricWorkflowInFlight, metricLabels("workflow", workflow), 1)
+}
+
+func (m *MemoryMetrics) RunFinished(_ context.Context, workflow string, status RunStatus, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.families[metricWorkflowInFlight].values[metricLabels("workflow", workflow)]--
+	m.families[metricWorkflowRuns].values[metricLabels("workflow", workflow, "status", string(status))]++
+	m.observe(metricWorkflowDuration, metricLabels("workflow", workflow), duration.Seconds())
+}
+
+func (m *MemoryMetrics) BackgroundStarted(_ context.Context, workflow string) {
+	m.add(metricBackgroundInFlight, metricLabels("workflow", workflow), 1)
+}
+
+func (m *MemoryMetrics) BackgroundFinished(_ context.Context, workflow string) {
+	m.add(metricBackgroundInFlight, metricLabels("workflow", workflow), -1)
+}
+
+// CacheHitRatio activity 的缓存命中率，没有查询过缓存时为 0
+func (m *MemoryMetrics) CacheHitRatio(activity string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	values := m.families[metricCacheRequests].values
+	hit := values[metricLabels("activity", activity, "result", "hit")]
+	miss := values[metricLabels("activity", activity, "result", "miss")]
+	if hit+miss == 0 {
+		return 0
+	}
+	return hit / (hit + miss)
+}
+
+// ServeHTTP 按 Prometheus 文本格式输出所有指标
+func (m *MemoryMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = m.WriteTo(w)
+}
+
+// WriteTo 按 Prometheus 文本格式写入所有指标，同一指标按标签排序
+func (m *MemoryMetrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var sb strings.Builder
+	for _, desc := range metricDescs {
+		family := m.families[desc.name]
+		if len(family.values) == 0 && len(family.histograms) == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, "# HELP %s %s\n# TYPE %s %s\n", desc.name, desc.help, desc.name, desc.kind)
+		if desc.kind != "histogram" {
+			for _, labels := range sortedKeys(family.values) {
+				fmt.Fprintf(&sb, "%s%s %s\n", desc.name, wrapLabels(labels), formatMetricValue(family.values[labels]))
+			}
+			continue
+		}
+		for _, labels := range sortedKeys(family.histograms) {
+			h := family.histograms[labels]
+			var cumulative uint64
+			for i, upper := range m.buckets {
+				cumulative += h.counts[i]
+				fmt.Fprintf(&sb, "%s_bucket%s %d\n", desc.name, wrapLabels(joinLabels(labels, metricLabels("le", formatMetricValue(upper)))), cumulative)
+			}
+			fmt.Fprintf(&sb, "%s_bucket%s %d\n", desc.name, wrapLabels(joinLabels(labels, `le="+Inf"`)), h.count)
+			fmt.Fprintf(&sb, "%s_sum%s %s\n", desc.name, wrapLabels(labels), formatMetricValue(h.sum))
+			fmt.Fprintf(&sb, "%s_count%s %d\n", desc.name, wrapLabels(labels), h.count)
+		}
+	}
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
+
+func (m *MemoryMetrics) add(name string, labels string, delta float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.families[name].values[labels] += delta
+}
+
+// observe 记录直方图的一个值，调用方持有锁
+func (m *MemoryMetrics) observe(name string, labels string, value float64) {
+	family := m.families[name]
+	h, ok := family.histograms[labels]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		family.histograms[labels] = h
+	}
+	if i := sort.SearchFloat64s(m.buckets, value); i < len(m.buckets) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += value
+}
+
+// metricLabels 渲染标签，kv 为 key、value 交替，值按 Prometheus 文本格式转义
+func metricLabels(kv ...string) string {
+	pairs := make([]string, 0, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(kv[i+1])
+		pairs = append(pairs, kv[i]+`="`+value+`"`)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func joinLabels(labels ...string) string {
+	nonEmpty := make([]string, 0, len(labels))
+	for _, l := range labels {
+		if l != "" {
+			nonEmpty = append(nonEmpty, l)
+		}
+	}
+	return strings.Join(nonEmpty, ",")
+}
+
+func wrapLabels(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatMetricValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := lo.Keys(m)
+	sort.Strings(keys)
+	return keys
+}
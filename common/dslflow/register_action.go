@@ -89,6 +89,14 @@ func ChangeActionInterface[I, O any](method any, ac *ActionMetadata) (ActionInte
 		var zero I
 		ac.ArgumentType = reflect.TypeOf(zero)
 	}
+	if ac.ResponseType == nil {
+		var zero O
+		ac.ResponseType = reflect.TypeOf(zero)
+	}
+	if err = ac.checkResponseConfigs(); err != nil {
+		return nil, err
+	}
+	ac.resolveSchemas()
 
 	return &methodAdapter{
 		actionMeta: ac,
@@ -105,6 +113,10 @@ func RegisterAction(ai ActionInterface) error {
 	if am == nil || am.Activity == "" {
 		return fmt.Errorf("activity name is empty")
 	}
+	if err := am.checkResponseConfigs(); err != nil {
+		return err
+	}
+	am.resolveSchemas()
 	activityKey := getActionKey(am.Namespace, am.Activity)
 	// 不能重复注册，避免覆盖
 	if actionRegistry.Has(activityKey) {
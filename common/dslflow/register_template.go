@@ -0,0 +1,143 @@
+package dslflow
+
+import (
+	"fmt"
+	cmapv2 "github.com/orcaman/concurrent-map/v2"
+	"github.com/samber/lo"
+	"strings"
+)
+
+var (
+	activityTemplateRegistry = cmapv2.New[*Activity]()
+)
+
+// RegisterActivityTemplate 注册全局的 activity 模版，工作流中通过 template: name 引用
+func RegisterActivityTemplate(name string, ac *Activity) error {
+	if name == "" {
+		return fmt.Errorf("template name is empty")
+	}
+	if ac == nil {
+		return fmt.Errorf("template %s is nil", name)
+	}
+	// 不能重复注册，避免覆盖
+	if activityTemplateRegistry.Has(name) {
+		return fmt.Errorf("template %s is already registered", name)
+	}
+	activityTemplateRegistry.Set(name, ac)
+	return nil
+}
+
+// GetActivityTemplate 获取全局的 activity 模版
+func GetActivityTemplate(name string) (*Activity, error) {
+	ac, ok := activityTemplateRegistry.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("template %s is not registered", name)
+	}
+	return ac, nil
+}
+
+// resolveActivityTemplate 展开 activity 引用的模版，优先使用工作流中定义的模版，模版可以继续引用其他模版
+func resolveActivityTemplate(ac *Activity, templates map[string]*Activity) (*Activity, error) {
+	resolved := ac
+	seen := make([]string, 0)
+	for resolved.Template != "" {
+		name := resolved.Template
+		if lo.Contains(seen, name) {
+			return nil, fmt.Errorf("circular template reference: %s -> %s", strings.Join(seen, " -> "), name)
+		}
+		seen = append(seen, name)
+
+		tpl, ok := templates[name]
+		if !ok || tpl == nil {
+			var err error
+			if tpl, err = GetActivityTemplate(name); err != nil {
+				return nil, fmt.Errorf("activity template %s not found", name)
+			}
+		}
+		resolved = resolved.mergeTemplate(tpl)
+	}
+	return resolved, nil
+}
+
+// mergeTemplate 以模版为基础生成新的 activity，activity 中配置了的字段覆盖模版，map 类型的字段按 key 覆盖
+// timeout、cached、cache_ttl 和 retry_policy 在 yaml 中写成零值时也覆盖模版；DependsOn 与流程结构相关，不从模版继承
+func (ac *Activity) mergeTemplate(tpl *Activity) *Activity {
+	merged := *tpl
+	merged.Template = tpl.Template
+	merged.Id = ac.Id
+	merged.DependsOn = ac.DependsOn
+	merged.explicit = lo.Assign(tpl.explicit, ac.explicit)
+
+	if ac.Namespace != "" {
+		merged.Namespace = ac.Namespace
+	}
+	if ac.Activity != "" {
+		merged.Activity = ac.Activity
+	}
+	if ac.Arguments != "" {
+		merged.Arguments = ac.Arguments
+	}
+	if len(ac.ArgsForce) > 0 {
+		merged.ArgsForce = lo.Assign(tpl.ArgsForce, ac.ArgsForce)
+	}
+	if len(ac.ArgsFallback) > 0 {
+		merged.ArgsFallback = lo.Assign(tpl.ArgsFallback, ac.ArgsFallback)
+	}
+	if len(ac.Responses) > 0 {
+		merged.Responses = lo.Assign(tpl.Responses, ac.Responses)
+	}
+	if len(ac.Hooks) > 0 {
+		merged.Hooks = lo.Assign(tpl.Hooks, ac.Hooks)
+	}
+	if ac.HookPolicy != "" {
+		merged.HookPolicy = ac.HookPolicy
+	}
+	if ac.Validation != "" {
+		merged.Validation = ac.Validation
+	}
+	if ac.Compensate != nil {
+		merged.Compensate = ac.Compensate
+	}
+	if ac.overrides("timeout", ac.Timeout > 0) {
+		merged.Timeout = ac.Timeout
+	}
+	if ac.overrides("cached", ac.Cached) {
+		merged.Cached = ac.Cached
+	}
+	if ac.CacheScope != "" {
+		merged.CacheScope = ac.CacheScope
+	}
+	if ac.overrides("cache_ttl", ac.CacheTTL > 0) {
+		merged.CacheTTL = ac.CacheTTL
+	}
+	if ac.CacheKey != "" {
+		merged.CacheKey = ac.CacheKey
+	}
+	if ac.overrides("retry_policy.maximum_attempts", ac.RetryPolicy.MaximumAttempts > 0) {
+		merged.RetryPolicy.MaximumAttempts = ac.RetryPolicy.MaximumAttempts
+	}
+	if ac.overrides("retry_policy.initial_interval", ac.RetryPolicy.InitialInterval > 0) {
+		merged.RetryPolicy.InitialInterval = ac.RetryPolicy.InitialInterval
+	}
+	if ac.overrides("retry_policy.maximum_interval", ac.RetryPolicy.MaximumInterval > 0) {
+		merged.RetryPolicy.MaximumInterval = ac.RetryPolicy.MaximumInterval
+	}
+	if ac.overrides("retry_policy.backoff_coefficient", ac.RetryPolicy.BackoffCoefficient > 0) {
+		merged.RetryPolicy.BackoffCoefficient = ac.RetryPolicy.BackoffCoefficient
+	}
+	if ac.overrides("retry_policy.jitter", ac.RetryPolicy.Jitter > 0) {
+		merged.RetryPolicy.Jitter = ac.RetryPolicy.Jitter
+	}
+	if ac.overrides("retry_policy.deadline", ac.RetryPolicy.Deadline > 0) {
+		merged.RetryPolicy.Deadline = ac.RetryPolicy.Deadline
+	}
+	if ac.overrides("retry_policy.non_retryable_errors", len(ac.RetryPolicy.NonRetryableErrors) > 0) {
+		merged.RetryPolicy.NonRetryableErrors = ac.RetryPolicy.NonRetryableErrors
+	}
+	return &merged
+}
+
+// overrides activity 是否配置了字段：代码中构造的 activity 只看是否为零值，yaml 中写了的字段即使是零值也算
+func (ac *Activity) overrides(key string, nonZero bool) bool {
+	return nonZero || ac.explicit[key]
+}
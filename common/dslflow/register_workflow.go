@@ -0,0 +1,51 @@
+package dslflow
+
+import (
+	"fmt"
+	cmapv2 "github.com/orcaman/concurrent-map/v2"
+)
+
+var (
+	workflowRegistry = cmapv2.New[*Workflow]()
+	workflowLatest   = cmapv2.New[string]() // 工作流名称 => 最后注册的版本
+)
+
+func getWorkflowKey(name string, version string) string {
+	if version == "" {
+		return name
+	}
+	return name + "@" + version
+}
+
+// RegisterWorkflow 注册全局的工作流，其他工作流中通过 workflow 节点作为子流程调用
+func RegisterWorkflow(name string, version string, w *Workflow) error {
+	if name == "" {
+		return fmt.Errorf("workflow name is empty")
+	}
+	if w == nil {
+		return fmt.Errorf("workflow %s is nil", name)
+	}
+	workflowKey := getWorkflowKey(name, version)
+	// 不能重复注册，避免覆盖
+	if workflowRegistry.Has(workflowKey) {
+		return fmt.Errorf("workflow %s is already registered", workflowKey)
+	}
+	workflowRegistry.Set(workflowKey, w)
+	workflowLatest.Set(name, version)
+	return nil
+}
+
+// GetWorkflow 获取注册的工作流，version 为空时返回最后注册的版本
+func GetWorkflow(name string, version string) (*Workflow, error) {
+	if version == "" {
+		if latest, ok := workflowLatest.Get(name); ok {
+			version = latest
+		}
+	}
+	workflowKey := getWorkflowKey(name, version)
+	w, ok := workflowRegistry.Get(workflowKey)
+	if !ok {
+		return nil, fmt.Errorf("workflow %s is not registered", workflowKey)
+	}
+	return w, nil
+}
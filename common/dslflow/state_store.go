@@ -0,0 +1,214 @@
+package dslflow
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	cmapv2 "github.com/orcaman/concurrent-map/v2"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type RunStatus string // 工作流一次执行的状态
+
+const (
+	RunStatusRunning     RunStatus = "running"     // 执行中，进程退出后可以 Resume
+	RunStatusExited      RunStatus = "exited"      // 遇到 onexit: exit 已经返回，后续流程在后台继续执行，结束后更新为 completed 或 failed
+	RunStatusFailed      RunStatus = "failed"      // 执行失败，Resume 时从失败的节点重新执行
+	RunStatusCompleted   RunStatus = "completed"   // 执行完成，Resume 直接返回结果
+	RunStatusCompensated RunStatus = "compensated" // 执行失败并且已经执行了补偿动作，不能再 Resume
+)
+
+const (
+	childRunIDSeparator = "#" // 子流程 runID 中父流程 runID 和节点路径的分隔符
+	maxStateFileNameLen = 200 // runID 编码后超过该长度时使用 hash 作为文件名
+	stateFileSuffix     = ".json"
+)
+
+var (
+	// ErrRunNotFound StateStore 中没有该次执行的记录
+	ErrRunNotFound = errors.New("workflow run not found")
+)
+
+type (
+	// StateStore 保存工作流的执行进度，每个 Statement 执行完都会保存一次
+	StateStore interface {
+		Save(ctx context.Context, cp *Checkpoint) error
+		Load(ctx context.Context, runID string) (*Checkpoint, error) // 没有记录时返回 ErrRunNotFound
+		Delete(ctx context.Context, runID string) error
+	}
+
+	// Checkpoint 一次执行的进度
+	Checkpoint struct {
+		RunID         string                    `json:"run_id"`
+		Status        RunStatus                 `json:"status"`
+		Arguments     map[string]any            `json:"arguments"`               // 合并 Variables 后根节点的输入参数
+		Variables     map[string]any            `json:"variables"`               // 最后一个执行完的节点输出的变量
+		Statements    map[string]map[string]any `json:"statements"`              // 已执行完的节点路径 => 节点输出，Resume 时直接使用
+		Activities    map[string]map[string]any `json:"activities"`              // 已执行成功的 update 类型 activity 路径 => 输出，Resume 时不再重复执行
+		Compensations []*CompensationRecord     `json:"compensations,omitempty"` // 已执行成功的 activity 的补偿动作，按执行顺序，Resume 后失败时仍然补偿
+		Result        map[string]any            `json:"result,omitempty"`        // 执行完成后的最终返回
+		Error         string                    `json:"error,omitempty"`         // 执行失败的原因
+		UpdatedAt     time.Time                 `json:"updated_at,omitempty"`    // 最后保存的时间
+	}
+
+	// CompensationRecord 一个已执行成功的 activity 的补偿动作
+	CompensationRecord struct {
+		Key      string         `json:"key"`                // activity 路径，循环中带上下标，子流程中的 activity 加上子流程节点路径前缀
+		Workflow string         `json:"workflow,omitempty"` // 定义 activity 的子流程名称，为空时是当前工作流
+		Version  string         `json:"version,omitempty"`  // 子流程版本
+		Path     string         `json:"path"`               // activity 在定义它的工作流中的路径
+		Activity string         `json:"activity"`           // 被补偿的 activity 名称
+		Vars     map[string]any `json:"vars"`               // 补偿动作的参数，包括 compensation.arguments、compensation.responses
+	}
+)
+
+func newCheckpoint(runID string, args map[string]any) *Checkpoint {
+	return &Checkpoint{
+		RunID:      runID,
+		Status:     RunStatusRunning,
+		Arguments:  args,
+		Variables:  args,
+		Statements: make(map[string]map[string]any),
+		Activities: make(map[string]map[string]any),
+	}
+}
+
+// MemoryStateStore 保存在内存中，只在同一个进程中有效，一般用于测试
+type MemoryStateStore struct {
+	runs cmapv2.ConcurrentMap[string, []byte]
+}
+
+// NewMemoryStateStore 新建内存 StateStore
+func NewMemoryStateStore() *MemoryStateStore {
+	return &MemoryStateStore{runs: cmapv2.New[[]byte]()}
+}
+
+func (m *MemoryStateStore) Save(_ context.Context, cp *Checkpoint) error {
+	// 保存序列化后的内容，避免后续执行修改已保存的进度
+	data, err := marshalCheckpoint(cp)
+	if err != nil {
+		return err
+	}
+	m.runs.Set(cp.RunID, data)
+	return nil
+}
+
+func (m *MemoryStateStore) Load(_ context.Context, runID string) (*Checkpoint, error) {
+	data, ok := m.runs.Get(runID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrRunNotFound, runID)
+	}
+	return unmarshalCheckpoint(runID, data)
+}
+
+func (m *MemoryStateStore) Delete(_ context.Context, runID string) error {
+	m.runs.Remove(runID)
+	return nil
+}
+
+// FileStateStore 每次执行保存为目录下的一个 json 文件
+type FileStateStore struct {
+	dir string
+}
+
+// NewFileStateStore 新建文件 StateStore，目录不存在时自动创建
+func NewFileStateStore(dir string) (*FileStateStore, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("state dir is empty")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create state dir %s: %w", dir, err)
+	}
+	return &FileStateStore{dir: dir}, nil
+}
+
+func (f *FileStateStore) fileName(runID string) string {
+	return filepath.Join(f.dir, stateFileBase(runID)+stateFileSuffix)
+}
+
+// stateFileBase 文件名使用编码后的完整 runID，不同的 runID 不会写到同一个文件
+func stateFileBase(runID string) string {
+	name := url.QueryEscape(runID)
+	if len(name) > maxStateFileNameLen || name == "" || name == "." || name == ".." {
+		sum := sha256.Sum256([]byte(runID))
+		return hex.EncodeToString(sum[:])
+	}
+	return name
+}
+
+func (f *FileStateStore) Save(_ context.Context, cp *Checkpoint) error {
+	data, err := marshalCheckpoint(cp)
+	if err != nil {
+		return err
+	}
+	// 先写临时文件再改名，进程中途退出也不会留下写了一半的文件
+	tmp, err := os.CreateTemp(f.dir, stateFileBase(cp.RunID)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("save checkpoint %s: %w", cp.RunID, err)
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("save checkpoint %s: %w", cp.RunID, err)
+	}
+	if err = os.Rename(tmp.Name(), f.fileName(cp.RunID)); err != nil {
+		return fmt.Errorf("save checkpoint %s: %w", cp.RunID, err)
+	}
+	return nil
+}
+
+func (f *FileStateStore) Load(_ context.Context, runID string) (*Checkpoint, error) {
+	data, err := os.ReadFile(f.fileName(runID))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", ErrRunNotFound, runID)
+		}
+		return nil, fmt.Errorf("load checkpoint %s: %w", runID, err)
+	}
+	return unmarshalCheckpoint(runID, data)
+}
+
+func (f *FileStateStore) Delete(_ context.Context, runID string) error {
+	if err := os.Remove(f.fileName(runID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("delete checkpoint %s: %w", runID, err)
+	}
+	return nil
+}
+
+func marshalCheckpoint(cp *Checkpoint) ([]byte, error) {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return nil, fmt.Errorf("marshal checkpoint %s: %w", cp.RunID, err)
+	}
+	return data, nil
+}
+
+func unmarshalCheckpoint(runID string, data []byte) (*Checkpoint, error) {
+	cp := new(Checkpoint)
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("unmarshal checkpoint %s: %w", runID, err)
+	}
+	if cp.RunID != runID {
+		return nil, fmt.Errorf("checkpoint %s belongs to run %s", runID, cp.RunID)
+	}
+	if cp.Statements == nil {
+		cp.Statements = make(map[string]map[string]any)
+	}
+	if cp.Activities == nil {
+		cp.Activities = make(map[string]map[string]any)
+	}
+	return cp, nil
+}
@@ -0,0 +1,76 @@
+package dslflow
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+var (
+	sqlTableNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// SQLiteStateStore 保存在 SQLite 表中，驱动由调用方注册，比如 modernc.org/sqlite 或 github.com/mattn/go-sqlite3
+type SQLiteStateStore struct {
+	db    *sql.DB
+	table string
+}
+
+// NewSQLiteStateStore 新建 SQLite StateStore，表不存在时自动创建，table 为空时使用 dslflow_checkpoint
+func NewSQLiteStateStore(ctx context.Context, db *sql.DB, table string) (*SQLiteStateStore, error) {
+	if db == nil {
+		return nil, fmt.Errorf("db is nil")
+	}
+	if table == "" {
+		table = "dslflow_checkpoint"
+	}
+	if !sqlTableNameRegexp.MatchString(table) {
+		return nil, fmt.Errorf("invalid table name %q", table)
+	}
+	createSql := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	run_id     TEXT PRIMARY KEY,
+	status     TEXT NOT NULL,
+	data       TEXT NOT NULL,
+	updated_at INTEGER NOT NULL
+)`, table)
+	if _, err := db.ExecContext(ctx, createSql); err != nil {
+		return nil, fmt.Errorf("create table %s: %w", table, err)
+	}
+	return &SQLiteStateStore{db: db, table: table}, nil
+}
+
+func (s *SQLiteStateStore) Save(ctx context.Context, cp *Checkpoint) error {
+	data, err := marshalCheckpoint(cp)
+	if err != nil {
+		return err
+	}
+	upsertSql := fmt.Sprintf(`INSERT INTO %s (run_id, status, data, updated_at) VALUES (?, ?, ?, ?)
+ON CONFLICT(run_id) DO UPDATE SET status = excluded.status, data = excluded.data, updated_at = excluded.updated_at`, s.table)
+	if _, err = s.db.ExecContext(ctx, upsertSql, cp.RunID, string(cp.Status), string(data), time.Now().UnixMilli()); err != nil {
+		return fmt.Errorf("save checkpoint %s: %w", cp.RunID, err)
+	}
+	return nil
+}
+
+func (s *SQLiteStateStore) Load(ctx context.Context, runID string) (*Checkpoint, error) {
+	var data string
+	querySql := fmt.Sprintf(`SELECT data FROM %s WHERE run_id = ?`, s.table)
+	if err := s.db.QueryRowContext(ctx, querySql, runID).Scan(&data); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", ErrRunNotFound, runID)
+		}
+		return nil, fmt.Errorf("load checkpoint %s: %w", runID, err)
+	}
+	return unmarshalCheckpoint(runID, []byte(data))
+}
+
+func (s *SQLiteStateStore) Delete(ctx context.Context, runID string) error {
+	deleteSql := fmt.Sprintf(`DELETE FROM %s WHERE run_id = ?`, s.table)
+	if _, err := s.db.ExecContext(ctx, deleteSql, runID); err != nil {
+		return fmt.Errorf("delete checkpoint %s: %w", runID, err)
+	}
+	return nil
+}
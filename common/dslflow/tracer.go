@@ -0,0 +1,77 @@
+package dslflow
+
+import (
+	"context"
+	"github.com/magic-lib/go-plat-utils/conv"
+)
+
+type (
+	// Tracer 创建 span，和 OpenTelemetry 的 trace.Tracer 对应，可以适配到 otel
+	// 执行时的 span 树：workflow → statement → sequence/parallel → statement → activity → attempt → action
+	Tracer interface {
+		// Start 开始一个 span，返回的 context 需要带上新的 span，子 span 以它为父节点
+		Start(ctx context.Context, name string) (context.Context, Span)
+	}
+
+	// Span 一个执行中的 span
+	Span interface {
+		SetAttribute(key string, value any)
+		RecordError(err error)
+		End()
+	}
+
+	nopTracer struct{}
+	nopSpan   struct{}
+
+	tracerKey struct{}
+	spanKey   struct{}
+)
+
+func (nopTracer) Start(ctx context.Context, _ string) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+func (nopSpan) SetAttribute(string, any) {}
+func (nopSpan) RecordError(error)        {}
+func (nopSpan) End()                     {}
+
+// WithTracer 设置本次执行使用的 Tracer，优先于 Workflow.Tracer，子流程使用父流程的 Tracer
+func WithTracer(ctx context.Context, t Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, t)
+}
+
+func getTracer(ctx context.Context) Tracer {
+	if t, ok := ctx.Value(tracerKey{}).(Tracer); ok && t != nil {
+		return t
+	}
+	return nopTracer{}
+}
+
+// startSpan 开始一个 span，attrs 为 key、value 交替
+func startSpan(ctx context.Context, name string, attrs ...any) (context.Context, Span) {
+	tracer := getTracer(ctx)
+	if _, ok := tracer.(nopTracer); ok {
+		return ctx, nopSpan{}
+	}
+	ctx, span := tracer.Start(ctx, name)
+	for i := 0; i+1 < len(attrs); i += 2 {
+		span.SetAttribute(conv.String(attrs[i]), attrs[i+1])
+	}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// currentSpan 当前节点的 span，用来补充执行过程中才知道的属性，比如缓存是否命中
+func currentSpan(ctx context.Context) Span {
+	if span, ok := ctx.Value(spanKey{}).(Span); ok {
+		return span
+	}
+	return nopSpan{}
+}
+
+// endSpan 记录错误并结束 span
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
@@ -0,0 +1,126 @@
+package dslflow
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+type (
+	// RecordedSpan 执行完的 span
+	RecordedSpan struct {
+		TraceID      string         `json:"trace_id"`
+		SpanID       string         `json:"span_id"`
+		ParentSpanID string         `json:"parent_span_id,omitempty"`
+		Name         string         `json:"name"`
+		Attributes   map[string]any `json:"attributes,omitempty"`
+		StartTime    time.Time      `json:"start_time"`
+		EndTime      time.Time      `json:"end_time"`
+		Error        string         `json:"error,omitempty"`
+	}
+
+	// spanRecorder 生成 span，结束时交给 onEnd 处理
+	spanRecorder struct {
+		onEnd func(span *RecordedSpan)
+	}
+
+	recordingSpan struct {
+		mu       sync.Mutex
+		span     *RecordedSpan
+		recorder *spanRecorder
+		ended    bool
+	}
+
+	recordingSpanKey struct{}
+
+	// MemoryTracer 在内存中记录执行完的 span，用于测试和调试
+	MemoryTracer struct {
+		spanRecorder
+		mu    sync.Mutex
+		spans []*RecordedSpan
+	}
+)
+
+// Start 实现 Tracer 接口，context 中已有 span 时作为父节点
+func (r *spanRecorder) Start(ctx context.Context, name string) (context.Context, Span) {
+	span := &RecordedSpan{
+		SpanID:     randomHex(8),
+		Name:       name,
+		Attributes: make(map[string]any),
+		StartTime:  time.Now(),
+	}
+	if parent, ok := ctx.Value(recordingSpanKey{}).(*recordingSpan); ok {
+		span.TraceID = parent.span.TraceID
+		span.ParentSpanID = parent.span.SpanID
+	} else {
+		span.TraceID = randomHex(16)
+	}
+	rs := &recordingSpan{span: span, recorder: r}
+	return context.WithValue(ctx, recordingSpanKey{}, rs), rs
+}
+
+func (s *recordingSpan) SetAttribute(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.span.Attributes[key] = value
+}
+
+func (s *recordingSpan) RecordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.span.Error = err.Error()
+}
+
+// End 只有第一次调用有效
+func (s *recordingSpan) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.span.EndTime = time.Now()
+	snapshot := *s.span
+	snapshot.Attributes = make(map[string]any, len(s.span.Attributes))
+	for k, v := range s.span.Attributes {
+		snapshot.Attributes[k] = v
+	}
+	s.mu.Unlock()
+
+	if s.recorder.onEnd != nil {
+		s.recorder.onEnd(&snapshot)
+	}
+}
+
+// NewMemoryTracer 新建内存 Tracer
+func NewMemoryTracer() *MemoryTracer {
+	t := &MemoryTracer{}
+	t.onEnd = func(span *RecordedSpan) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.spans = append(t.spans, span)
+	}
+	return t
+}
+
+// Spans 按结束顺序返回执行完的 span
+func (t *MemoryTracer) Spans() []*RecordedSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*RecordedSpan{}, t.spans...)
+}
+
+// Reset 清空记录的 span
+func (t *MemoryTracer) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spans = nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
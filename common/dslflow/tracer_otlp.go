@@ -0,0 +1,138 @@
+package dslflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/magic-lib/go-plat-utils/conv"
+	"os"
+	"strconv"
+	"sync"
+)
+
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusCodeError  = 2
+)
+
+type (
+	// OTLPFileExporter 把执行完的 span 按 OTLP/JSON（ExportTraceServiceRequest）格式追加写入文件，每个 span 一行
+	// 文件可以直接由 OpenTelemetry Collector 的 otlpjsonfile receiver 读取
+	OTLPFileExporter struct {
+		spanRecorder
+		mu          sync.Mutex
+		file        *os.File
+		serviceName string
+	}
+
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		Name              string         `json:"name"`
+		Kind              int            `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	otlpKeyValue struct {
+		Key   string         `json:"key"`
+		Value map[string]any `json:"value"`
+	}
+)
+
+// NewOTLPFileExporter 新建 OTLP/JSON 文件导出，文件不存在时创建，已存在时追加
+func NewOTLPFileExporter(path string, serviceName string) (*OTLPFileExporter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open otlp file %s: %w", path, err)
+	}
+	e := &OTLPFileExporter{file: file, serviceName: serviceName}
+	e.onEnd = e.export
+	return e, nil
+}
+
+// Close 关闭文件
+func (e *OTLPFileExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.file.Close()
+}
+
+func (e *OTLPFileExporter) export(span *RecordedSpan) {
+	line, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpKeyValue{otlpAttribute("service.name", e.serviceName)}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "github.com/magic-lib/workflow/common/dslflow"},
+			Spans: []otlpSpan{toOTLPSpan(span)},
+		}},
+	}}})
+	if err != nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, _ = e.file.Write(append(line, '\n'))
+}
+
+func toOTLPSpan(span *RecordedSpan) otlpSpan {
+	s := otlpSpan{
+		TraceID:           span.TraceID,
+		SpanID:            span.SpanID,
+		ParentSpanID:      span.ParentSpanID,
+		Name:              span.Name,
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: strconv.FormatInt(span.StartTime.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.EndTime.UnixNano(), 10),
+	}
+	for k, v := range span.Attributes {
+		s.Attributes = append(s.Attributes, otlpAttribute(k, v))
+	}
+	if span.Error != "" {
+		s.Status = otlpStatus{Code: otlpStatusCodeError, Message: span.Error}
+	}
+	return s
+}
+
+// otlpAttribute OTLP/JSON 的属性值，int64 按规范编码为字符串
+func otlpAttribute(key string, value any) otlpKeyValue {
+	var v map[string]any
+	switch x := value.(type) {
+	case bool:
+		v = map[string]any{"boolValue": x}
+	case int:
+		v = map[string]any{"intValue": strconv.Itoa(x)}
+	case int32:
+		v = map[string]any{"intValue": strconv.FormatInt(int64(x), 10)}
+	case int64:
+		v = map[string]any{"intValue": strconv.FormatInt(x, 10)}
+	case float32:
+		v = map[string]any{"doubleValue": float64(x)}
+	case float64:
+		v = map[string]any{"doubleValue": x}
+	default:
+		v = map[string]any{"stringValue": conv.String(x)}
+	}
+	return otlpKeyValue{Key: key, Value: v}
+}
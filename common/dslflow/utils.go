@@ -14,10 +14,13 @@ import (
 )
 
 const (
-	Variables = "variables" //传入的总变量名
-	Arguments = "arguments"
-	Responses = "responses"
-	Result    = "result" //返回值默认的key
+	Variables    = "variables" //传入的总变量名
+	Arguments    = "arguments"
+	Responses    = "responses"
+	Result       = "result"       //返回值默认的key
+	Hook         = "hook"         //钩子中获取主动作执行信息的key
+	Compensation = "compensation" //补偿动作中获取原始参数和返回的key
+	Attempts     = "attempts"     //activity 每次执行的记录
 )
 
 // 辅助函数：将普通 map 转换为 cmap.ConcurrentMap
@@ -3,19 +3,56 @@ package dslflow
 import (
 	"context"
 	"fmt"
+	"github.com/magic-lib/go-plat-cache/cache"
+	"github.com/magic-lib/go-plat-utils/id-generator/id"
+	"github.com/magic-lib/workflow/common/errorflow"
+	"go.uber.org/multierr"
+	"time"
 )
 
 type (
 	Workflow struct {
-		Variables map[string]any `yaml:"variables" json:"variables,omitempty"` //传入的所有变量参数，包括可以设置某一步的参数
-		Root      Statement      `yaml:"root" json:"root,omitempty"`           //启动的根目录
-		//Activities []*Activity    `yaml:"activities" json:"activities,omitempty"` //公共的activity资源，用于公共执行的部分,比如公共打日志，可以提高使用率
-		Responses map[string]any `yaml:"responses" json:"responses,omitempty"` //请求最终返回的结构
+		Name      string                  `yaml:"name" json:"name,omitempty"`           //工作流名称，cache_scope: workflow 时用来区分缓存
+		Variables map[string]any          `yaml:"variables" json:"variables,omitempty"` //传入的所有变量参数，包括可以设置某一步的参数
+		Root      Statement               `yaml:"root" json:"root,omitempty"`           //启动的根目录
+		Templates map[string]*Activity    `yaml:"templates" json:"templates,omitempty"` //公共的activity模版，activity 中通过 template: name 引用，可以覆盖其中的字段
+		Responses map[string]any          `yaml:"responses" json:"responses,omitempty"` //请求最终返回的结构
+		Store     StateStore              `yaml:"-" json:"-"`                           //保存执行进度，进程重启后可以通过 Resume 继续执行
+		Cache     cache.CommCache[string] `yaml:"-" json:"-"`                           //activity 结果缓存，比如 redis，为空时使用进程内的内存缓存
+		Logger    Logger                  `yaml:"-" json:"-"`                           //执行日志，为空时不输出，也可以通过 WithLogger 为单次执行设置
+		Tracer    Tracer                  `yaml:"-" json:"-"`                           //执行链路追踪，为空时不记录，也可以通过 WithTracer 为单次执行设置
+		Metrics   Metrics                 `yaml:"-" json:"-"`                           //执行指标，为空时不记录，也可以通过 WithMetrics 为单次执行设置
 	}
 )
 
 // Execute 执行工作流主入口
 func (w *Workflow) Execute(ctx context.Context, args map[string]any) (map[string]any, error) {
+	return w.ExecuteRun(ctx, "", args)
+}
+
+// ExecuteRun 指定 runID 执行工作流，配置了 Store 时每个节点执行完都会保存进度，runID 为空时自动生成
+func (w *Workflow) ExecuteRun(ctx context.Context, runID string, args map[string]any) (map[string]any, error) {
+	rs, err := w.newRun(ctx, runID, args)
+	if err != nil {
+		return nil, fmt.Errorf("workflow execute failed: %w", err)
+	}
+	return w.run(ctx, rs)
+}
+
+// Resume 从上次保存的进度继续执行，已经执行完的节点和执行成功的 update 类型 activity 不再重复执行
+func (w *Workflow) Resume(ctx context.Context, runID string) (map[string]any, error) {
+	rs, result, err := w.loadRun(ctx, runID)
+	if err != nil {
+		return nil, fmt.Errorf("workflow resume failed: %w", err)
+	}
+	if rs == nil {
+		return result, nil
+	}
+	return w.run(ctx, rs)
+}
+
+// newRun 初始化一次新的执行
+func (w *Workflow) newRun(ctx context.Context, runID string, args map[string]any) (*runState, error) {
 	// 1. 初始化全局变量和活动资源池
 	globalVars := cloneMap(args)
 	if globalVars == nil {
@@ -26,17 +63,126 @@ func (w *Workflow) Execute(ctx context.Context, args map[string]any) (map[string
 		globalVars = jsonPathReplace(args, w.Variables, overridePolicyFallback)
 	}
 
-	// 2. 执行根节点流程
-	resultVars, err := w.Root.Execute(ctx, globalVars)
+	if runID == "" {
+		runID = id.GetXId()
+	}
+	rs := newRunState(w)
+	rs.runID = runID
+	rs.args = globalVars
+	if w.Store != nil {
+		rs.checkpoint = newCheckpoint(runID, globalVars)
+		rs.cpMu.Lock()
+		err := rs.saveLocked(ctx)
+		rs.cpMu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rs, nil
+}
+
+// loadRun 加载保存的进度，已经执行完成时直接返回结果
+func (w *Workflow) loadRun(ctx context.Context, runID string) (*runState, map[string]any, error) {
+	if w.Store == nil {
+		return nil, nil, fmt.Errorf("state store is not configured")
+	}
+	cp, err := w.Store.Load(ctx, runID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cp.Status == RunStatusCompleted {
+		return nil, cp.Result, nil
+	}
+	if cp.Status == RunStatusCompensated {
+		return nil, nil, fmt.Errorf("run %s has been compensated: %s", runID, cp.Error)
+	}
+	cp.Status = RunStatusRunning
+
+	rs := newRunState(w)
+	rs.runID = runID
+	rs.args = cloneMap(cp.Arguments)
+	rs.checkpoint = cp
+	return rs, nil, nil
+}
+
+func (w *Workflow) run(ctx context.Context, rs *runState) (_ map[string]any, err error) {
+	if _, ok := ctx.Value(tracerKey{}).(Tracer); !ok && w.Tracer != nil {
+		ctx = WithTracer(ctx, w.Tracer)
+	}
+	if _, ok := ctx.Value(metricsKey{}).(Metrics); !ok && w.Metrics != nil {
+		ctx = WithMetrics(ctx, w.Metrics)
+	}
+	if _, ok := ctx.Value(loggerKey{}).(Logger); !ok && w.Logger != nil {
+		ctx = WithLogger(ctx, w.Logger)
+	}
+	ctx, span := startSpan(ctx, "workflow", "workflow.name", w.Name, "run_id", rs.runID)
+	defer func() { endSpan(span, err) }()
+
+	if rs.report == nil {
+		rs.report = newRunReport(ctx, rs)
+	}
+	start, status := time.Now(), RunStatusRunning
+	var exitedResult map[string]any // onexit: exit 返回时的结果
+	defer func() {
+		// 在执行报告记录 exited 之后再等待后台流程，最终状态不会被覆盖
+		if status == RunStatusExited {
+			go rs.waitBackground(context.WithoutCancel(ctx), exitedResult)
+		}
+	}()
+	getMetrics(ctx).RunStarted(ctx, w.Name)
+	defer func() {
+		getMetrics(ctx).RunFinished(ctx, w.Name, status, time.Since(start))
+		rs.report.finish(status, err)
+	}()
+
+	// 2. 执行根节点流程，同一次执行中共享依赖的执行结果
+	if rs.saga == nil {
+		rs.saga = &sagaScope{}
+	}
+	saga := rs.saga
+	rs.restoreCompensations(ctx)
+	ctx = withRunState(ctx, rs)
+	ctx = withSagaScope(ctx, saga)
+	ctx, frame := withStepFrame(ctx)
+	resultVars, err := w.Root.Execute(ctx, rs.args)
 	if err != nil {
-		return nil, fmt.Errorf("workflow execute failed: %w", err)
+		err = fmt.Errorf("workflow execute failed: %w", err)
+		status = RunStatusFailed
+		if !saga.empty() {
+			// 3. 逆序执行已成功 activity 的补偿动作，补偿动作本身不再记录补偿
+			status = RunStatusCompensated
+			failures := saga.compensate(withSagaScope(context.WithoutCancel(ctx), nil))
+			if len(failures) > 0 {
+				err = multierr.Append(err, &errorflow.CompensationError{Failures: failures})
+			}
+			saga.reset()
+		}
+		if saveErr := rs.finish(ctx, status, nil, err); saveErr != nil {
+			logError(ctx, "save checkpoint failed", "error", saveErr)
+		}
+		span.SetAttribute("status", string(status))
+		logInfo(ctx, "workflow finished", "status", status, "error", err)
+		return nil, err
 	}
 
 	if len(w.Responses) > 0 {
-		//映射最终返回结果
-		resultVars = jsonPathReplace(resultVars, w.Responses, overridePolicyForce)
+		//映射最终返回结果，支持模版 {{name}}
+		responses := w.Responses
+		if responsesTemp, err := replaceAllByBindings(w.Responses, resultVars); err == nil {
+			responses = createMap(responsesTemp)
+		}
+		resultVars = jsonPathReplace(resultVars, responses, overridePolicyForce)
 	}
 
+	status = RunStatusCompleted
+	if frame.detached.Load() {
+		status, exitedResult = RunStatusExited, resultVars
+	}
+	if err = rs.finish(ctx, status, resultVars, nil); err != nil {
+		return resultVars, fmt.Errorf("workflow execute failed: %w", err)
+	}
+	span.SetAttribute("status", string(status))
+	logInfo(ctx, "workflow finished", "status", status)
 	return resultVars, nil
 }
 
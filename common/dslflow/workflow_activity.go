@@ -3,11 +3,11 @@ package dslflow
 import (
 	"context"
 	"fmt"
-	"github.com/magic-lib/go-plat-cache/cache"
 	"github.com/magic-lib/go-plat-utils/conv"
-	"github.com/magic-lib/go-plat-utils/crypto"
 	"github.com/magic-lib/go-plat-utils/templates"
 	"github.com/samber/lo"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -18,11 +18,6 @@ const (
 	overridePolicyFallback OverridePolicy = "fallback" // 缺省覆盖
 )
 
-var (
-	activityCacheTime = 5 * time.Minute
-	activityCache     = cache.NewMemGoCache[any](activityCacheTime, 10*time.Minute)
-)
-
 type (
 	ActivityMetadata struct {
 		Namespace    string         `yaml:"namespace" json:"namespace"`
@@ -34,24 +29,38 @@ type (
 
 	// Activity 单个 action 配置
 	Activity struct {
-		ActivityMetadata
-		Id          string            `yaml:"id" json:"id,omitempty"`           // 唯一标识，用于区分多个action
-		Responses   map[string]any    `yaml:"responses" json:"responses"`       // 返回的参数map，可以自定义添加内容，比如命名转换
-		Hooks       LifecycleHooks    `yaml:"hooks" json:"hooks,omitempty"`     // activity执行时的钩子程序
-		Timeout     int               `yaml:"timeout" json:"timeout"`           // 超时设置，单位为秒
-		DependsOn   any               `yaml:"depends_on" json:"depends_on"`     // 依赖的服务
-		Cached      bool              `yaml:"cached" json:"cached"`             // 相同的参数请求在整个流程中可以重复使用结果
-		RetryPolicy RetryPolicyConfig `yaml:"retry_policy" json:"retry_policy"` // 重试策略
+		ActivityMetadata `yaml:",inline"`
+		Id               string            `yaml:"id" json:"id,omitempty"`                   // 唯一标识，用于区分多个action
+		Template         string            `yaml:"template" json:"template,omitempty"`       // 引用的模版名，先找工作流中的 templates，再找全局注册的模版
+		Responses        map[string]any    `yaml:"responses" json:"responses"`               // 返回的参数map，可以自定义添加内容，比如命名转换
+		Hooks            LifecycleHooks    `yaml:"hooks" json:"hooks,omitempty"`             // activity执行时的钩子程序
+		Timeout          int               `yaml:"timeout" json:"timeout,omitempty"`         // 超时设置，单位为秒，yaml 中也可以写成 "30s"
+		DependsOn        any               `yaml:"depends_on" json:"depends_on"`             // 依赖的服务：[]ActivityMetadata 或 Sequence
+		Cached           bool              `yaml:"cached" json:"cached,omitempty"`           // 相同的参数请求可以重复使用结果，范围由 CacheScope 决定
+		CacheScope       CacheScope        `yaml:"cache_scope" json:"cache_scope,omitempty"` // 缓存范围：run/workflow/global，默认 run
+		CacheTTL         time.Duration     `yaml:"cache_ttl" json:"cache_ttl,omitempty"`     // 缓存时间，默认 5m
+		CacheKey         string            `yaml:"cache_key" json:"cache_key,omitempty"`     // 缓存 key 使用的参数，比如 {{order_id}}-{{user.id}}，默认使用全部参数，引用的参数不存在时不缓存
+		RetryPolicy      RetryPolicyConfig `yaml:"retry_policy" json:"retry_policy"`         // 重试策略
+		HookPolicy       HookPolicy        `yaml:"hook_policy" json:"hook_policy,omitempty"` // start 钩子失败时是否中止主动作，默认只打印日志
+		Compensate       *Activity         `yaml:"compensate" json:"compensate,omitempty"`   // 补偿动作，工作流失败时按执行的逆序撤销已经执行成功的 activity
+		Validation       ValidationMode    `yaml:"validation" json:"validation,omitempty"`   // 按 action 声明校验参数和返回：strict/warn/off，默认 off
+
+		explicit map[string]bool // yaml 中写了的字段，retry_policy 下的字段记为 retry_policy.xxx，合并模版时零值也能覆盖
 	}
 
 	RetryPolicyConfig struct {
-		MaximumAttempts int           `yaml:"maximum_attempts" json:"maximum_attempts"` // 最大尝试次数
-		InitialInterval time.Duration `yaml:"initial_interval" json:"initial_interval"` // 初始重试间隔
+		MaximumAttempts    int           `yaml:"maximum_attempts" json:"maximum_attempts,omitempty"`         // 最大重试次数，不包括第一次执行
+		InitialInterval    time.Duration `yaml:"initial_interval" json:"initial_interval,omitempty"`         // 初始重试间隔，默认 50ms
+		MaximumInterval    time.Duration `yaml:"maximum_interval" json:"maximum_interval,omitempty"`         // 最大重试间隔，0 表示不限制
+		BackoffCoefficient float64       `yaml:"backoff_coefficient" json:"backoff_coefficient,omitempty"`   // 每次重试间隔的倍数，默认 2
+		Jitter             float64       `yaml:"jitter" json:"jitter,omitempty"`                             // 重试间隔随机浮动的比例，0~1，比如 0.2 表示 ±20%
+		Deadline           time.Duration `yaml:"deadline" json:"deadline,omitempty"`                         // 从第一次执行开始的重试总时长，超过后不再重试
+		NonRetryableErrors []string      `yaml:"non_retryable_errors" json:"non_retryable_errors,omitempty"` // 不重试的错误类型名（比如 TimeoutError）或者错误码，BusinessError、ValidationError 总是不重试
 	}
 )
 
 // mergeDefaultArguments 合并默认参数到输入参数
-func (ac ActivityMetadata) mergeDefaultArguments(args map[string]any) map[string]any {
+func (ac ActivityMetadata) mergeDefaultArguments(ctx context.Context, args map[string]any) map[string]any {
 	if (len(ac.ArgsForce) == 0 && len(ac.ArgsFallback) == 0) || args == nil {
 		return args
 	}
@@ -65,7 +74,7 @@ func (ac ActivityMetadata) mergeDefaultArguments(args map[string]any) map[string
 			var err error
 			jsonStrTemp, err := jsonPathReplaceOne(jsonStr, k, v, overridePolicyFallback)
 			if err != nil {
-				fmt.Printf("警告：合并参数 key=%s 失败: %v\n", k, err)
+				logWarn(ctx, "merge default argument failed", "key", k, "error", err)
 			} else {
 				jsonStr = jsonStrTemp
 				isModified = true
@@ -78,7 +87,7 @@ func (ac ActivityMetadata) mergeDefaultArguments(args map[string]any) map[string
 			var err error
 			jsonStrTemp, err := jsonPathReplaceOne(jsonStr, k, v, overridePolicyForce)
 			if err != nil {
-				fmt.Printf("警告：合并参数 key=%s 失败: %v\n", k, err)
+				logWarn(ctx, "merge default argument failed", "key", k, "error", err)
 			} else {
 				jsonStr = jsonStrTemp
 				isModified = true
@@ -90,7 +99,7 @@ func (ac ActivityMetadata) mergeDefaultArguments(args map[string]any) map[string
 	if isModified {
 		newArgs := make(map[string]any)
 		if err := conv.Unmarshal(jsonStr, &newArgs); err != nil {
-			fmt.Printf("警告：参数反序列化失败: %v\n", err)
+			logWarn(ctx, "unmarshal merged arguments failed", "error", err)
 		} else {
 			return newArgs
 		}
@@ -99,38 +108,6 @@ func (ac ActivityMetadata) mergeDefaultArguments(args map[string]any) map[string
 	return args
 }
 
-// executeWithRetry 带重试机制执行函数，至少需要执行一次
-func (ac *Activity) executeWithRetry(fn ActionMethod, ctx context.Context, arguments any) (map[string]any, error) {
-	maxAttempts := ac.RetryPolicy.MaximumAttempts //这个是重试的次数
-	if maxAttempts <= 0 {
-		maxAttempts = 0
-	}
-	maxAttempts = maxAttempts + 1 // 最少执行一次
-
-	initialInterval := ac.RetryPolicy.InitialInterval
-	if initialInterval <= 0 {
-		initialInterval = 50 * time.Millisecond
-	}
-
-	var lastErr error
-	for attempt := 1; attempt <= maxAttempts; attempt++ {
-		if retData, err := fn(ctx, arguments); err != nil {
-			lastErr = err
-			if attempt < maxAttempts {
-				// 指数退避重试（间隔翻倍）
-				backoff := initialInterval * time.Duration(1<<(attempt-1))
-				fmt.Printf("动作执行失败（尝试 %d/%d），%v后重试: %v\n", attempt, maxAttempts, backoff, err)
-				time.Sleep(backoff)
-			}
-		} else {
-			//fmt.Printf("action %s, ret: %s", ac.Activity, conv.String(retData))
-
-			return ac.createResponse(arguments, retData), nil // 成功执行
-		}
-	}
-	return nil, lastErr // 返回最后一次错误
-}
-
 // createResponse 生成返回的结果
 func (ac *Activity) createResponse(requestParams any, retData any) map[string]any {
 	resultMap := make(map[string]any)
@@ -160,9 +137,113 @@ func (ac *Activity) createResponse(requestParams any, retData any) map[string]an
 	return resultMap
 }
 
+// writtenKeys activity 执行后写入的变量：action 返回的字段、id 和 responses 中声明的变量，和 createResponse 一致，不包括请求参数
+func (ac *Activity) writtenKeys(retData any) []string {
+	retMap := make(map[string]any)
+	_ = conv.Unmarshal(retData, &retMap)
+	keys := lo.Ternary(len(retMap) > 0, lo.Keys(retMap), []string{getActionKey(ac.Namespace, ac.Activity)})
+	keys = append(keys, ac.Id)
+	for k := range ac.Responses {
+		keys = append(keys, refRoot(k))
+	}
+	return keys
+}
+
+// ownOutputs activity 自己产生的变量：id、action 名称和 responses 中声明的变量
+// 结果中的其他变量是执行时的输入，合并到后面的流程中会覆盖更新的值
+func (ac *Activity) ownOutputs(ctx context.Context, result map[string]any) map[string]any {
+	resolved := ac
+	if ac.Template != "" {
+		var templates map[string]*Activity
+		if rs := getRunState(ctx); rs != nil && rs.workflow != nil {
+			templates = rs.workflow.Templates
+		}
+		if tpl, err := resolveActivityTemplate(ac, templates); err == nil {
+			resolved = tpl
+		}
+	}
+	keys := []string{getActionKey(resolved.Namespace, resolved.Activity)}
+	if resolved.Id != "" {
+		keys = append(keys, resolved.Id)
+	}
+	for k := range resolved.Responses {
+		keys = append(keys, refRoot(k))
+	}
+	return lo.PickByKeys(result, keys)
+}
+
 // Execute 执行动作主逻辑：合并参数→执行依赖→执行主动作→合并结果
-func (ac *Activity) Execute(ctx context.Context, args map[string]any) (map[string]any, error) {
-	inputParams := ac.makeInputMap(args)
+func (ac *Activity) Execute(ctx context.Context, args map[string]any) (_ map[string]any, err error) {
+	ctx, span := startSpan(ctx, "activity", "activity.id", ac.Id)
+	defer func() { endSpan(span, err) }()
+
+	rs := getRunState(ctx)
+	if rs == nil {
+		return ac.execute(ctx, args)
+	}
+
+	// 已经作为其他 activity 的依赖执行过了，不再重复执行，只合并它自己产生的变量
+	if call, ok := rs.takeDependencyResult(ctx, ac); ok {
+		span.SetAttribute("activity.reused", true)
+		if call.err != nil {
+			return args, call.err
+		}
+		outputs := ac.ownOutputs(ctx, call.result)
+		recordWrites(ctx, lo.Keys(outputs)...)
+		return lo.Assign(args, outputs), nil
+	}
+
+	ctx, entry := rs.startActivityEntry(ctx, ac, false)
+	defer func() { entry.finish(err) }()
+
+	// Resume 时已经执行成功的 update 类型 activity 直接使用保存的结果
+	if out, ok := rs.completedActivity(ctx, ac); ok {
+		entry.mark(ReportCached, nil)
+		span.SetAttribute("activity.replayed", true)
+		rs.recordResult(ac, out, nil)
+		recordWrites(ctx, lo.Keys(ac.ownOutputs(ctx, out))...)
+		return out, nil
+	}
+
+	// 依赖执行完后登记为执行中，其他分支依赖它时等待这次执行的结果
+	call := &activityCall{done: make(chan struct{})}
+	var started sync.Once
+	start := func() { started.Do(func() { rs.startCall(ac, call) }) }
+	retData, err := ac.execute(context.WithValue(ctx, activityStartKey{}, start), args)
+	start()
+	call.result, call.err = retData, err
+	close(call.done)
+	if err == nil {
+		if err = rs.saveActivity(ctx, ac, retData); err != nil {
+			return retData, err
+		}
+	}
+	return retData, err
+}
+
+func (ac *Activity) execute(ctx context.Context, args map[string]any) (map[string]any, error) {
+	// 模版展开后是新的 activity，记录补偿动作时使用流程中的路径
+	path, _ := getRunState(ctx).activityPath(ac)
+	ctx = context.WithValue(ctx, activityPathKey{}, path)
+	if ac.Template == "" {
+		return ac.executeResolved(ctx, args)
+	}
+
+	var templates map[string]*Activity
+	if rs := getRunState(ctx); rs != nil && rs.workflow != nil {
+		templates = rs.workflow.Templates
+	}
+	resolved, err := resolveActivityTemplate(ac, templates)
+	if err != nil {
+		return args, err
+	}
+	return resolved.executeResolved(ctx, args)
+}
+
+func (ac *Activity) executeResolved(ctx context.Context, args map[string]any) (map[string]any, error) {
+	ctx = withLogAttrs(ctx, "activity_id", ac.Id, "action", getActionKey(ac.Namespace, ac.Activity))
+	currentSpan(ctx).SetAttribute("action", getActionKey(ac.Namespace, ac.Activity))
+	inputParams := ac.makeInputMap(ctx, args)
 
 	// 0、获取当前活动的所有参数
 	execCtx := ctx
@@ -177,6 +258,9 @@ func (ac *Activity) Execute(ctx context.Context, args map[string]any) (map[strin
 	if err != nil {
 		return inputParams, fmt.Errorf("依赖执行失败: %w", err)
 	}
+	if start, ok := ctx.Value(activityStartKey{}).(func()); ok {
+		start()
+	}
 
 	// 3. 合并生成执行参数
 	var actionParam any = depParams
@@ -186,51 +270,86 @@ func (ac *Activity) Execute(ctx context.Context, args map[string]any) (map[strin
 			return inputParams, fmt.Errorf("参数替换失败: %w", err)
 		}
 	}
+	currentReportEntry(ctx).update(func(e *ReportEntry) { e.Arguments = actionParam })
 
 	// 4. 执行主动作
+	var (
+		rawResult any   // action 原始返回，补偿时使用
+		actionErr error // 最后一次执行 action 返回的错误，钩子中通过 {{hook.error}} 获取
+	)
 	execOneAction := func(ctx context.Context, param any) (any, error) {
-		actionKey := getActionKey(ac.Namespace, ac.Activity)
+		actionErr = nil
 		actIns, err := GetAction(ac.Namespace, ac.Activity)
 		if err != nil {
 			return nil, fmt.Errorf("获取动作实例失败: %w", err)
 		}
 
-		paramKey := ""
-
-		if ac.Cached {
-			//是否有缓存
-			paramKey = crypto.Md5(conv.String(param))
-			actionResult, err := cache.NsGet[any](ctx, activityCache, actionKey, paramKey)
-			if err == nil {
-				return actionResult, nil
+		callAction := func() (any, error) {
+			actionCtx, span := startSpan(ctx, "action", "action", getActionKey(ac.Namespace, ac.Activity), "action.type", actionType(actIns))
+			var actionResult any
+			var execErr error
+			start := time.Now()
+			actionResult, execErr = actIns.ActionExecute(actionCtx, param)
+			getMetrics(ctx).ActionExecuted(ctx, getActionKey(ac.Namespace, ac.Activity), time.Since(start), execErr)
+			endSpan(span, execErr)
+			if execErr != nil {
+				actionErr = execErr
+				return nil, fmt.Errorf("主动作执行失败: %w", execErr)
 			}
+			return actionResult, nil
+		}
+		if err = ac.validateArguments(ctx, actIns.ActionMetadata(), param); err != nil {
+			return nil, err
 		}
 
+		// 缓存 action 的原始返回，命中缓存时和直接执行一样校验返回
 		var actionResult any
-		var execErr error
-		if ac.Hooks != nil {
-			actionResult, execErr = ac.Hooks.Execute(execCtx, actIns, param)
+		if ac.Cached {
+			actionResult, err = ac.cachedCall(ctx, actIns.ActionMetadata(), param, callAction)
 		} else {
-			actionResult, execErr = actIns.ActionExecute(ctx, param)
+			actionResult, err = callAction()
 		}
-
-		if execErr != nil {
-			return nil, fmt.Errorf("主动作执行失败: %w", execErr)
+		if err == nil {
+			actionResult, err = ac.validateResponse(ctx, actIns.ActionMetadata(), actionResult)
 		}
-
-		// 需要缓存该执行对象
-		if ac.Cached && paramKey != "" {
-			_, _ = cache.NsSet[any](ctx, activityCache, actionKey, paramKey, actionResult, activityCacheTime)
+		if err != nil {
+			return nil, err
 		}
+		invalidateCache(ctx, actIns.ActionMetadata())
 
+		rawResult = actionResult
 		return actionResult, nil
 	}
-	retData, err := ac.executeWithRetry(execOneAction, execCtx, actionParam)
+	// 钩子在重试之外执行，重试多次也只触发一次 start 和最终结果的钩子
+	var (
+		retData  map[string]any
+		retryErr error
+	)
+	executeWithRetry := &methodAdapter{method: func(ctx context.Context, param any) (any, error) {
+		if retData, retryErr = ac.executeWithRetry(execOneAction, ctx, param); retryErr != nil {
+			return nil, lo.Ternary(actionErr != nil, actionErr, retryErr)
+		}
+		return rawResult, nil
+	}}
+	if len(ac.Hooks) > 0 {
+		// 钩子的返回不合并到流程变量中
+		_, err = ac.Hooks.Execute(withBranchWrites(execCtx, nil), executeWithRetry, depParams, actionParam, ac.HookPolicy)
+	} else {
+		_, err = executeWithRetry.ActionExecute(execCtx, actionParam)
+	}
+	if retryErr != nil {
+		err = retryErr
+	}
+	currentReportEntry(ctx).update(func(e *ReportEntry) { e.Response = rawResult })
 
 	if err != nil {
 		return depParams, fmt.Errorf("合并结果失败: %w", err)
 	}
 
+	// 5. 记录补偿动作，工作流失败时逆序执行
+	getSagaScope(ctx).add(ctx, ac, depParams, actionParam, rawResult)
+	recordWrites(ctx, ac.writtenKeys(rawResult)...)
+
 	//将所有参数合并进所有的对象中
 	overrideParams := []map[string]any{inputParams, depParams, args, retData}
 	if len(ac.Responses) > 0 {
@@ -260,6 +379,14 @@ func (ac *Activity) Execute(ctx context.Context, args map[string]any) (map[strin
 	return lo.Assign(overrideParams...), nil
 }
 
+// actionType action 声明的类型，没有声明时为空
+func actionType(actIns ActionInterface) string {
+	if meta := actIns.ActionMetadata(); meta != nil {
+		return string(meta.ActionType)
+	}
+	return ""
+}
+
 // exeDependsOn 执行依赖的前置动作并合并结果
 func (ac *Activity) exeDependsOn(ctx context.Context, inputParams map[string]any) (map[string]any, error) {
 	switch depType := ac.DependsOn.(type) {
@@ -276,17 +403,57 @@ func (ac *Activity) exeDependsOn(ctx context.Context, inputParams map[string]any
 	}
 }
 
+// executeDependsByName 按名称执行依赖的 activity，每个依赖在一次执行中只执行一次，结果按顺序合并
 func (ac *Activity) executeDependsByName(ctx context.Context, inputParams map[string]any, deptNames []ActivityMetadata) (map[string]any, error) {
 	if len(deptNames) == 0 {
 		return inputParams, nil
 	}
 
+	rs := getRunState(ctx)
+	if rs == nil {
+		// 单独执行 activity 时没有工作流，只能按 namespace/activity 执行
+		rs = newRunState(nil)
+		ctx = withRunState(ctx, rs)
+	}
+
+	// 当前 activity 加入依赖链，依赖的依赖如果又回到链上的节点，说明有循环
+	chain := append(append([]*Activity{}, getDependsChain(ctx)...), ac)
+	depCtx := withDependsChain(ctx, chain)
+
 	mergedParams := cloneMap(inputParams)
+	for _, dept := range deptNames {
+		depAc := rs.resolveDependency(dept)
+		if lo.Contains(chain, depAc) {
+			return mergedParams, fmt.Errorf("循环依赖: %s", dependsChainString(append(chain, depAc)))
+		}
+		depResult, err := rs.executeDependency(depCtx, depAc, mergedParams)
+		if err != nil {
+			return mergedParams, fmt.Errorf("依赖 %s 执行失败: %w", activityName(depAc), err)
+		}
+		depOutputs := depAc.ownOutputs(ctx, depResult)
+		recordWrites(ctx, lo.Keys(depOutputs)...)
+		mergedParams = lo.Assign(mergedParams, depOutputs)
+	}
 
 	return mergedParams, nil
 }
 
-func (ac *Activity) makeInputMap(arguments map[string]any) map[string]any {
+// activityName 日志和错误中展示的名称，优先使用id
+func activityName(ac *Activity) string {
+	if ac.Id != "" {
+		return ac.Id
+	}
+	return getActionKey(ac.Namespace, ac.Activity)
+}
+
+func dependsChainString(chain []*Activity) string {
+	names := lo.Map(chain, func(ac *Activity, _ int) string {
+		return activityName(ac)
+	})
+	return strings.Join(names, " -> ")
+}
+
+func (ac *Activity) makeInputMap(ctx context.Context, arguments map[string]any) map[string]any {
 	args := cloneMap(arguments)
 
 	//2、将是自己id的参数覆盖进来
@@ -302,7 +469,7 @@ func (ac *Activity) makeInputMap(arguments map[string]any) map[string]any {
 
 	// 本身的参数列表是否包含
 	//3、activity中自定义进行覆盖，主要是将前面流程的参数和返回值加到里面
-	args = ac.mergeDefaultArguments(args)
+	args = ac.mergeDefaultArguments(ctx, args)
 
 	return args
 }
@@ -0,0 +1,55 @@
+package dslflow
+
+import (
+	"context"
+	"github.com/magic-lib/workflow/common/errorflow"
+	"github.com/samber/lo"
+)
+
+type ValidationMode string // activity 执行时按 ActionMetadata 校验输入输出的方式
+
+const (
+	ValidationStrict ValidationMode = "strict" // 校验失败时 activity 失败，返回 ValidationError，不重试
+	ValidationWarn   ValidationMode = "warn"   // 校验失败时只打印日志，继续执行
+	ValidationOff    ValidationMode = "off"    // 不校验，默认方式
+
+	validationStageArguments = "arguments"
+	validationStageResponse  = "response"
+)
+
+var validationModeList = []ValidationMode{ValidationStrict, ValidationWarn, ValidationOff}
+
+func (ac *Activity) validationMode() ValidationMode {
+	return lo.Ternary(ac.Validation != "", ac.Validation, ValidationOff)
+}
+
+// validateArguments 和 ActionMetadata.Execute 一样检查参数类型、schema 和必填参数
+func (ac *Activity) validateArguments(ctx context.Context, meta *ActionMetadata, param any) error {
+	if meta == nil || ac.validationMode() == ValidationOff {
+		return nil
+	}
+	return ac.validationFailed(ctx, meta, validationStageArguments, meta.checkArguments(param))
+}
+
+// validateResponse 检查返回数据，字段配置了 coerce 时返回转换后的数据
+func (ac *Activity) validateResponse(ctx context.Context, meta *ActionMetadata, result any) (any, error) {
+	if meta == nil || ac.validationMode() == ValidationOff {
+		return result, nil
+	}
+	checked, err := meta.checkResponses(result)
+	if err == nil {
+		return checked, nil
+	}
+	return result, ac.validationFailed(ctx, meta, validationStageResponse, err)
+}
+
+func (ac *Activity) validationFailed(ctx context.Context, meta *ActionMetadata, stage string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if ac.validationMode() == ValidationWarn {
+		logWarn(ctx, "action validation failed", "stage", stage, "error", err)
+		return nil
+	}
+	return &errorflow.ValidationError{Action: getActionKey(meta.Namespace, meta.Activity), Stage: stage, Err: err}
+}
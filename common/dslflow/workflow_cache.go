@@ -0,0 +1,231 @@
+package dslflow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/magic-lib/go-plat-cache/cache"
+	"github.com/magic-lib/go-plat-utils/conv"
+	"github.com/magic-lib/go-plat-utils/crypto"
+	"github.com/samber/lo"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+type CacheScope string // activity 结果缓存的范围
+
+const (
+	CacheScopeRun      CacheScope = "run"      // 只在一次执行中复用，默认范围
+	CacheScopeWorkflow CacheScope = "workflow" // 同一个工作流的所有执行之间复用
+	CacheScopeGlobal   CacheScope = "global"   // 所有工作流之间复用
+)
+
+var (
+	cacheScopeList = []CacheScope{CacheScopeRun, CacheScopeWorkflow, CacheScopeGlobal}
+
+	defaultCacheTTL      = 5 * time.Minute
+	cacheTagTTL          = 24 * time.Hour // 标签版本的保存时间，需要比缓存结果的时间长
+	defaultActivityCache = cache.NewMemGoCache[string](defaultCacheTTL, 10*time.Minute)
+
+	cacheCallMu sync.Mutex
+	cacheCalls  = make(map[string]*cacheCall) // 正在执行的缓存 key，相同 key 的并发请求等待同一个结果
+)
+
+type (
+	// cacheCall 一次正在执行的 action 调用
+	cacheCall struct {
+		done   chan struct{}
+		result any
+		err    error
+	}
+
+	// cacheEntry 缓存中保存的内容，后端只保存字符串
+	cacheEntry struct {
+		Result json.RawMessage `json:"result"`
+	}
+)
+
+func (ac *Activity) cacheScope() CacheScope {
+	return lo.Ternary(ac.CacheScope != "", ac.CacheScope, CacheScopeRun)
+}
+
+func (ac *Activity) cacheTTL() time.Duration {
+	return lo.Ternary(ac.CacheTTL > 0, ac.CacheTTL, defaultCacheTTL)
+}
+
+// cacheKey 缓存的 key：范围 + action + 参数和标签版本的 md5，配置了 CacheKey 时只使用其中引用的参数
+// 标签版本变化后 key 随之变化，之前缓存的结果不会再被读到；CacheKey 中的引用在参数中不存在时不缓存
+func (ac *Activity) cacheKey(ctx context.Context, param any, tagVersions string) (string, bool) {
+	keyParam := conv.String(param)
+	if ac.CacheKey != "" {
+		keyArgs, err := replaceAllByBindings(ac.CacheKey, createMap(param))
+		if err != nil {
+			logWarn(ctx, "replace cache_key failed, skip cache", "activity", activityName(ac), "error", err)
+			return "", false
+		}
+		keyParam = conv.String(keyArgs)
+		if refs := templateRefRegexp.FindAllString(keyParam, -1); len(refs) > 0 {
+			logWarn(ctx, "cache_key reference not found in arguments, skip cache", "activity", activityName(ac), "references", refs)
+			return "", false
+		}
+	}
+	if tagVersions != "" {
+		keyParam += "\x00" + tagVersions
+	}
+	actionKey := getActionKey(ac.Namespace, ac.Activity)
+
+	rs := getRunState(ctx)
+	switch ac.cacheScope() {
+	case CacheScopeGlobal:
+		return fmt.Sprintf("dslflow:global:%s:%s", actionKey, crypto.Md5(keyParam)), true
+	case CacheScopeWorkflow:
+		if rs == nil || rs.workflow == nil {
+			return "", false
+		}
+		return fmt.Sprintf("dslflow:workflow:%s:%s:%s", rs.workflow.cacheName(), actionKey, crypto.Md5(keyParam)), true
+	default:
+		if rs == nil {
+			return "", false
+		}
+		return fmt.Sprintf("dslflow:run:%s:%s:%s", rs.runID, actionKey, crypto.Md5(keyParam)), true
+	}
+}
+
+// cacheName 工作流没有配置名称时使用对象地址，只能在当前进程内区分
+func (w *Workflow) cacheName() string {
+	return lo.Ternary(w.Name != "", w.Name, fmt.Sprintf("%p", w))
+}
+
+// activityCache 优先使用工作流配置的缓存，比如 redis，否则使用进程内的内存缓存
+func activityCache(ctx context.Context) cache.CommCache[string] {
+	if rs := getRunState(ctx); rs != nil && rs.workflow != nil && rs.workflow.Cache != nil {
+		return rs.workflow.Cache
+	}
+	return defaultActivityCache
+}
+
+// cacheTags 缓存结果的标签：action 的 namespace 和 CacheTags
+func cacheTags(meta *ActionMetadata) []string {
+	if meta == nil {
+		return nil
+	}
+	return lo.Uniq(append([]string{meta.Namespace}, meta.CacheTags...))
+}
+
+func cacheTagKey(tag string) string {
+	return "dslflow:tag:" + tag
+}
+
+// tagVersions 标签当前的版本，没有失效过的标签为空
+func tagVersions(ctx context.Context, backend cache.CommCache[string], tags []string) string {
+	versions := lo.Map(tags, func(tag string, _ int) string {
+		version, _ := backend.Get(ctx, cacheTagKey(tag))
+		return version
+	})
+	if strings.Join(versions, "") == "" {
+		return ""
+	}
+	return strings.Join(versions, ",")
+}
+
+// invalidateCache update 类型的 action 执行成功后，更新声明的 namespace 或标签的版本，使之前缓存的结果失效
+func invalidateCache(ctx context.Context, meta *ActionMetadata) {
+	if meta == nil || meta.ActionType != ActionTypeUpdate {
+		return
+	}
+	tags := lo.Ternary(len(meta.Invalidates) > 0, meta.Invalidates, []string{meta.Namespace})
+	version := conv.String(time.Now().UnixNano())
+	backend := activityCache(ctx)
+	for _, tag := range lo.Uniq(tags) {
+		if _, err := backend.Set(ctx, cacheTagKey(tag), version, cacheTagTTL); err != nil {
+			logWarn(ctx, "invalidate cache tag failed", "tag", tag, "error", err)
+		}
+	}
+}
+
+// cachedCall 按 cache_scope 缓存 action 的执行结果，相同 key 的并发请求只执行一次，执行失败不缓存
+func (ac *Activity) cachedCall(ctx context.Context, meta *ActionMetadata, param any, fn func() (any, error)) (any, error) {
+	backend := activityCache(ctx)
+	key, ok := ac.cacheKey(ctx, param, tagVersions(ctx, backend, cacheTags(meta)))
+	if !ok {
+		return fn()
+	}
+
+	if str, err := backend.Get(ctx, key); err == nil && str != "" {
+		if result, err := decodeCacheEntry(meta, str); err == nil {
+			currentSpan(ctx).SetAttribute("cache", "hit")
+			getMetrics(ctx).CacheLookup(ctx, activityName(ac), true)
+			currentReportEntry(ctx).mark(ReportCached, nil)
+			return result, nil
+		}
+	}
+
+	cacheCallMu.Lock()
+	if call, ok := cacheCalls[key]; ok {
+		cacheCallMu.Unlock()
+		currentSpan(ctx).SetAttribute("cache", "shared")
+		getMetrics(ctx).CacheLookup(ctx, activityName(ac), true)
+		select {
+		case <-call.done:
+			if call.err == nil {
+				currentReportEntry(ctx).mark(ReportCached, nil)
+			}
+			return call.result, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	call := &cacheCall{done: make(chan struct{})}
+	cacheCalls[key] = call
+	cacheCallMu.Unlock()
+	currentSpan(ctx).SetAttribute("cache", "miss")
+	getMetrics(ctx).CacheLookup(ctx, activityName(ac), false)
+
+	call.result, call.err = fn()
+	if call.err == nil {
+		call.result = ac.storeCacheEntry(ctx, backend, key, meta, call.result)
+	}
+
+	cacheCallMu.Lock()
+	delete(cacheCalls, key)
+	cacheCallMu.Unlock()
+	close(call.done)
+	return call.result, call.err
+}
+
+// storeCacheEntry 保存结果，返回从缓存内容解析出的结果，没有命中缓存时和命中缓存时返回的数据完全一致
+func (ac *Activity) storeCacheEntry(ctx context.Context, backend cache.CommCache[string], key string, meta *ActionMetadata, result any) any {
+	raw, err := json.Marshal(result)
+	if err != nil {
+		logWarn(ctx, "cache action result failed", "error", err)
+		return result
+	}
+	str := conv.String(cacheEntry{Result: raw})
+	if _, err = backend.Set(ctx, key, str, ac.cacheTTL()); err != nil {
+		logWarn(ctx, "cache action result failed", "error", err)
+	}
+	if decoded, err := decodeCacheEntry(meta, str); err == nil {
+		return decoded
+	}
+	return result
+}
+
+// decodeCacheEntry 缓存的结果按 action 的返回类型解析，和直接执行 action 时的类型一致
+func decodeCacheEntry(meta *ActionMetadata, str string) (any, error) {
+	entry := cacheEntry{}
+	if err := json.Unmarshal([]byte(str), &entry); err != nil {
+		return nil, err
+	}
+	if meta == nil || meta.ResponseType == nil || meta.ResponseType.Kind() == reflect.Interface {
+		var result any
+		err := json.Unmarshal(entry.Result, &result)
+		return result, err
+	}
+	result := reflect.New(meta.ResponseType)
+	if err := json.Unmarshal(entry.Result, result.Interface()); err != nil {
+		return nil, err
+	}
+	return result.Elem().Interface(), nil
+}
@@ -0,0 +1,86 @@
+package dslflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/magic-lib/workflow/common/errorflow"
+	"github.com/samber/lo"
+)
+
+type (
+	// ChildWorkflow 调用通过 RegisterWorkflow 注册的子流程
+	ChildWorkflow struct {
+		Name      string         `yaml:"name" json:"name"`                       // 子流程名称
+		Version   string         `yaml:"version" json:"version,omitempty"`       // 子流程版本，为空时使用最后注册的版本
+		Inputs    map[string]any `yaml:"inputs" json:"inputs,omitempty"`         // 子流程的输入参数，支持模版 {{name}}
+		ResultVar string         `yaml:"result_var" json:"result_var,omitempty"` // 子流程的返回放到父流程变量中的 key，默认为子流程名称
+	}
+)
+
+func (cw *ChildWorkflow) resultVar() string {
+	return lo.Ternary(cw.ResultVar != "", cw.ResultVar, cw.Name)
+}
+
+// Execute 执行子流程，父流程取消时子流程也会取消，子流程的返回放到 ResultVar 中
+func (cw *ChildWorkflow) Execute(ctx context.Context, vars map[string]any) (map[string]any, error) {
+	child, err := GetWorkflow(cw.Name, cw.Version)
+	if err != nil {
+		return vars, err
+	}
+
+	inputs := make(map[string]any)
+	if len(cw.Inputs) > 0 {
+		inputsTemp, err := replaceAllByBindings(cw.Inputs, vars)
+		if err != nil {
+			return vars, fmt.Errorf("子流程参数替换失败: %w", err)
+		}
+		inputs = createMap(inputsTemp)
+	}
+
+	rs, result, err := cw.startRun(ctx, child, inputs)
+	if err != nil {
+		return vars, err
+	}
+	if rs != nil {
+		rs.saga = getSagaScope(ctx).addChild()
+		result, err = child.run(newChildContext(ctx), rs)
+		if rs.report != nil {
+			currentReportEntry(ctx).update(func(e *ReportEntry) { e.Child = rs.report })
+		}
+		if err != nil {
+			return vars, &errorflow.ChildWorkflowError{
+				Workflow: getWorkflowKey(cw.Name, cw.Version),
+				RunID:    rs.runID,
+				Path:     failedPath(err),
+				Err:      err,
+			}
+		}
+		getRunState(ctx).recordChildCompensations(ctx, cw, rs)
+	}
+	recordWrites(ctx, cw.resultVar())
+	return lo.Assign(vars, map[string]any{cw.resultVar(): result}), nil
+}
+
+// startRun 父流程有 runID 时，子流程使用固定的 runID：父流程 runID#节点路径，父流程 Resume 时子流程也从保存的进度继续执行
+func (cw *ChildWorkflow) startRun(ctx context.Context, child *Workflow, inputs map[string]any) (*runState, map[string]any, error) {
+	runID := ""
+	if parent := getRunState(ctx); parent != nil && parent.runID != "" {
+		if path, ok := parent.childPaths[cw]; ok {
+			runID = childRunID(parent.runID, path+loopIteration(ctx))
+		}
+	}
+	if runID != "" && child.Store != nil {
+		rs, result, err := child.loadRun(ctx, runID)
+		if err == nil || !errors.Is(err, ErrRunNotFound) {
+			return rs, result, err
+		}
+	}
+	rs, err := child.newRun(ctx, runID, inputs)
+	return rs, nil, err
+}
+
+// childRunID 不使用 /，避免 runID 被当成路径
+func childRunID(parentRunID string, path string) string {
+	return parentRunID + childRunIDSeparator + path
+}
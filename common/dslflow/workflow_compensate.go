@@ -0,0 +1,259 @@
+package dslflow
+
+import (
+	"context"
+	"fmt"
+	"github.com/magic-lib/workflow/common/errorflow"
+	"github.com/samber/lo"
+	"sync"
+)
+
+type (
+	sagaScopeKey struct{}
+
+	// sagaScope 记录执行成功并且配置了补偿动作的 activity，并行节点的每个分支单独一个 scope
+	sagaScope struct {
+		mu      sync.Mutex
+		entries []*sagaEntry
+	}
+
+	// sagaEntry 一个补偿动作，或者一个并行节点的所有分支
+	sagaEntry struct {
+		name       string              // 被补偿的 activity 名称
+		compensate *Activity           // 补偿动作
+		vars       map[string]any      // 补偿动作的参数
+		rs         *runState           // 定义 activity 的那次执行，子流程的补偿动作在子流程中执行
+		record     *CompensationRecord // 保存到进度中的记录
+		branches   []*sagaScope        // 并行节点的分支
+	}
+)
+
+func withSagaScope(ctx context.Context, scope *sagaScope) context.Context {
+	return context.WithValue(ctx, sagaScopeKey{}, scope)
+}
+
+func getSagaScope(ctx context.Context) *sagaScope {
+	if scope, ok := ctx.Value(sagaScopeKey{}).(*sagaScope); ok {
+		return scope
+	}
+	return nil
+}
+
+// add 记录执行成功的 activity 的补偿动作，补偿时可以通过 {{compensation.arguments}}、{{compensation.responses}} 获取原始参数和返回
+func (s *sagaScope) add(ctx context.Context, ac *Activity, vars map[string]any, param any, result any) {
+	if s == nil || ac.Compensate == nil {
+		return
+	}
+	compensationInfo := map[string]any{
+		Arguments: param,
+		Responses: result,
+	}
+	for _, k := range []string{Arguments, Responses} {
+		if m := createMap(compensationInfo[k]); len(m) > 0 {
+			compensationInfo[k] = m
+		}
+	}
+
+	rs := getRunState(ctx)
+	path, _ := ctx.Value(activityPathKey{}).(string)
+	record := &CompensationRecord{
+		Path:     path,
+		Activity: activityName(ac),
+		Vars:     lo.Assign(vars, map[string]any{Compensation: compensationInfo}),
+	}
+	if path != "" {
+		record.Key = path + loopIteration(ctx)
+	}
+	// Resume 时已经恢复了这个 activity 的补偿动作
+	if !rs.recordCompensation(record) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, &sagaEntry{
+		name:       record.Activity,
+		compensate: ac.Compensate,
+		vars:       record.Vars,
+		rs:         rs,
+		record:     record,
+	})
+}
+
+// addChild 子流程的补偿动作挂在父流程中，子流程执行成功后父流程失败时一起补偿
+func (s *sagaScope) addChild() *sagaScope {
+	return s.addParallel(1)[0]
+}
+
+// addParallel 并行节点开始执行时占位，保证和前后节点的补偿顺序
+func (s *sagaScope) addParallel(n int) []*sagaScope {
+	branches := make([]*sagaScope, n)
+	for i := range branches {
+		branches[i] = &sagaScope{}
+	}
+	if s == nil {
+		return branches
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, &sagaEntry{branches: branches})
+	return branches
+}
+
+// reset 已经补偿完，子流程失败时自己补偿，父流程不再重复补偿
+func (s *sagaScope) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = nil
+}
+
+// records 按执行顺序返回所有补偿动作的记录，包括并行分支和子流程中的
+func (s *sagaScope) records() []*CompensationRecord {
+	s.mu.Lock()
+	entries := append([]*sagaEntry{}, s.entries...)
+	s.mu.Unlock()
+
+	records := make([]*CompensationRecord, 0)
+	for _, entry := range entries {
+		if entry.record != nil {
+			records = append(records, entry.record)
+		}
+		for _, branch := range entry.branches {
+			records = append(records, branch.records()...)
+		}
+	}
+	return records
+}
+
+// empty 没有需要执行的补偿动作
+func (s *sagaScope) empty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range s.entries {
+		if entry.compensate != nil {
+			return false
+		}
+		for _, branch := range entry.branches {
+			if !branch.empty() {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// compensate 逆序执行补偿动作，并行节点的分支同时补偿，某个补偿失败不影响其他补偿
+func (s *sagaScope) compensate(ctx context.Context) []*errorflow.CompensationFailure {
+	s.mu.Lock()
+	entries := append([]*sagaEntry{}, s.entries...)
+	s.mu.Unlock()
+
+	failures := make([]*errorflow.CompensationFailure, 0)
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if entry.compensate != nil {
+			compensateCtx := ctx
+			if entry.rs != nil {
+				compensateCtx = withRunState(ctx, entry.rs)
+			}
+			if _, err := entry.compensate.Execute(compensateCtx, entry.vars); err != nil {
+				logWarn(ctx, "compensation failed", "compensated", entry.name, "error", err)
+				failures = append(failures, &errorflow.CompensationFailure{Activity: entry.name, Err: err})
+			}
+			continue
+		}
+
+		var (
+			wg sync.WaitGroup
+			mu sync.Mutex
+		)
+		for _, branch := range entry.branches {
+			wg.Add(1)
+			go func(branch *sagaScope) {
+				defer wg.Done()
+				branchFailures := branch.compensate(ctx)
+				mu.Lock()
+				failures = append(failures, branchFailures...)
+				mu.Unlock()
+			}(branch)
+		}
+		wg.Wait()
+	}
+	return failures
+}
+
+// recordCompensation 补偿动作保存到进度中，Resume 后工作流失败时仍然可以补偿，已经保存过时返回 false
+func (rs *runState) recordCompensation(record *CompensationRecord) bool {
+	if rs == nil || rs.checkpoint == nil || record.Key == "" {
+		return true
+	}
+	rs.cpMu.Lock()
+	defer rs.cpMu.Unlock()
+	if lo.ContainsBy(rs.checkpoint.Compensations, func(r *CompensationRecord) bool { return r.Key == record.Key }) {
+		return false
+	}
+	rs.checkpoint.Compensations = append(rs.checkpoint.Compensations, record)
+	return true
+}
+
+// recordChildCompensations 子流程执行成功后，它的补偿动作也保存到父流程的进度中，父流程 Resume 时不一定再执行子流程
+func (rs *runState) recordChildCompensations(ctx context.Context, cw *ChildWorkflow, child *runState) {
+	if rs == nil || rs.checkpoint == nil || child.saga == nil {
+		return
+	}
+	path, ok := rs.childPaths[cw]
+	if !ok {
+		return
+	}
+	prefix := path + loopIteration(ctx) + childRunIDSeparator
+	for _, record := range child.saga.records() {
+		if record.Key == "" {
+			continue
+		}
+		copied := *record
+		copied.Key = prefix + record.Key
+		if copied.Workflow == "" {
+			copied.Workflow, copied.Version = cw.Name, cw.Version
+		}
+		rs.recordCompensation(&copied)
+	}
+}
+
+// restoreCompensations Resume 时恢复保存的补偿动作，放在本次执行的补偿动作之前
+func (rs *runState) restoreCompensations(ctx context.Context) {
+	if rs.checkpoint == nil {
+		return
+	}
+	rs.cpMu.Lock()
+	records := append([]*CompensationRecord{}, rs.checkpoint.Compensations...)
+	rs.cpMu.Unlock()
+
+	entries := make([]*sagaEntry, 0, len(records))
+	for _, record := range records {
+		owner := rs
+		if record.Workflow != "" {
+			w, err := GetWorkflow(record.Workflow, record.Version)
+			if err != nil {
+				logWarn(ctx, "restore compensation failed", "compensated", record.Activity, "error", err)
+				continue
+			}
+			owner = newRunState(w)
+		}
+		ac, ok := lo.FindKeyBy(owner.acPaths, func(_ *Activity, path string) bool { return path == record.Path })
+		if !ok || ac.Compensate == nil {
+			logWarn(ctx, "restore compensation failed", "compensated", record.Activity, "error", fmt.Sprintf("activity %s not found", record.Path))
+			continue
+		}
+		entries = append(entries, &sagaEntry{
+			name:       record.Activity,
+			compensate: ac.Compensate,
+			vars:       record.Vars,
+			rs:         owner,
+			record:     record,
+		})
+	}
+
+	rs.saga.mu.Lock()
+	defer rs.saga.mu.Unlock()
+	rs.saga.entries = append(entries, rs.saga.entries...)
+}
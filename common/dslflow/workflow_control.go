@@ -30,9 +30,19 @@ type (
 )
 
 const (
-	activity OrderType = "activity"
-	sequence OrderType = "sequence"
-	parallel OrderType = "parallel"
+	activity    OrderType = "activity"
+	sequence    OrderType = "sequence"
+	parallel    OrderType = "parallel"
+	foreach     OrderType = "foreach"
+	switcher    OrderType = "switch"
+	loop        OrderType = "loop"
+	subWorkflow OrderType = "workflow"
+)
+
+var (
+	orderTypeList   = []OrderType{activity, sequence, parallel, foreach, switcher, loop, subWorkflow}
+	onErrorTypeList = []OnErrorType{OnErrorIgnore}
+	onExitTypeList  = []OnExitType{OnExitExit}
 )
 
 // 检查控制条件是否满足（简化实现，实际可集成表达式引擎）
@@ -46,11 +56,16 @@ func (c *Control) checkControlCondition(ctx context.Context, vars map[string]any
 		return false, fmt.Errorf("执行依赖失败: %w", err)
 	}
 
+	return evalCondition(ctx, c.When, retAllMap, vars)
+}
+
+// evalCondition 替换条件中的模版变量后用规则引擎计算，结果必须是 bool
+func evalCondition(ctx context.Context, when string, bindings map[string]any, vars map[string]any) (bool, error) {
 	//首先替换掉变量
-	tmp := templates.NewTemplate(c.When)
-	allParamWhen := tmp.Replace(retAllMap)
+	tmp := templates.NewTemplate(when)
+	allParamWhen := tmp.Replace(bindings)
 
-	fmt.Println("checkControlCondition:", allParamWhen)
+	logDebug(ctx, "evaluate condition", "when", when, "expression", allParamWhen)
 
 	ruleEngine := ruleengine.NewEngineLogic()
 	retCheck, err := ruleEngine.RunString(allParamWhen, vars)
@@ -91,9 +106,13 @@ func (c *Control) executeDependsOn(ctx context.Context, vars map[string]any) (ma
 func (c *Control) resolveExecutionOrder(stmt *Statement) []OrderType {
 	// 1. 定义所有可能的元素及其默认优先级（数字越小优先级越高）
 	defaultOrder := map[OrderType]int{
-		activity: 1,
-		sequence: 2,
-		parallel: 3,
+		activity:    1,
+		sequence:    2,
+		parallel:    3,
+		foreach:     4,
+		switcher:    5,
+		loop:        6,
+		subWorkflow: 7,
 	}
 
 	// 2. 处理用户配置的 ExecutionOrder，覆盖默认优先级
@@ -118,6 +137,18 @@ func (c *Control) resolveExecutionOrder(stmt *Statement) []OrderType {
 	if len(stmt.Parallel) > 0 {
 		availableItems = append(availableItems, parallel)
 	}
+	if stmt.ForEach != nil {
+		availableItems = append(availableItems, foreach)
+	}
+	if stmt.Switch != nil {
+		availableItems = append(availableItems, switcher)
+	}
+	if stmt.Loop != nil {
+		availableItems = append(availableItems, loop)
+	}
+	if stmt.Workflow != nil {
+		availableItems = append(availableItems, subWorkflow)
+	}
 
 	// 4. 找到优先级最高的字段（优先级数值最小）
 	if len(availableItems) == 0 {
@@ -0,0 +1,219 @@
+package dslflow
+
+import (
+	"context"
+	"fmt"
+	"github.com/magic-lib/go-plat-utils/conv"
+	"github.com/magic-lib/go-plat-utils/goroutines"
+	"github.com/samber/lo"
+	"github.com/tidwall/gjson"
+	"go.uber.org/multierr"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultForEachItemVar   = "item"
+	defaultForEachIndexVar  = "index"
+	defaultForEachResultVar = "results"
+)
+
+var (
+	refIndexRegexp = regexp.MustCompile(`\[(\d+)]`)
+)
+
+type (
+	// ForEach 遍历集合，对每个元素执行一次子节点
+	ForEach struct {
+		Items          string     `yaml:"items" json:"items"`                               // 遍历的集合，比如 {{clusters}}
+		ItemVar        string     `yaml:"item_var" json:"item_var,omitempty"`               // 子节点中当前元素的变量名，默认 item
+		IndexVar       string     `yaml:"index_var" json:"index_var,omitempty"`             // 子节点中当前下标的变量名，默认 index
+		ResultVar      string     `yaml:"result_var" json:"result_var,omitempty"`           // 每个元素的执行结果按顺序收集到该数组变量中，默认 results
+		Parallel       bool       `yaml:"parallel" json:"parallel,omitempty"`               // 是否并发执行
+		MaxConcurrency int        `yaml:"max_concurrency" json:"max_concurrency,omitempty"` // 并发执行时的最大并发数，0 表示不限制
+		Do             *Statement `yaml:"do" json:"do"`                                     // 每个元素执行的子节点
+	}
+
+	loopIterationKey struct{}
+)
+
+func (fe *ForEach) itemVar() string {
+	return lo.Ternary(fe.ItemVar != "", fe.ItemVar, defaultForEachItemVar)
+}
+
+func (fe *ForEach) indexVar() string {
+	return lo.Ternary(fe.IndexVar != "", fe.IndexVar, defaultForEachIndexVar)
+}
+
+func (fe *ForEach) resultVar() string {
+	return lo.Ternary(fe.ResultVar != "", fe.ResultVar, defaultForEachResultVar)
+}
+
+// Execute 对集合中的每个元素执行子节点，每个元素新增或修改的变量按下标收集到 ResultVar 中
+func (fe *ForEach) Execute(ctx context.Context, vars map[string]any) (map[string]any, error) {
+	if fe.Do == nil {
+		return vars, fmt.Errorf("foreach do is empty")
+	}
+	items, err := fe.resolveItems(vars)
+	if err != nil {
+		return vars, err
+	}
+
+	results := make([]any, len(items))
+	var multiErr error
+	// 只有 result_var 合并到流程变量中
+	recordWrites(ctx, fe.resultVar())
+	ctx = withBranchWrites(ctx, nil)
+	if fe.Parallel {
+		multiErr = fe.executeParallel(ctx, vars, items, results)
+	} else {
+		for i, item := range items {
+			if ctx.Err() != nil {
+				return vars, ctx.Err()
+			}
+			res, err := fe.executeItem(ctx, vars, i, item)
+			if err != nil {
+				if fe.Do.Control.shouldIgnoreOnError() {
+					continue
+				}
+				multiErr = multierr.Append(multiErr, fmt.Errorf("foreach item %d error: %w", i, err))
+				break
+			}
+			results[i] = res
+		}
+	}
+
+	return lo.Assign(vars, map[string]any{fe.resultVar(): results}), multiErr
+}
+
+// executeParallel 并发执行，某个元素失败时取消其他元素的执行
+func (fe *ForEach) executeParallel(ctx context.Context, vars map[string]any, items []any, results []any) error {
+	sonCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	limit := fe.MaxConcurrency
+	if limit <= 0 || limit > len(items) {
+		limit = len(items)
+	}
+	sem := make(chan struct{}, limit)
+
+	// 每个元素单独记录补偿动作，补偿时同时执行
+	branchScopes := getSagaScope(ctx).addParallel(len(items))
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		multiErr error
+	)
+	for i, item := range items {
+		sem <- struct{}{}
+		wg.Add(1)
+		goroutines.GoAsync(func(params ...any) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			currCtx := params[0].(context.Context)
+			currIndex := params[1].(int)
+			if sonCtx.Err() != nil {
+				mu.Lock()
+				multiErr = multierr.Append(multiErr, fmt.Errorf("foreach item %d error: %w", currIndex, sonCtx.Err()))
+				mu.Unlock()
+				return
+			}
+
+			res, err := fe.executeItem(currCtx, vars, currIndex, params[2])
+			if err != nil {
+				if fe.Do.Control.shouldIgnoreOnError() {
+					return
+				}
+				cancel()
+				mu.Lock()
+				multiErr = multierr.Append(multiErr, fmt.Errorf("foreach item %d error: %w", currIndex, err))
+				mu.Unlock()
+				return
+			}
+			results[currIndex] = res
+		}, withSagaScope(sonCtx, branchScopes[i]), i, item)
+	}
+	wg.Wait()
+	return multiErr
+}
+
+// executeItem 执行单个元素，返回子节点新增或修改的变量
+func (fe *ForEach) executeItem(ctx context.Context, vars map[string]any, index int, item any) (map[string]any, error) {
+	itemVars := cloneMap(vars)
+	itemVars[fe.itemVar()] = item
+	itemVars[fe.indexVar()] = index
+
+	out, err := fe.Do.Execute(withLoopIteration(ctx, index), itemVars)
+	if err != nil {
+		return nil, err
+	}
+	res := changedVars(itemVars, out)
+	delete(res, fe.itemVar())
+	delete(res, fe.indexVar())
+	return res, nil
+}
+
+// resolveItems 获取需要遍历的集合，支持变量引用 {{clusters}} 或者 json 数组
+func (fe *ForEach) resolveItems(vars map[string]any) ([]any, error) {
+	itemsStr := strings.TrimSpace(fe.Items)
+	if m := templateRefRegexp.FindStringSubmatch(itemsStr); m != nil && m[0] == itemsStr {
+		val, ok := lookupVar(vars, m[1])
+		if !ok {
+			return nil, fmt.Errorf("foreach items %s not found", fe.Items)
+		}
+		return toItemList(fe.Items, val)
+	}
+	if itemsStr == "" {
+		return nil, fmt.Errorf("foreach items is empty")
+	}
+	return toItemList(fe.Items, itemsStr)
+}
+
+func toItemList(name string, val any) ([]any, error) {
+	if val == nil {
+		return []any{}, nil
+	}
+	list := make([]any, 0)
+	if err := conv.Unmarshal(conv.String(val), &list); err != nil {
+		return nil, fmt.Errorf("foreach items %s is not an array: %s", name, conv.String(val))
+	}
+	return list, nil
+}
+
+// lookupVar 按路径获取变量，比如 .clusters、cluster.nodes[0].name
+func lookupVar(vars map[string]any, ref string) (any, bool) {
+	ref = strings.TrimPrefix(strings.TrimSpace(ref), ".")
+	ref = refIndexRegexp.ReplaceAllString(ref, ".$1")
+	ret := gjson.Get(conv.String(vars), ref)
+	if !ret.Exists() {
+		return nil, false
+	}
+	return ret.Value(), true
+}
+
+// changedVars 子节点执行后新增或修改的变量
+func changedVars(before map[string]any, after map[string]any) map[string]any {
+	changed := make(map[string]any)
+	for k, v := range after {
+		if old, ok := before[k]; ok && conv.String(old) == conv.String(v) {
+			continue
+		}
+		changed[k] = v
+	}
+	return changed
+}
+
+// withLoopIteration 循环中同一个节点会执行多次，保存进度时用下标区分
+func withLoopIteration(ctx context.Context, index int) context.Context {
+	return context.WithValue(ctx, loopIterationKey{}, fmt.Sprintf("%s[%d]", loopIteration(ctx), index))
+}
+
+func loopIteration(ctx context.Context) string {
+	if iteration, ok := ctx.Value(loopIterationKey{}).(string); ok {
+		return iteration
+	}
+	return ""
+}
@@ -0,0 +1,457 @@
+package dslflow
+
+import (
+	"fmt"
+	"github.com/samber/lo"
+	"regexp"
+	"strings"
+)
+
+const (
+	shapeTerminal nodeShape = iota // 开始、结束
+	shapeActivity
+	shapeDecision // when、switch
+	shapeFork     // parallel 的分支和汇合
+	shapeLoop     // foreach、loop
+	shapeWorkflow // 子流程
+)
+
+const (
+	edgeFlow       edgeStyle = iota // 执行顺序
+	edgeHook                        // 钩子、补偿
+	edgeDependency                  // depends_on
+)
+
+type (
+	nodeShape int
+	edgeStyle int
+
+	graphNode struct {
+		id     string
+		label  string
+		shape  nodeShape
+		status ReportStatus // 有执行报告时的执行结果
+	}
+
+	graphEdge struct {
+		from, to string
+		label    string
+		style    edgeStyle
+	}
+
+	// exitPoint 子图执行完后连到下一个节点的出口，比如 when 不满足时的 false 分支
+	exitPoint struct {
+		node  string
+		label string
+	}
+
+	pendingDependency struct {
+		node string
+		deps []ActivityMetadata
+	}
+
+	// workflowGraph 把流程转换成节点和边，再输出为 DOT 或 Mermaid
+	workflowGraph struct {
+		rs       *runState
+		report   *RunReport
+		nodes    []*graphNode
+		edges    []*graphEdge
+		acNodes  map[*Activity]string
+		deps     []pendingDependency
+		workflow string
+	}
+)
+
+// statusColors 执行报告中各状态的填充色和边框色
+var statusColors = map[ReportStatus][2]string{
+	ReportSucceeded: {"#c8e6c9", "#2e7d32"},
+	ReportFailed:    {"#ffcdd2", "#c62828"},
+	ReportSkipped:   {"#eeeeee", "#9e9e9e"},
+	ReportIgnored:   {"#ffe0b2", "#ef6c00"},
+	ReportCached:    {"#bbdefb", "#1565c0"},
+}
+
+// iterationSuffix 循环中的路径会带上下标，比如 root.foreach.do.activity[0]
+var iterationSuffix = regexp.MustCompile(`^(\[\d+\])+$`)
+
+// ToDOT 输出 Graphviz DOT 格式的流程图，report 不为空时按该次执行的结果给 activity 着色
+func (w *Workflow) ToDOT(report *RunReport) string {
+	g := newWorkflowGraph(w, report)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "digraph %s {\n", dotQuote(g.workflow))
+	sb.WriteString("  rankdir=TB;\n  node [fontname=\"Helvetica\"];\n  edge [fontname=\"Helvetica\"];\n")
+	for _, n := range g.nodes {
+		attrs := []string{"label=" + dotQuote(n.label)}
+		styles := make([]string, 0, 2)
+		switch n.shape {
+		case shapeTerminal:
+			attrs = append(attrs, "shape=oval")
+		case shapeActivity:
+			attrs = append(attrs, "shape=box")
+			styles = append(styles, "rounded")
+		case shapeDecision:
+			attrs = append(attrs, "shape=diamond")
+		case shapeFork:
+			attrs = append(attrs, "shape=circle")
+		case shapeLoop:
+			attrs = append(attrs, "shape=hexagon")
+		case shapeWorkflow:
+			attrs = append(attrs, "shape=component")
+		}
+		if colors, ok := statusColors[n.status]; ok {
+			styles = append(styles, "filled")
+			attrs = append(attrs, "fillcolor="+dotQuote(colors[0]), "color="+dotQuote(colors[1]))
+		}
+		if len(styles) > 0 {
+			attrs = append(attrs, "style="+dotQuote(strings.Join(styles, ",")))
+		}
+		fmt.Fprintf(&sb, "  %s [%s];\n", n.id, strings.Join(attrs, ", "))
+	}
+	for _, e := range g.edges {
+		attrs := make([]string, 0, 2)
+		if e.label != "" {
+			attrs = append(attrs, "label="+dotQuote(e.label))
+		}
+		switch e.style {
+		case edgeHook:
+			attrs = append(attrs, "style=dashed")
+		case edgeDependency:
+			attrs = append(attrs, "style=dotted")
+		}
+		if len(attrs) > 0 {
+			fmt.Fprintf(&sb, "  %s -> %s [%s];\n", e.from, e.to, strings.Join(attrs, ", "))
+		} else {
+			fmt.Fprintf(&sb, "  %s -> %s;\n", e.from, e.to)
+		}
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// ToMermaid 输出 Mermaid flowchart，report 不为空时按该次执行的结果给 activity 着色
+func (w *Workflow) ToMermaid(report *RunReport) string {
+	g := newWorkflowGraph(w, report)
+	var sb strings.Builder
+	sb.WriteString("flowchart TD\n")
+	classes := make(map[ReportStatus][]string)
+	for _, n := range g.nodes {
+		label := mermaidQuote(n.label)
+		switch n.shape {
+		case shapeTerminal:
+			fmt.Fprintf(&sb, "  %s([%s])\n", n.id, label)
+		case shapeDecision:
+			fmt.Fprintf(&sb, "  %s{%s}\n", n.id, label)
+		case shapeFork:
+			fmt.Fprintf(&sb, "  %s((%s))\n", n.id, label)
+		case shapeLoop:
+			fmt.Fprintf(&sb, "  %s{{%s}}\n", n.id, label)
+		case shapeWorkflow:
+			fmt.Fprintf(&sb, "  %s[[%s]]\n", n.id, label)
+		default:
+			fmt.Fprintf(&sb, "  %s[%s]\n", n.id, label)
+		}
+		if n.status != "" {
+			classes[n.status] = append(classes[n.status], n.id)
+		}
+	}
+	for _, e := range g.edges {
+		arrow := "-->"
+		if e.style != edgeFlow {
+			arrow = "-.->"
+		}
+		if e.label != "" {
+			fmt.Fprintf(&sb, "  %s %s|%s| %s\n", e.from, arrow, mermaidQuote(e.label), e.to)
+		} else {
+			fmt.Fprintf(&sb, "  %s %s %s\n", e.from, arrow, e.to)
+		}
+	}
+	for _, status := range []ReportStatus{ReportSucceeded, ReportFailed, ReportSkipped, ReportIgnored, ReportCached} {
+		if len(classes[status]) == 0 {
+			continue
+		}
+		colors := statusColors[status]
+		fmt.Fprintf(&sb, "  classDef %s fill:%s,stroke:%s\n", status, colors[0], colors[1])
+		fmt.Fprintf(&sb, "  class %s %s\n", strings.Join(classes[status], ","), status)
+	}
+	return sb.String()
+}
+
+func newWorkflowGraph(w *Workflow, report *RunReport) *workflowGraph {
+	g := &workflowGraph{
+		rs:       newRunState(w),
+		report:   report,
+		acNodes:  make(map[*Activity]string),
+		workflow: w.Name,
+	}
+	if g.workflow == "" {
+		g.workflow = "workflow"
+	}
+	start := g.node("start", shapeTerminal)
+	entry, exits := g.statement("root", &w.Root)
+	end := g.node("end", shapeTerminal)
+	if entry == "" {
+		g.edge(start, end, "", edgeFlow)
+	} else {
+		g.edge(start, entry, "", edgeFlow)
+		g.link(exits, end, "")
+	}
+	g.resolveDependencies()
+	return g
+}
+
+func (g *workflowGraph) node(label string, shape nodeShape) string {
+	n := &graphNode{id: fmt.Sprintf("n%d", len(g.nodes)), label: label, shape: shape}
+	g.nodes = append(g.nodes, n)
+	return n.id
+}
+
+func (g *workflowGraph) edge(from, to, label string, style edgeStyle) {
+	g.edges = append(g.edges, &graphEdge{from: from, to: to, label: label, style: style})
+}
+
+// link 把上一个子图的出口都连到 to，出口没有标签时使用 label
+func (g *workflowGraph) link(exits []exitPoint, to string, label string) {
+	for _, exit := range exits {
+		g.edge(exit.node, to, lo.CoalesceOrEmpty(exit.label, label), edgeFlow)
+	}
+}
+
+// statement 返回子图的入口和出口，没有任何执行内容的节点入口为空
+func (g *workflowGraph) statement(path string, s *Statement) (string, []exitPoint) {
+	if s == nil {
+		return "", nil
+	}
+	var entry string
+	var exits []exitPoint
+	chain := func(subEntry string, subExits []exitPoint) {
+		if subEntry == "" {
+			return
+		}
+		if entry == "" {
+			entry = subEntry
+		} else {
+			g.link(exits, subEntry, "")
+		}
+		exits = subExits
+	}
+
+	for _, order := range s.Control.resolveExecutionOrder(s) {
+		switch order {
+		case activity:
+			id := g.activity(path+".activity", s.Activity)
+			chain(id, []exitPoint{{node: id}})
+		case sequence:
+			chain(g.sequence(path+".sequence", s.Sequence))
+		case parallel:
+			chain(g.parallel(path+".parallel", s.Parallel))
+		case foreach:
+			chain(g.loop(path+".foreach.do", "foreach "+s.ForEach.Items, s.ForEach.Do, "each", "done"))
+		case switcher:
+			chain(g.switcher(path+".switch", s.Switch))
+		case loop:
+			label := "loop"
+			if s.Loop.While != "" {
+				label = "while " + s.Loop.While
+			} else if s.Loop.Until != "" {
+				label = "until " + s.Loop.Until
+			}
+			chain(g.loop(path+".loop.do", label, s.Loop.Do, "repeat", "done"))
+		case subWorkflow:
+			label := "workflow " + s.Workflow.Name
+			if s.Workflow.Version != "" {
+				label += "@" + s.Workflow.Version
+			}
+			id := g.node(label, shapeWorkflow)
+			g.nodes[len(g.nodes)-1].status = g.status(path)
+			chain(id, []exitPoint{{node: id}})
+		}
+	}
+
+	if s.Control.When == "" {
+		return entry, exits
+	}
+	// when 条件：满足时执行子图，不满足时直接到下一个节点
+	decision := g.node(s.Control.When, shapeDecision)
+	for i, dep := range s.Control.DependsOn {
+		depNode := g.activity(fmt.Sprintf("%s.control.depends_on[%d]", path, i), dep)
+		g.edge(depNode, decision, "depends_on", edgeDependency)
+	}
+	if entry == "" {
+		return decision, []exitPoint{{node: decision}}
+	}
+	g.edge(decision, entry, "true", edgeFlow)
+	return decision, append(exits, exitPoint{node: decision, label: "false"})
+}
+
+// sequence 串行节点连成一条链
+func (g *workflowGraph) sequence(path string, seq Sequence) (string, []exitPoint) {
+	var entry string
+	var exits []exitPoint
+	for i, stmt := range seq {
+		subEntry, subExits := g.statement(fmt.Sprintf("%s[%d]", path, i), stmt)
+		if subEntry == "" {
+			continue
+		}
+		if entry == "" {
+			entry = subEntry
+		} else {
+			g.link(exits, subEntry, "")
+		}
+		exits = subExits
+	}
+	return entry, exits
+}
+
+// parallel 分支从 fork 节点分出，在 join 节点汇合
+func (g *workflowGraph) parallel(path string, p Parallel) (string, []exitPoint) {
+	fork := g.node("fork", shapeFork)
+	join := g.node("join", shapeFork)
+	for i, stmt := range p {
+		entry, exits := g.statement(fmt.Sprintf("%s[%d]", path, i), stmt)
+		if entry == "" {
+			g.edge(fork, join, "", edgeFlow)
+			continue
+		}
+		g.edge(fork, entry, "", edgeFlow)
+		g.link(exits, join, "")
+	}
+	return fork, []exitPoint{{node: join}}
+}
+
+// loop foreach 和 loop：子节点执行完回到循环节点，结束时从循环节点出去
+func (g *workflowGraph) loop(path string, label string, do *Statement, enter string, done string) (string, []exitPoint) {
+	id := g.node(label, shapeLoop)
+	entry, exits := g.statement(path, do)
+	if entry != "" {
+		g.edge(id, entry, enter, edgeFlow)
+		g.link(exits, id, "")
+	}
+	return id, []exitPoint{{node: id, label: done}}
+}
+
+// switcher 每个分支是一条带条件的边，没有 default 时不满足任何条件直接到下一个节点
+func (g *workflowGraph) switcher(path string, sw *Switch) (string, []exitPoint) {
+	decision := g.node("switch", shapeDecision)
+	var exits []exitPoint
+	for i, c := range sw.Cases {
+		if c == nil {
+			continue
+		}
+		label := c.When
+		if c.Name != "" {
+			label = c.Name + ": " + c.When
+		}
+		entry, caseExits := g.statement(fmt.Sprintf("%s.cases[%d].do", path, i), c.Do)
+		if entry == "" {
+			exits = append(exits, exitPoint{node: decision, label: label})
+			continue
+		}
+		g.edge(decision, entry, label, edgeFlow)
+		exits = append(exits, caseExits...)
+	}
+	entry, defaultExits := g.statement(path+".default", sw.Default)
+	if entry == "" {
+		exits = append(exits, exitPoint{node: decision, label: "default"})
+	} else {
+		g.edge(decision, entry, "default", edgeFlow)
+		exits = append(exits, defaultExits...)
+	}
+	return decision, exits
+}
+
+// activity 节点标签为 id 和 namespace/activity，钩子和补偿是虚线边，依赖是点线边
+func (g *workflowGraph) activity(path string, ac *Activity) string {
+	id := g.node(activityLabel(ac), shapeActivity)
+	g.nodes[len(g.nodes)-1].status = g.status(path)
+	if _, ok := g.acNodes[ac]; !ok {
+		g.acNodes[ac] = id
+	}
+
+	switch deps := ac.DependsOn.(type) {
+	case Sequence:
+		entry, exits := g.sequence(path+".depends_on", deps)
+		if entry != "" {
+			for _, exit := range exits {
+				g.edge(exit.node, id, lo.CoalesceOrEmpty(exit.label, "depends_on"), edgeDependency)
+			}
+		}
+	case []ActivityMetadata:
+		g.deps = append(g.deps, pendingDependency{node: id, deps: deps})
+	}
+	for _, e := range ac.Hooks.sortedEvents() {
+		hook := g.activity(fmt.Sprintf("%s.hooks.%s", path, e), ac.Hooks[e])
+		g.edge(id, hook, string(e), edgeHook)
+	}
+	if ac.Compensate != nil {
+		compensate := g.activity(path+".compensate", ac.Compensate)
+		g.edge(id, compensate, "compensate", edgeHook)
+	}
+	return id
+}
+
+// resolveDependencies 按名称声明的依赖和执行时一样解析，流程中没有的 activity 单独作为一个节点
+func (g *workflowGraph) resolveDependencies() {
+	for _, pending := range g.deps {
+		for _, dep := range pending.deps {
+			depAc := g.rs.resolveDependency(dep)
+			depNode, ok := g.acNodes[depAc]
+			if !ok {
+				depNode = g.node(activityLabel(depAc), shapeActivity)
+				g.acNodes[depAc] = depNode
+			}
+			g.edge(depNode, pending.node, "depends_on", edgeDependency)
+		}
+	}
+}
+
+// status 执行报告中该路径的结果，循环中执行多次时有失败的就是失败，否则取最后一次
+// activity 没有执行记录时，所在节点因为 when 不满足跳过的记为 skipped
+func (g *workflowGraph) status(path string) ReportStatus {
+	if g.report == nil {
+		return ""
+	}
+	g.report.mu.Lock()
+	defer g.report.mu.Unlock()
+
+	var status ReportStatus
+	for _, entry := range g.report.Entries {
+		if entry.Path != path && !(strings.HasPrefix(entry.Path, path) && iterationSuffix.MatchString(entry.Path[len(path):])) {
+			continue
+		}
+		if status != ReportFailed {
+			status = entry.Status
+		}
+	}
+	if status == "" && strings.HasSuffix(path, ".activity") {
+		stmtPath := strings.TrimSuffix(path, ".activity")
+		for _, entry := range g.report.Entries {
+			if entry.Kind == ReportKindStatement && entry.Path == stmtPath && entry.Status == ReportSkipped {
+				return ReportSkipped
+			}
+		}
+	}
+	return status
+}
+
+func activityLabel(ac *Activity) string {
+	lines := make([]string, 0, 2)
+	if ac.Id != "" {
+		lines = append(lines, ac.Id)
+	}
+	if ac.Namespace != "" || ac.Activity != "" {
+		lines = append(lines, getActionKey(ac.Namespace, ac.Activity))
+	} else if ac.Template != "" {
+		lines = append(lines, "template "+ac.Template)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func dotQuote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+	return `"` + s + `"`
+}
+
+func mermaidQuote(s string) string {
+	s = strings.NewReplacer(`"`, "#quot;", "\n", "<br/>").Replace(s)
+	return `"` + s + `"`
+}
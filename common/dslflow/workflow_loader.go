@@ -0,0 +1,537 @@
+package dslflow
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/magic-lib/workflow/common/errorflow"
+	"github.com/samber/lo"
+	"go.uber.org/multierr"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	activityType   = reflect.TypeOf(Activity{})
+	statementType  = reflect.TypeOf(Statement{})
+	durationType   = reflect.TypeOf(time.Duration(0))
+	yamlLineRegexp = regexp.MustCompile(`line (\d+): (.*)`)
+)
+
+// LoadWorkflowFile 从 yaml/json 文件中加载工作流定义，不认识的字段直接报错
+func LoadWorkflowFile(fileName string) (*Workflow, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("read workflow file failed: %w", err)
+	}
+	return loadWorkflow(fileName, data)
+}
+
+// LoadWorkflowBytes 从 yaml/json 内容中加载工作流定义，不认识的字段直接报错
+func LoadWorkflowBytes(data []byte) (*Workflow, error) {
+	return loadWorkflow("", data)
+}
+
+func loadWorkflow(fileName string, data []byte) (*Workflow, error) {
+	// json 是 yaml 的子集，统一按 yaml 节点解析，这样才能拿到行列号
+	if isJsonContent(fileName, data) {
+		if err := checkJsonSyntax(fileName, data); err != nil {
+			return nil, err
+		}
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, newParseErrorFromYaml(fileName, err)
+	}
+
+	wf := new(Workflow)
+	if root.Kind == 0 || len(root.Content) == 0 {
+		return nil, &errorflow.ParseError{File: fileName, Msg: "workflow definition is empty"}
+	}
+
+	l := &strictLoader{file: fileName}
+	l.check(&root, reflect.TypeOf(wf).Elem())
+	if l.errs != nil {
+		return nil, l.errs
+	}
+
+	if err := root.Decode(wf); err != nil {
+		return nil, newParseErrorFromYaml(fileName, err)
+	}
+	return wf, nil
+}
+
+func isJsonContent(fileName string, data []byte) bool {
+	if strings.EqualFold(filepath.Ext(fileName), ".json") {
+		return true
+	}
+	trimmed := bytes.TrimSpace(data)
+	return len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[')
+}
+
+// checkJsonSyntax json 语法错误时，根据偏移量换算出行列号
+func checkJsonSyntax(fileName string, data []byte) error {
+	var v any
+	err := json.Unmarshal(data, &v)
+	if err == nil {
+		return nil
+	}
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		line, column := offsetToPosition(data, syntaxErr.Offset)
+		return &errorflow.ParseError{File: fileName, Line: line, Column: column, Msg: syntaxErr.Error()}
+	}
+	return &errorflow.ParseError{File: fileName, Msg: err.Error()}
+}
+
+func offsetToPosition(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	line, column := 1, 1
+	for _, b := range data[:offset] {
+		if b == '\n' {
+			line++
+			column = 1
+			continue
+		}
+		column++
+	}
+	return line, column
+}
+
+// newParseErrorFromYaml yaml 库的错误只带行号，这里拆成单独的 ParseError
+func newParseErrorFromYaml(fileName string, err error) error {
+	var msgList []string
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		msgList = typeErr.Errors
+	} else {
+		msgList = []string{strings.TrimPrefix(err.Error(), "yaml: ")}
+	}
+
+	var retErr error
+	for _, msg := range msgList {
+		pe := &errorflow.ParseError{File: fileName, Msg: msg}
+		if m := yamlLineRegexp.FindStringSubmatch(msg); len(m) == 3 {
+			pe.Line, _ = strconv.Atoi(m[1])
+			pe.Msg = m[2]
+		}
+		retErr = multierr.Append(retErr, pe)
+	}
+	return retErr
+}
+
+// strictLoader 按照结构体定义逐个检查 yaml 节点，收集所有未知字段和类型错误
+type strictLoader struct {
+	file string
+	errs error
+}
+
+func (l *strictLoader) errorf(n *yaml.Node, format string, args ...any) {
+	l.errs = multierr.Append(l.errs, &errorflow.ParseError{
+		File:   l.file,
+		Line:   n.Line,
+		Column: n.Column,
+		Msg:    fmt.Sprintf(format, args...),
+	})
+}
+
+func (l *strictLoader) check(n *yaml.Node, t reflect.Type) {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	if n.Kind == yaml.DocumentNode {
+		for _, c := range n.Content {
+			l.check(c, t)
+		}
+		return
+	}
+	if n.Kind == yaml.ScalarNode && n.ShortTag() == "!!null" {
+		return
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		return
+	case reflect.Struct:
+		l.checkStruct(n, t)
+	case reflect.Map:
+		if n.Kind != yaml.MappingNode {
+			l.errorf(n, "expected an object for %s, got %s", typeName(t), nodeKindName(n))
+			return
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if t.Key() == reflect.TypeOf(LifecycleEvent("")) && !isLifecycleEvent(LifecycleEvent(n.Content[i].Value)) {
+				l.errorf(n.Content[i], "unknown lifecycle event %q", n.Content[i].Value)
+				continue
+			}
+			l.check(n.Content[i+1], t.Elem())
+		}
+	case reflect.Slice, reflect.Array:
+		if n.Kind != yaml.SequenceNode {
+			l.errorf(n, "expected a list for %s, got %s", typeName(t), nodeKindName(n))
+			return
+		}
+		for _, c := range n.Content {
+			l.check(c, t.Elem())
+		}
+	default:
+		l.checkScalar(n, t)
+	}
+}
+
+func (l *strictLoader) checkStruct(n *yaml.Node, t reflect.Type) {
+	if n.Kind != yaml.MappingNode {
+		l.errorf(n, "expected an object for %s, got %s", typeName(t), nodeKindName(n))
+		return
+	}
+	fields := yamlFields(t)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, val := n.Content[i], n.Content[i+1]
+		if key.Value == "<<" {
+			l.check(val, t)
+			continue
+		}
+		field, ok := fields[key.Value]
+		if !ok {
+			l.errorf(key, "unknown field %q in %s", key.Value, typeName(t))
+			continue
+		}
+		if t == activityType {
+			// 这两个字段由 Activity.UnmarshalYAML 自行解析
+			switch field.Name {
+			case "DependsOn":
+				l.checkDependsOn(val)
+				continue
+			case "Timeout":
+				l.checkSeconds(val)
+				continue
+			}
+		}
+		l.check(val, field.Type)
+	}
+}
+
+func (l *strictLoader) checkScalar(n *yaml.Node, t reflect.Type) {
+	if n.Kind != yaml.ScalarNode {
+		l.errorf(n, "expected a %s value, got %s", typeName(t), nodeKindName(n))
+		return
+	}
+	tag := n.ShortTag()
+	switch t.Kind() {
+	case reflect.String:
+		return
+	case reflect.Bool:
+		if tag != "!!bool" {
+			l.errorf(n, "expected a bool value, got %q", n.Value)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if t == durationType {
+			l.checkDuration(n)
+			return
+		}
+		if tag != "!!int" {
+			l.errorf(n, "expected an integer value, got %q", n.Value)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if tag != "!!int" || strings.HasPrefix(n.Value, "-") {
+			l.errorf(n, "expected a non-negative integer value, got %q", n.Value)
+		}
+	case reflect.Float32, reflect.Float64:
+		if tag != "!!int" && tag != "!!float" {
+			l.errorf(n, "expected a number value, got %q", n.Value)
+		}
+	}
+}
+
+// checkDuration 时间支持 "50ms"、"5s" 格式，整数为纳秒，和 encoding/json 编码 time.Duration 一致
+// yaml 库不能把整数解析为 time.Duration，这里把整数节点改写为字符串
+func (l *strictLoader) checkDuration(n *yaml.Node) {
+	switch n.ShortTag() {
+	case "!!str":
+		if _, err := time.ParseDuration(n.Value); err != nil {
+			l.errorf(n, "invalid duration %q", n.Value)
+		}
+	case "!!int":
+		nanos, err := strconv.ParseInt(n.Value, 0, 64)
+		if err != nil {
+			l.errorf(n, "invalid duration %q", n.Value)
+			return
+		}
+		n.Tag, n.Style, n.Value = "!!str", 0, time.Duration(nanos).String()
+	default:
+		l.errorf(n, "expected a duration string, got %q", n.Value)
+	}
+}
+
+// checkSeconds 超时时间既可以是秒数，也可以是 "30s"、"1m" 这样的可读格式
+func (l *strictLoader) checkSeconds(n *yaml.Node) {
+	if _, err := parseSecondsNode(n); err != nil {
+		l.errorf(n, "%s", err.Error())
+	}
+}
+
+// checkDependsOn 依赖支持三种写法：名称列表、{namespace,activity} 列表、流程节点列表
+func (l *strictLoader) checkDependsOn(n *yaml.Node) {
+	if n.Kind == yaml.ScalarNode {
+		if n.ShortTag() != "!!str" && n.ShortTag() != "!!null" {
+			l.errorf(n, "depends_on expects an activity name, got %q", n.Value)
+		}
+		return
+	}
+	if n.Kind != yaml.SequenceNode {
+		l.errorf(n, "depends_on expects a list, got %s", nodeKindName(n))
+		return
+	}
+	switch dependsOnNodeKind(n) {
+	case dependsOnKindNames:
+		for _, c := range n.Content {
+			if c.Kind == yaml.MappingNode {
+				l.check(c, reflect.TypeOf(ActivityMetadata{}))
+			}
+		}
+	case dependsOnKindSequence:
+		l.check(n, reflect.TypeOf(Sequence{}))
+	default:
+		l.errorf(n, "depends_on cannot mix activity names and statements")
+	}
+}
+
+type dependsOnKind int
+
+const (
+	dependsOnKindNames dependsOnKind = iota
+	dependsOnKindSequence
+	dependsOnKindMixed
+)
+
+// dependsOnNodeKind 判断依赖列表的写法，activity 为对象时表示是流程节点
+func dependsOnNodeKind(n *yaml.Node) dependsOnKind {
+	names, statements := 0, 0
+	for _, c := range n.Content {
+		if c.Kind != yaml.MappingNode {
+			names++
+			continue
+		}
+		isStatement := false
+		for i := 0; i+1 < len(c.Content); i += 2 {
+			switch OrderType(c.Content[i].Value) {
+			case activity:
+				isStatement = isStatement || c.Content[i+1].Kind == yaml.MappingNode
+			case sequence, parallel, foreach, switcher, loop, subWorkflow:
+				isStatement = true
+			default:
+				if c.Content[i].Value == "control" {
+					isStatement = true
+				}
+			}
+		}
+		if isStatement {
+			statements++
+		} else {
+			names++
+		}
+	}
+	if statements == 0 {
+		return dependsOnKindNames
+	}
+	if names == 0 {
+		return dependsOnKindSequence
+	}
+	return dependsOnKindMixed
+}
+
+// UnmarshalYAML 解析 activity，depends_on 和 timeout 需要转换成具体类型
+func (ac *Activity) UnmarshalYAML(value *yaml.Node) error {
+	type plainActivity Activity
+
+	var dependsNode, timeoutNode *yaml.Node
+	node := *value
+	if node.Kind == yaml.MappingNode {
+		node.Content = make([]*yaml.Node, 0, len(value.Content))
+		for i := 0; i+1 < len(value.Content); i += 2 {
+			switch value.Content[i].Value {
+			case "depends_on":
+				dependsNode = value.Content[i+1]
+			case "timeout":
+				timeoutNode = value.Content[i+1]
+			default:
+				node.Content = append(node.Content, value.Content[i], value.Content[i+1])
+			}
+		}
+	}
+
+	if err := node.Decode((*plainActivity)(ac)); err != nil {
+		return err
+	}
+	ac.explicit = explicitKeys(value)
+	if timeoutNode != nil {
+		seconds, err := parseSecondsNode(timeoutNode)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", timeoutNode.Line, err)
+		}
+		ac.Timeout = seconds
+	}
+	if dependsNode != nil {
+		dependsOn, err := decodeDependsOn(dependsNode)
+		if err != nil {
+			return err
+		}
+		ac.DependsOn = dependsOn
+	}
+	return nil
+}
+
+// explicitKeys activity 中写了的字段，retry_policy 下的字段记为 retry_policy.xxx
+func explicitKeys(n *yaml.Node) map[string]bool {
+	keys := make(map[string]bool)
+	if n.Kind != yaml.MappingNode {
+		return keys
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, value := n.Content[i].Value, n.Content[i+1]
+		keys[key] = true
+		if key == "retry_policy" && value.Kind == yaml.MappingNode {
+			for j := 0; j+1 < len(value.Content); j += 2 {
+				keys[key+"."+value.Content[j].Value] = true
+			}
+		}
+	}
+	return keys
+}
+
+// decodeDependsOn 名称列表转换为 []ActivityMetadata，流程节点列表转换为 Sequence
+func decodeDependsOn(n *yaml.Node) (any, error) {
+	if n.Kind == yaml.ScalarNode {
+		if n.ShortTag() == "!!null" {
+			return nil, nil
+		}
+		return []ActivityMetadata{parseActivityRef(n.Value)}, nil
+	}
+	if n.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("line %d: depends_on expects a list", n.Line)
+	}
+	if len(n.Content) == 0 {
+		return nil, nil
+	}
+
+	switch dependsOnNodeKind(n) {
+	case dependsOnKindNames:
+		names := make([]ActivityMetadata, 0, len(n.Content))
+		for _, c := range n.Content {
+			if c.Kind == yaml.ScalarNode {
+				names = append(names, parseActivityRef(c.Value))
+				continue
+			}
+			var meta ActivityMetadata
+			if err := c.Decode(&meta); err != nil {
+				return nil, err
+			}
+			names = append(names, meta)
+		}
+		return names, nil
+	case dependsOnKindSequence:
+		var seq Sequence
+		if err := n.Decode(&seq); err != nil {
+			return nil, err
+		}
+		return seq, nil
+	}
+	return nil, fmt.Errorf("line %d: depends_on cannot mix activity names and statements", n.Line)
+}
+
+// parseActivityRef 依赖名称可以是 activity id，也可以是 namespace/activity
+func parseActivityRef(name string) ActivityMetadata {
+	name = strings.TrimSpace(name)
+	if idx := strings.LastIndex(name, "/"); idx > 0 {
+		return ActivityMetadata{Namespace: name[:idx], Activity: name[idx+1:]}
+	}
+	return ActivityMetadata{Activity: name}
+}
+
+// parseSecondsNode 解析以秒为单位的时间，支持整数和 "30s"、"1m30s" 格式
+func parseSecondsNode(n *yaml.Node) (int, error) {
+	if n.Kind != yaml.ScalarNode {
+		return 0, fmt.Errorf("expected seconds or a duration, got %s", nodeKindName(n))
+	}
+	switch n.ShortTag() {
+	case "!!null":
+		return 0, nil
+	case "!!int":
+		return strconv.Atoi(n.Value)
+	}
+	d, err := time.ParseDuration(n.Value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", n.Value)
+	}
+	if d%time.Second != 0 {
+		return 0, fmt.Errorf("duration %q must be whole seconds", n.Value)
+	}
+	return int(d / time.Second), nil
+}
+
+// yamlFields 获取结构体中 yaml 字段名和字段的对应关系，包括 inline 的字段
+func yamlFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("yaml")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if opts == "inline" {
+			ft := f.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			for k, v := range yamlFields(ft) {
+				fields[k] = v
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+func isLifecycleEvent(e LifecycleEvent) bool {
+	return lo.Contains(lifecycleEventList, e)
+}
+
+func typeName(t reflect.Type) string {
+	if t.Name() != "" {
+		return t.Name()
+	}
+	return t.String()
+}
+
+func nodeKindName(n *yaml.Node) string {
+	switch n.Kind {
+	case yaml.MappingNode:
+		return "an object"
+	case yaml.SequenceNode:
+		return "a list"
+	case yaml.ScalarNode:
+		return fmt.Sprintf("%q", n.Value)
+	}
+	return "an unsupported value"
+}
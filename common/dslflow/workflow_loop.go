@@ -0,0 +1,93 @@
+package dslflow
+
+import (
+	"context"
+	"fmt"
+	"github.com/magic-lib/workflow/common/errorflow"
+	"github.com/samber/lo"
+	"time"
+)
+
+const (
+	defaultLoopMaxIterations = 100
+	defaultLoopIndexVar      = "iteration"
+)
+
+type (
+	// Loop 循环执行子节点，While 在每次执行前判断，Until 在每次执行后判断，上一次执行的变量对下一次可见
+	Loop struct {
+		While         string        `yaml:"while" json:"while,omitempty"`                   // 满足条件时继续执行
+		Until         string        `yaml:"until" json:"until,omitempty"`                   // 执行后满足条件时退出
+		MaxIterations int           `yaml:"max_iterations" json:"max_iterations,omitempty"` // 最大执行次数，默认 100，超过时返回 MaxIterationsError
+		Delay         time.Duration `yaml:"delay" json:"delay,omitempty"`                   // 两次执行之间的等待时间，比如 5s
+		IndexVar      string        `yaml:"index_var" json:"index_var,omitempty"`           // 当前次数的变量名，从0开始，默认 iteration，循环结束后为执行的次数
+		Do            *Statement    `yaml:"do" json:"do"`                                   // 每次执行的子节点
+	}
+)
+
+func (l *Loop) maxIterations() int {
+	return lo.Ternary(l.MaxIterations > 0, l.MaxIterations, defaultLoopMaxIterations)
+}
+
+func (l *Loop) indexVar() string {
+	return lo.Ternary(l.IndexVar != "", l.IndexVar, defaultLoopIndexVar)
+}
+
+// Execute 循环执行子节点直到条件不满足
+func (l *Loop) Execute(ctx context.Context, vars map[string]any) (map[string]any, error) {
+	if l.Do == nil {
+		return vars, fmt.Errorf("loop do is empty")
+	}
+	if l.While == "" && l.Until == "" {
+		return vars, fmt.Errorf("loop requires while or until")
+	}
+
+	resultVars := cloneMap(vars)
+	maxIterations := l.maxIterations()
+	for i := 0; ; i++ {
+		resultVars[l.indexVar()] = i
+		if l.While != "" {
+			matched, err := evalCondition(ctx, l.While, resultVars, resultVars)
+			if err != nil {
+				return resultVars, fmt.Errorf("loop while: %w", err)
+			}
+			if !matched {
+				return resultVars, nil
+			}
+			if i >= maxIterations {
+				return resultVars, &errorflow.MaxIterationsError{MaxIterations: maxIterations, Condition: l.While}
+			}
+		}
+
+		if i > 0 && l.Delay > 0 {
+			select {
+			case <-ctx.Done():
+				return resultVars, ctx.Err()
+			case <-time.After(l.Delay):
+			}
+		}
+		if ctx.Err() != nil {
+			return resultVars, ctx.Err()
+		}
+
+		out, err := l.Do.Execute(withLoopIteration(ctx, i), resultVars)
+		if err != nil {
+			return resultVars, fmt.Errorf("loop iteration %d: %w", i, err)
+		}
+		resultVars = lo.Assign(resultVars, out)
+		resultVars[l.indexVar()] = i + 1
+
+		if l.Until != "" {
+			matched, err := evalCondition(ctx, l.Until, resultVars, resultVars)
+			if err != nil {
+				return resultVars, fmt.Errorf("loop until: %w", err)
+			}
+			if matched {
+				return resultVars, nil
+			}
+			if i+1 >= maxIterations {
+				return resultVars, &errorflow.MaxIterationsError{MaxIterations: maxIterations, Condition: "until " + l.Until}
+			}
+		}
+	}
+}
@@ -6,32 +6,119 @@ import (
 	"github.com/magic-lib/go-plat-utils/goroutines"
 	"github.com/samber/lo"
 	"go.uber.org/multierr"
+	"strconv"
+	"strings"
 	"sync"
 )
 
+type ParallelMode string // 并行分支的完成策略
+
+const (
+	ParallelModeAll      ParallelMode = "all"       // 等待所有分支执行完，收集所有错误
+	ParallelModeFailFast ParallelMode = "fail_fast" // 某个分支失败时取消其他分支，默认策略
+	ParallelModeAny      ParallelMode = "any"       // 第一个成功的分支返回后取消其他分支
+	ParallelModeRace     ParallelMode = "race"      // 同 any
+	parallelModeQuorum                = "quorum:"   // quorum:N，N 个分支成功后取消其他分支
+)
+
+var parallelModeList = []ParallelMode{ParallelModeAll, ParallelModeFailFast, ParallelModeAny, ParallelModeRace}
+
 type (
 	// Parallel 并行流程：同时执行多个子节点
 	Parallel []*Statement
+
+	// ParallelPolicy 并行流程的执行策略
+	ParallelPolicy struct {
+		Mode           ParallelMode  `yaml:"mode" json:"mode,omitempty"`                       // all/fail_fast/any/race/quorum:N，默认 fail_fast
+		MaxConcurrency int           `yaml:"max_concurrency" json:"max_concurrency,omitempty"` // 同时执行的最大分支数，0 表示不限制
+		Merge          ParallelMerge `yaml:"merge" json:"merge,omitempty"`                     // 分支结果的合并策略，默认 last-wins
+	}
 )
 
-// Execute 执行并行流程（同时执行所有子节点，等待全部完成）
+// resolve 解析执行策略，quorum 返回需要成功的分支数
+func (pp *ParallelPolicy) resolve(branches int) (ParallelMode, int, error) {
+	if pp == nil || pp.Mode == "" {
+		return ParallelModeFailFast, 0, nil
+	}
+	switch pp.Mode {
+	case ParallelModeAll, ParallelModeFailFast:
+		return pp.Mode, 0, nil
+	case ParallelModeAny, ParallelModeRace:
+		return pp.Mode, 1, nil
+	}
+	if quorumStr, ok := strings.CutPrefix(string(pp.Mode), parallelModeQuorum); ok {
+		quorum, err := strconv.Atoi(quorumStr)
+		if err != nil || quorum <= 0 || quorum > branches {
+			return "", 0, fmt.Errorf("invalid parallel mode %q, quorum must be between 1 and %d", pp.Mode, branches)
+		}
+		return pp.Mode, quorum, nil
+	}
+	return "", 0, fmt.Errorf("invalid parallel mode %q, must be one of all/fail_fast/any/race/quorum:N", pp.Mode)
+}
+
+func (pp *ParallelPolicy) maxConcurrency(branches int) int {
+	if pp == nil || pp.MaxConcurrency <= 0 || pp.MaxConcurrency > branches {
+		return branches
+	}
+	return pp.MaxConcurrency
+}
+
+// Execute 执行并行流程（同时执行所有子节点，某个分支失败时取消其他分支）
 func (p Parallel) Execute(ctx context.Context, vars map[string]any) (map[string]any, error) {
-	resultVars := cloneMap(vars)
+	return p.ExecuteWithPolicy(ctx, vars, nil)
+}
+
+// ExecuteWithPolicy 按策略执行并行流程，any/race/quorum 达到成功数后取消其他分支，未完成分支的结果和错误丢弃
+func (p Parallel) ExecuteWithPolicy(ctx context.Context, vars map[string]any, policy *ParallelPolicy) (map[string]any, error) {
+	if len(p) == 0 {
+		return cloneMap(vars), nil
+	}
+	mode, quorum, err := policy.resolve(len(p))
+	if err != nil {
+		return cloneMap(vars), err
+	}
+	strategy, err := policy.mergeStrategy()
+	if err != nil {
+		return cloneMap(vars), err
+	}
+	ctx, span := startSpan(ctx, "parallel", "parallel.branches", len(p), "parallel.mode", string(mode))
 
 	// 为每个子节点创建带取消的上下文
 	sonCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	// 每个分支单独记录补偿动作，补偿时分支之间同时执行
+	branchScopes := getSagaScope(ctx).addParallel(len(p))
+	branchWritten := make([]*branchWrites, len(p))
+	sem := make(chan struct{}, policy.maxConcurrency(len(p)))
+
 	var (
-		wg       sync.WaitGroup
-		mu       sync.Mutex
-		multiErr error
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		multiErr  error
+		succeeded int
+		failed    int
+		done      bool // any/quorum 已经有结果，后续的分支不再执行
+		outputs   = make([]map[string]any, len(p))
+		written   = make([]map[string]any, len(p))
+		completed = make([]int, 0, len(p))
 	)
 
 	for i, stmt := range p {
+		branchWritten[i] = &branchWrites{}
+		sem <- struct{}{}
+		mu.Lock()
+		finished := done
+		mu.Unlock()
+		if finished {
+			<-sem
+			break
+		}
+
 		wg.Add(1)
 		goroutines.GoAsync(func(params ...any) {
 			defer wg.Done()
+			defer func() { <-sem }()
 
 			currCtx := params[0].(context.Context)
 			currStmt := params[1].(*Statement)
@@ -39,9 +126,11 @@ func (p Parallel) Execute(ctx context.Context, vars map[string]any) (map[string]
 			currIndex := params[3].(int)
 
 			// 检查上下文是否已取消
-			if ctx.Err() != nil {
+			if currCtx.Err() != nil {
 				mu.Lock()
-				multiErr = multierr.Append(multiErr, fmt.Errorf("parallel node %d error: %w", currIndex, ctx.Err()))
+				if !done {
+					multiErr = multierr.Append(multiErr, fmt.Errorf("parallel node %d error: %w", currIndex, currCtx.Err()))
+				}
 				mu.Unlock()
 				return
 			}
@@ -49,28 +138,50 @@ func (p Parallel) Execute(ctx context.Context, vars map[string]any) (map[string]
 			subVars := cloneMap(currVars)
 
 			res, err := currStmt.Execute(currCtx, subVars)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if done {
+				return
+			}
 			if err != nil {
-				if stmt.Control.shouldIgnoreOnError() {
-					return
+				failed++
+				if !currStmt.Control.shouldIgnoreOnError() {
+					multiErr = multierr.Append(multiErr, fmt.Errorf("parallel node %d error: %w", currIndex, err))
+				}
+				switch {
+				case mode == ParallelModeFailFast && !currStmt.Control.shouldIgnoreOnError():
+					cancel()
+				case quorum > 0 && len(p)-failed < quorum:
+					// 剩下的分支全部成功也达不到要求
+					done = true
+					cancel()
 				}
-				cancel()
-				mu.Lock()
-				multiErr = multierr.Append(multiErr, fmt.Errorf("parallel node %d error: %w", currIndex, err))
-				mu.Unlock()
 				return
 			}
-			// 合并子节点结果
-			if len(res) > 0 {
-				// 合并子节点结果（加锁保护）
-				mu.Lock()
-				resultVars = lo.Assign(resultVars, res)
-				mu.Unlock()
+
+			succeeded++
+			// 只记录子节点新增或修改的变量，全部完成后按策略合并
+			outputs[currIndex] = changedVars(currVars, res)
+			written[currIndex] = lo.PickByKeys(res, branchWritten[currIndex].list())
+			completed = append(completed, currIndex)
+			if quorum > 0 && succeeded >= quorum {
+				done = true
+				multiErr = nil
+				cancel()
 			}
-			return
-		}, sonCtx, stmt, vars, i)
+		}, withBranchWrites(withSagaScope(sonCtx, branchScopes[i]), branchWritten[i]), stmt, vars, i)
 	}
 
 	// 等待所有并行节点完成
 	wg.Wait()
+	if quorum > 0 && succeeded < quorum {
+		multiErr = multierr.Append(multiErr, fmt.Errorf("parallel %s: %d of %d branches succeeded, %d required", mode, succeeded, len(p), quorum))
+	}
+	resultVars, err := p.merge(strategy, vars, outputs, written, completed)
+	multiErr = multierr.Append(multiErr, err)
+	p.recordWrites(ctx, strategy, written)
+	span.SetAttribute("parallel.succeeded", succeeded)
+	endSpan(span, multiErr)
 	return resultVars, multiErr
 }
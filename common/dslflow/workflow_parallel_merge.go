@@ -0,0 +1,169 @@
+package dslflow
+
+import (
+	"context"
+	"fmt"
+	"github.com/magic-lib/go-plat-utils/conv"
+	"github.com/magic-lib/workflow/common/errorflow"
+	"github.com/samber/lo"
+	"go.uber.org/multierr"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+type ParallelMerge string // 并行分支结果的合并策略
+
+const (
+	ParallelMergeLastWins        ParallelMerge = "last-wins"         // 按完成顺序合并，后完成的分支覆盖先完成的，默认策略
+	ParallelMergeBranchOrder     ParallelMerge = "branch-order"      // 按分支定义顺序合并，后面的分支覆盖前面的
+	ParallelMergeDeep            ParallelMerge = "deep-merge"        // 按分支定义顺序递归合并 map，其他类型后面的分支覆盖前面的
+	ParallelMergeNamespaced      ParallelMerge = "namespaced"        // 每个分支的结果放到分支的 activity id 或下标下面
+	ParallelMergeErrorOnConflict ParallelMerge = "error-on-conflict" // 多个分支写入同一个变量并且值不同时报错，回显的请求参数不算写入
+)
+
+var parallelMergeList = []ParallelMerge{
+	ParallelMergeLastWins, ParallelMergeBranchOrder, ParallelMergeDeep, ParallelMergeNamespaced, ParallelMergeErrorOnConflict,
+}
+
+type (
+	branchWritesKey struct{}
+
+	// branchWrites 并行分支中写入的变量名：activity 的返回、id、responses 中声明的变量，不包括回显到结果中的请求参数
+	branchWrites struct {
+		mu   sync.Mutex
+		keys map[string]struct{}
+	}
+)
+
+func withBranchWrites(ctx context.Context, writes *branchWrites) context.Context {
+	return context.WithValue(ctx, branchWritesKey{}, writes)
+}
+
+// recordWrites 记录当前分支写入的变量，不在并行分支中时忽略
+func recordWrites(ctx context.Context, keys ...string) {
+	writes, ok := ctx.Value(branchWritesKey{}).(*branchWrites)
+	if !ok || writes == nil {
+		return
+	}
+	writes.mu.Lock()
+	defer writes.mu.Unlock()
+	if writes.keys == nil {
+		writes.keys = make(map[string]struct{})
+	}
+	for _, k := range keys {
+		if k != "" {
+			writes.keys[k] = struct{}{}
+		}
+	}
+}
+
+func (w *branchWrites) list() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return lo.Keys(w.keys)
+}
+
+func (pp *ParallelPolicy) mergeStrategy() (ParallelMerge, error) {
+	if pp == nil || pp.Merge == "" {
+		return ParallelMergeLastWins, nil
+	}
+	if !lo.Contains(parallelMergeList, pp.Merge) {
+		return "", fmt.Errorf("invalid parallel merge %q, must be one of last-wins/branch-order/deep-merge/namespaced/error-on-conflict", pp.Merge)
+	}
+	return pp.Merge, nil
+}
+
+// branchName 分支的名称，分支是 activity 并且配置了 id 时使用 id，否则使用下标
+func (p Parallel) branchName(i int) string {
+	if stmt := p[i]; stmt != nil && stmt.Activity != nil && stmt.Activity.Id != "" {
+		return stmt.Activity.Id
+	}
+	return strconv.Itoa(i)
+}
+
+// merge 合并各分支新增或修改的变量，outputs 按分支下标保存，没有执行成功的分支为 nil，completed 为完成顺序
+// written 为各分支自己写入的变量，error-on-conflict 只比较这些变量，回显的请求参数不算冲突
+func (p Parallel) merge(strategy ParallelMerge, vars map[string]any, outputs []map[string]any, written []map[string]any, completed []int) (map[string]any, error) {
+	resultVars := cloneMap(vars)
+	branchOrder := make([]int, 0, len(outputs))
+	for i, out := range outputs {
+		if out != nil {
+			branchOrder = append(branchOrder, i)
+		}
+	}
+
+	switch strategy {
+	case ParallelMergeBranchOrder:
+		for _, i := range branchOrder {
+			resultVars = lo.Assign(resultVars, outputs[i])
+		}
+	case ParallelMergeDeep:
+		for _, i := range branchOrder {
+			resultVars = deepMerge(resultVars, cloneMap(outputs[i]))
+		}
+	case ParallelMergeNamespaced:
+		for _, i := range branchOrder {
+			resultVars[p.branchName(i)] = outputs[i]
+		}
+	case ParallelMergeErrorOnConflict:
+		writers := make(map[string][]int)
+		for _, i := range branchOrder {
+			for k := range written[i] {
+				writers[k] = append(writers[k], i)
+			}
+			resultVars = lo.Assign(resultVars, outputs[i])
+		}
+		keys := lo.Keys(writers)
+		sort.Strings(keys)
+		var multiErr error
+		for _, k := range keys {
+			branches := writers[k]
+			conflicted := lo.ContainsBy(branches[1:], func(i int) bool {
+				return conv.String(written[i][k]) != conv.String(written[branches[0]][k])
+			})
+			if !conflicted {
+				continue
+			}
+			multiErr = multierr.Append(multiErr, &errorflow.MergeConflictError{
+				Key:      k,
+				Branches: lo.Map(branches, func(i int, _ int) string { return p.branchName(i) }),
+			})
+		}
+		return resultVars, multiErr
+	default:
+		for _, i := range completed {
+			resultVars = lo.Assign(resultVars, outputs[i])
+		}
+	}
+	return resultVars, nil
+}
+
+// recordWrites 嵌套在外层并行分支中时，合并后写入的变量也是外层分支写入的
+func (p Parallel) recordWrites(ctx context.Context, strategy ParallelMerge, written []map[string]any) {
+	for i, w := range written {
+		if w == nil {
+			continue
+		}
+		if strategy == ParallelMergeNamespaced {
+			recordWrites(ctx, p.branchName(i))
+			continue
+		}
+		recordWrites(ctx, lo.Keys(w)...)
+	}
+}
+
+// deepMerge 递归合并 map，src 覆盖 dst 中相同的非 map 变量
+func deepMerge(dst map[string]any, src map[string]any) map[string]any {
+	merged := cloneMap(dst)
+	for k, v := range src {
+		srcMap, srcOk := v.(map[string]any)
+		dstMap, dstOk := merged[k].(map[string]any)
+		if srcOk && dstOk {
+			merged[k] = deepMerge(dstMap, srcMap)
+			continue
+		}
+		merged[k] = v
+	}
+	return merged
+}
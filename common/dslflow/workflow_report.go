@@ -0,0 +1,222 @@
+package dslflow
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	ReportKindStatement ReportKind = "statement"
+	ReportKindActivity  ReportKind = "activity"
+
+	ReportSucceeded ReportStatus = "succeeded" // 执行成功
+	ReportFailed    ReportStatus = "failed"    // 执行失败
+	ReportSkipped   ReportStatus = "skipped"   // when 条件不满足，没有执行
+	ReportIgnored   ReportStatus = "ignored"   // 执行失败，onerror: ignore 忽略了错误
+	ReportCached    ReportStatus = "cached"    // 命中缓存，或者 Resume 时直接使用保存的结果，没有执行 action
+)
+
+type (
+	ReportKind   string
+	ReportStatus string
+
+	// RunReport 一次执行经过的所有节点和 activity，按开始执行的顺序排列
+	// onexit: exit 之后在后台执行的节点，执行结束前状态为空
+	// 执行过程中报告会被后台流程修改，ExecuteWithReport 返回的是副本，通过 Wait 获取后台流程结束后的报告
+	RunReport struct {
+		mu        sync.Mutex
+		done      chan struct{} // 执行结束后关闭，onexit: exit 时等后台流程结束后关闭
+		doneOnce  sync.Once
+		live      *RunReport     // 副本对应的正在记录的报告
+		RunID     string         `json:"run_id"`
+		Workflow  string         `json:"workflow,omitempty"`
+		Status    RunStatus      `json:"status"`
+		StartTime time.Time      `json:"start_time"`
+		EndTime   time.Time      `json:"end_time"`
+		Error     string         `json:"error,omitempty"`
+		Entries   []*ReportEntry `json:"entries"`
+	}
+
+	// ReportEntry 一个节点或 activity 的执行情况
+	ReportEntry struct {
+		report     *RunReport
+		Kind       ReportKind   `json:"kind"`
+		Path       string       `json:"path"`
+		ActivityId string       `json:"activity_id,omitempty"`
+		Action     string       `json:"action,omitempty"`     // namespace/activity
+		Dependency bool         `json:"dependency,omitempty"` // 作为其他 activity 的依赖执行
+		Status     ReportStatus `json:"status"`
+		StartTime  time.Time    `json:"start_time"`
+		EndTime    time.Time    `json:"end_time"`
+		Attempts   int          `json:"attempts,omitempty"`  // action 执行次数，包括重试
+		Arguments  any          `json:"arguments,omitempty"` // 模版替换后传给 action 的参数
+		Response   any          `json:"response,omitempty"`  // action 的原始返回
+		Error      string       `json:"error,omitempty"`
+		Child      *RunReport   `json:"child,omitempty"` // 子流程的执行报告
+	}
+
+	reportKey      struct{}
+	reportEntryKey struct{}
+)
+
+// ExecuteWithReport 执行工作流并返回执行报告，执行失败时也会返回报告，runID 为空时自动生成
+// 返回的是工作流返回时报告的副本，遇到 onexit: exit 时后台流程还在执行，可以通过 Wait 等待最终的报告
+func (w *Workflow) ExecuteWithReport(ctx context.Context, runID string, args map[string]any) (map[string]any, *RunReport, error) {
+	ctx = context.WithValue(ctx, reportKey{}, true)
+	rs, err := w.newRun(ctx, runID, args)
+	if err != nil {
+		return nil, nil, fmt.Errorf("workflow execute failed: %w", err)
+	}
+	result, err := w.run(ctx, rs)
+	return result, rs.report.Snapshot(), err
+}
+
+// Snapshot 返回报告当前的副本，包括子流程的报告，副本不会再被修改
+func (r *RunReport) Snapshot() *RunReport {
+	if r == nil {
+		return nil
+	}
+	live := r
+	if r.live != nil {
+		live = r.live
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	snapshot := &RunReport{
+		live:      live,
+		RunID:     r.RunID,
+		Workflow:  r.Workflow,
+		Status:    r.Status,
+		StartTime: r.StartTime,
+		EndTime:   r.EndTime,
+		Error:     r.Error,
+		Entries:   make([]*ReportEntry, 0, len(r.Entries)),
+	}
+	for _, entry := range r.Entries {
+		copied := *entry
+		copied.report, copied.Child = snapshot, entry.Child.Snapshot()
+		snapshot.Entries = append(snapshot.Entries, &copied)
+	}
+	return snapshot
+}
+
+// Wait 等待执行结束，包括 onexit: exit 之后的后台流程，返回最终报告的副本
+func (r *RunReport) Wait(ctx context.Context) (*RunReport, error) {
+	live := r
+	if r.live != nil {
+		live = r.live
+	}
+	if live.done != nil {
+		select {
+		case <-live.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return live.Snapshot(), nil
+}
+
+// newRunReport 通过 ExecuteWithReport 执行时才记录报告，子流程也一起记录
+func newRunReport(ctx context.Context, rs *runState) *RunReport {
+	if enabled, _ := ctx.Value(reportKey{}).(bool); !enabled {
+		return nil
+	}
+	return &RunReport{RunID: rs.runID, Workflow: rs.workflow.Name, Status: RunStatusRunning, StartTime: time.Now(), done: make(chan struct{})}
+}
+
+func (r *RunReport) finish(status RunStatus, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Status, r.EndTime = status, time.Now()
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if status != RunStatusExited {
+		r.doneOnce.Do(func() { close(r.done) })
+	}
+}
+
+// startEntry 开始记录一个节点或 activity，返回的 context 中带着这条记录，执行过程中补充参数、执行次数等
+func (r *RunReport) startEntry(ctx context.Context, entry *ReportEntry) (context.Context, *ReportEntry) {
+	if r == nil {
+		return ctx, nil
+	}
+	entry.report, entry.StartTime = r, time.Now()
+	r.mu.Lock()
+	r.Entries = append(r.Entries, entry)
+	r.mu.Unlock()
+	return context.WithValue(ctx, reportEntryKey{}, entry), entry
+}
+
+// startStatementEntry 记录流程节点
+func (rs *runState) startStatementEntry(ctx context.Context, path string) (context.Context, *ReportEntry) {
+	if rs == nil {
+		return ctx, nil
+	}
+	return rs.report.startEntry(ctx, &ReportEntry{Kind: ReportKindStatement, Path: path})
+}
+
+// startActivityEntry 记录 activity，路径为 activity 在流程中第一次出现的位置
+func (rs *runState) startActivityEntry(ctx context.Context, ac *Activity, dependency bool) (context.Context, *ReportEntry) {
+	if rs == nil || rs.report == nil {
+		return ctx, nil
+	}
+	path := ""
+	if acPath, ok := rs.acPaths[ac]; ok {
+		path = acPath + loopIteration(ctx)
+	}
+	return rs.report.startEntry(ctx, &ReportEntry{
+		Kind:       ReportKindActivity,
+		Path:       path,
+		ActivityId: ac.Id,
+		Action:     getActionKey(ac.Namespace, ac.Activity),
+		Dependency: dependency,
+	})
+}
+
+// currentReportEntry 正在执行的节点或 activity 的记录，没有记录报告时为 nil
+func currentReportEntry(ctx context.Context) *ReportEntry {
+	entry, _ := ctx.Value(reportEntryKey{}).(*ReportEntry)
+	return entry
+}
+
+// update 修改记录，报告可能在后台执行的节点修改时被读取
+func (e *ReportEntry) update(fn func(e *ReportEntry)) {
+	if e == nil {
+		return
+	}
+	e.report.mu.Lock()
+	defer e.report.mu.Unlock()
+	fn(e)
+}
+
+// finish 结束记录，没有标记过状态时按 err 记为成功或失败
+func (e *ReportEntry) finish(err error) {
+	e.update(func(e *ReportEntry) {
+		e.EndTime = time.Now()
+		if err != nil {
+			e.Error = err.Error()
+		}
+		if e.Status == "" {
+			e.Status = ReportSucceeded
+			if err != nil {
+				e.Status = ReportFailed
+			}
+		}
+	})
+}
+
+// mark 标记状态，比如 when 不满足、命中缓存、忽略了错误
+func (e *ReportEntry) mark(status ReportStatus, err error) {
+	e.update(func(e *ReportEntry) {
+		e.Status = status
+		if err != nil {
+			e.Error = err.Error()
+		}
+	})
+}
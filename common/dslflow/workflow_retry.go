@@ -0,0 +1,162 @@
+package dslflow
+
+import (
+	"context"
+	"fmt"
+	"github.com/magic-lib/workflow/common/errorflow"
+	"github.com/samber/lo"
+	"math"
+	"math/rand"
+	"reflect"
+	"time"
+)
+
+const (
+	defaultRetryInitialInterval    = 50 * time.Millisecond
+	defaultRetryBackoffCoefficient = 2.0
+)
+
+// executeWithRetry 带重试机制执行函数，至少需要执行一次
+// 每次执行的错误记录在结果的 {{id.attempts}} 中，没有 id 时为 {{namespace/activity.attempts}}，失败时通过 attemptsError 带出
+func (ac *Activity) executeWithRetry(fn ActionMethod, ctx context.Context, arguments any) (map[string]any, error) {
+	rp := ac.RetryPolicy
+	maxAttempts := max(rp.MaximumAttempts, 0) + 1 // 最少执行一次
+	start := time.Now()
+
+	attempts := make([]*errorflow.RetryAttempt, 0, 1)
+	failed := func(cause error) error {
+		return &attemptsError{key: ac.attemptsKey(), attempts: attemptList(attempts), err: retryError(attempts, cause)}
+	}
+	for attempt := 1; ; attempt++ {
+		currentSpan(ctx).SetAttribute("retry.count", attempt-1)
+		currentReportEntry(ctx).update(func(e *ReportEntry) { e.Attempts = attempt })
+		attemptCtx, span := startSpan(ctx, "attempt", "attempt", attempt)
+		retData, err := fn(attemptCtx, arguments)
+		endSpan(span, err)
+		attempts = append(attempts, &errorflow.RetryAttempt{Attempt: attempt, Err: err})
+		if err == nil {
+			resultMap := ac.createResponse(arguments, retData)
+			return recordAttempts(resultMap, ac.attemptsKey(), attemptList(attempts)), nil // 成功执行
+		}
+		if attempt >= maxAttempts || !rp.retryable(err) {
+			return nil, failed(nil)
+		}
+
+		backoff := rp.backoff(attempt)
+		if rp.Deadline > 0 && time.Since(start)+backoff > rp.Deadline {
+			return nil, failed(fmt.Errorf("超过重试期限 %v", rp.Deadline))
+		}
+		getMetrics(ctx).ActionRetried(ctx, getActionKey(ac.Namespace, ac.Activity))
+		logWarn(ctx, "action failed, retrying", "attempt", attempt, "max_attempts", maxAttempts, "backoff", backoff, "error", err)
+
+		// 等待期间 context 取消时立即返回
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, failed(ctx.Err())
+		}
+	}
+}
+
+// backoff 第 attempt 次执行失败后的等待时间：InitialInterval * BackoffCoefficient^(attempt-1)，加上随机浮动后不超过 MaximumInterval
+func (rp RetryPolicyConfig) backoff(attempt int) time.Duration {
+	interval := lo.Ternary(rp.InitialInterval > 0, rp.InitialInterval, defaultRetryInitialInterval)
+	coefficient := lo.Ternary(rp.BackoffCoefficient > 0, rp.BackoffCoefficient, defaultRetryBackoffCoefficient)
+
+	backoff := float64(interval) * math.Pow(coefficient, float64(attempt-1))
+	if rp.Jitter > 0 {
+		backoff += backoff * rp.Jitter * (rand.Float64()*2 - 1)
+	}
+	if rp.MaximumInterval > 0 && backoff > float64(rp.MaximumInterval) {
+		backoff = float64(rp.MaximumInterval)
+	}
+	return time.Duration(backoff)
+}
+
+// retryable 判断错误是否可以重试，错误链上任意一个错误匹配 NonRetryableErrors 时不重试
+func (rp RetryPolicyConfig) retryable(err error) bool {
+	if errorflow.IsBusinessError(err) || errorflow.IsValidationError(err) {
+		return false
+	}
+	if len(rp.NonRetryableErrors) == 0 {
+		return true
+	}
+	return !anyError(err, func(e error) bool {
+		t := reflect.TypeOf(e)
+		if t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		names := []string{t.Name(), t.String()} // TimeoutError、errorflow.TimeoutError
+		if ce, ok := e.(interface{ ErrorCode() string }); ok {
+			names = append(names, ce.ErrorCode())
+		}
+		return lo.Some(rp.NonRetryableErrors, names)
+	})
+}
+
+// anyError 遍历错误链，包括 multierr 这类包含多个错误的情况
+func anyError(err error, fn func(e error) bool) bool {
+	if err == nil {
+		return false
+	}
+	if fn(err) {
+		return true
+	}
+	switch x := err.(type) {
+	case interface{ Unwrap() error }:
+		return anyError(x.Unwrap(), fn)
+	case interface{ Unwrap() []error }:
+		return lo.ContainsBy(x.Unwrap(), func(e error) bool { return anyError(e, fn) })
+	}
+	return false
+}
+
+// retryError 只执行了一次时返回原始错误
+func retryError(attempts []*errorflow.RetryAttempt, cause error) error {
+	if len(attempts) == 1 && cause == nil {
+		return attempts[0].Err
+	}
+	return &errorflow.RetryError{Attempts: attempts, Cause: cause}
+}
+
+// attemptsError 执行失败时带上每次执行的记录，onerror: ignore 时记录到结果中，错误信息不变
+type attemptsError struct {
+	key      string
+	attempts []map[string]any
+	err      error
+}
+
+func (e *attemptsError) Error() string {
+	return e.err.Error()
+}
+
+func (e *attemptsError) Unwrap() error {
+	return e.err
+}
+
+// attemptsKey 记录执行次数的变量：有 id 时为 id，否则为 action 名称
+func (ac *Activity) attemptsKey() string {
+	return lo.Ternary(ac.Id != "", ac.Id, getActionKey(ac.Namespace, ac.Activity))
+}
+
+// recordAttempts 执行记录放到 {{key.attempts}} 中，action 没有 id 并且返回的不是对象时，返回值本身放在 action 名称下，不再记录
+func recordAttempts(vars map[string]any, key string, attempts []map[string]any) map[string]any {
+	keyVars, ok := vars[key].(map[string]any)
+	if !ok && vars[key] != nil {
+		return vars
+	}
+	vars[key] = lo.Assign(keyVars, map[string]any{Attempts: attempts})
+	return vars
+}
+
+func attemptList(attempts []*errorflow.RetryAttempt) []map[string]any {
+	return lo.Map(attempts, func(a *errorflow.RetryAttempt, _ int) map[string]any {
+		m := map[string]any{"attempt": a.Attempt}
+		if a.Err != nil {
+			m["error"] = a.Err.Error()
+		}
+		return m
+	})
+}
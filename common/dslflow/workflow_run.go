@@ -0,0 +1,447 @@
+package dslflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/magic-lib/workflow/common/errorflow"
+	"go.uber.org/multierr"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	runStateKey      struct{}
+	dependsChainKey  struct{}
+	stepFrameKey     struct{}
+	activityStartKey struct{} // 流程中的 activity 依赖执行完、开始执行主动作时调用
+	activityPathKey  struct{} // 正在执行的 activity 在流程中的路径
+
+	// runState 一次工作流执行过程中共享的状态，通过 context 传递给所有节点
+	runState struct {
+		workflow *Workflow
+		runID    string
+		args     map[string]any // 根节点的输入参数
+		mu       sync.Mutex
+		ids      map[string]*Activity        // activity id => activity
+		actions  map[string]*Activity        // namespace/activity => 第一个出现的 activity
+		calls    map[*Activity]*activityCall // 已经执行过的 activity，依赖只执行一次
+
+		stmtPaths  map[*Statement]string // 节点 => 路径，保存进度时使用
+		acPaths    map[*Activity]string  // activity => 路径
+		cpMu       sync.Mutex
+		checkpoint *Checkpoint               // 配置了 StateStore 时的执行进度
+		childPaths map[*ChildWorkflow]string // 子流程节点 => 路径
+		report     *RunReport                // 通过 ExecuteWithReport 执行时的执行报告
+		saga       *sagaScope                // 已执行成功的 activity 的补偿动作，子流程的挂在父流程中
+
+		background    sync.WaitGroup // onexit: exit 之后在后台继续执行的流程
+		backgroundMu  sync.Mutex
+		backgroundErr error // 后台流程的错误
+	}
+
+	// stepError 记录出错节点的路径，错误信息不变，只在最内层出错的节点包装一次
+	stepError struct {
+		path string
+		err  error
+	}
+
+	// stepFrame 正在执行的节点，子节点遇到 onexit: exit 后台继续执行时，所有上层节点都不能算执行完成
+	stepFrame struct {
+		parent   *stepFrame
+		detached atomic.Bool
+	}
+
+	// activityCall 一次 activity 执行，并发等待同一个依赖时共享结果
+	activityCall struct {
+		done         chan struct{}
+		result       map[string]any
+		err          error
+		byDependency bool // 作为依赖提前执行的，流程执行到它时直接使用结果
+	}
+)
+
+func newRunState(w *Workflow) *runState {
+	rs := &runState{
+		workflow: w,
+		ids:      make(map[string]*Activity),
+		actions:  make(map[string]*Activity),
+		calls:    make(map[*Activity]*activityCall),
+
+		stmtPaths: make(map[*Statement]string),
+		acPaths:   make(map[*Activity]string),
+
+		childPaths: make(map[*ChildWorkflow]string),
+	}
+	if w != nil {
+		walkStatementNodes("root", &w.Root, func(path string, s *Statement) {
+			rs.stmtPaths[s] = path
+			if s.Workflow != nil {
+				rs.childPaths[s.Workflow] = path + ".workflow"
+			}
+		})
+		walkStatement("root", &w.Root, func(path string, ac *Activity) {
+			if _, ok := rs.acPaths[ac]; !ok {
+				rs.acPaths[ac] = path
+			}
+			if ac.Id != "" {
+				if _, ok := rs.ids[ac.Id]; !ok {
+					rs.ids[ac.Id] = ac
+				}
+			}
+			actionKey := getActionKey(ac.Namespace, ac.Activity)
+			if resolved, err := resolveActivityTemplate(ac, w.Templates); err == nil {
+				actionKey = getActionKey(resolved.Namespace, resolved.Activity)
+			}
+			if _, ok := rs.actions[actionKey]; !ok {
+				rs.actions[actionKey] = ac
+			}
+		})
+	}
+	return rs
+}
+
+func withRunState(ctx context.Context, rs *runState) context.Context {
+	return context.WithValue(ctx, runStateKey{}, rs)
+}
+
+func getRunState(ctx context.Context) *runState {
+	if rs, ok := ctx.Value(runStateKey{}).(*runState); ok {
+		return rs
+	}
+	return nil
+}
+
+// getDependsChain 当前正在解析依赖的 activity 链，用来检测循环依赖
+func getDependsChain(ctx context.Context) []*Activity {
+	if chain, ok := ctx.Value(dependsChainKey{}).([]*Activity); ok {
+		return chain
+	}
+	return nil
+}
+
+func withDependsChain(ctx context.Context, chain []*Activity) context.Context {
+	return context.WithValue(ctx, dependsChainKey{}, chain)
+}
+
+// resolveDependency 按 id 或 namespace/activity 查找依赖的 activity
+// 工作流中没有定义时，按依赖的元数据直接执行已注册的 action
+func (rs *runState) resolveDependency(dep ActivityMetadata) *Activity {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if dep.Namespace == "" {
+		if ac, ok := rs.ids[dep.Activity]; ok {
+			return ac
+		}
+	}
+	actionKey := getActionKey(dep.Namespace, dep.Activity)
+	if ac, ok := rs.actions[actionKey]; ok {
+		return ac
+	}
+	ac := &Activity{ActivityMetadata: dep}
+	rs.actions[actionKey] = ac
+	return ac
+}
+
+// executeDependency 执行依赖的 activity，同一次执行中只会执行一次
+func (rs *runState) executeDependency(ctx context.Context, ac *Activity, args map[string]any) (map[string]any, error) {
+	rs.mu.Lock()
+	if call, ok := rs.calls[ac]; ok {
+		rs.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.result, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	call := &activityCall{done: make(chan struct{}), byDependency: true}
+	rs.calls[ac] = call
+	rs.mu.Unlock()
+
+	ctx = context.WithValue(ctx, activityStartKey{}, nil)
+	ctx = withBranchWrites(ctx, nil)
+	ctx, span := startSpan(ctx, "activity", "activity.id", ac.Id, "activity.dependency", true)
+	ctx, entry := rs.startActivityEntry(ctx, ac, true)
+	call.result, call.err = ac.execute(ctx, args)
+	entry.finish(call.err)
+	endSpan(span, call.err)
+	close(call.done)
+	return call.result, call.err
+}
+
+// takeDependencyResult 流程执行到已经作为依赖执行过的 activity 时，直接取出结果
+func (rs *runState) takeDependencyResult(ctx context.Context, ac *Activity) (*activityCall, bool) {
+	rs.mu.Lock()
+	call, ok := rs.calls[ac]
+	if !ok || !call.byDependency {
+		rs.mu.Unlock()
+		return nil, false
+	}
+	call.byDependency = false
+	rs.mu.Unlock()
+
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		return &activityCall{err: ctx.Err()}, true
+	}
+	return call, true
+}
+
+// startCall 流程中的 activity 开始执行主动作，执行结束前依赖它的 activity 等待这次执行的结果
+// 在依赖执行完之后才登记，互相依赖时由依赖链检测循环，不会互相等待
+func (rs *runState) startCall(ac *Activity, call *activityCall) {
+	rs.mu.Lock()
+	rs.calls[ac] = call
+	rs.mu.Unlock()
+}
+
+// recordResult 记录 activity 的执行结果，后面依赖它的 activity 不再重复执行
+func (rs *runState) recordResult(ac *Activity, result map[string]any, err error) {
+	call := &activityCall{done: make(chan struct{}), result: result, err: err}
+	close(call.done)
+
+	rs.mu.Lock()
+	rs.calls[ac] = call
+	rs.mu.Unlock()
+}
+
+// startBackground onexit: exit 之后的流程开始在后台执行，返回的函数在后台流程结束时调用
+func (rs *runState) startBackground(ctx context.Context) func(err error) {
+	finished := startBackground(ctx)
+	if rs == nil {
+		return func(error) { finished() }
+	}
+	rs.background.Add(1)
+	return func(err error) {
+		defer rs.background.Done()
+		finished()
+		if err != nil {
+			rs.backgroundMu.Lock()
+			rs.backgroundErr = multierr.Append(rs.backgroundErr, err)
+			rs.backgroundMu.Unlock()
+		}
+	}
+}
+
+// waitBackground 工作流已经以 exited 状态返回，等后台流程全部结束后记录最终的状态和错误
+func (rs *runState) waitBackground(ctx context.Context, result map[string]any) {
+	rs.background.Wait()
+	rs.backgroundMu.Lock()
+	err := rs.backgroundErr
+	rs.backgroundMu.Unlock()
+
+	status := RunStatusCompleted
+	if err != nil {
+		status, result = RunStatusFailed, nil
+		err = fmt.Errorf("workflow background execute failed: %w", err)
+	}
+	if saveErr := rs.finish(ctx, status, result, err); saveErr != nil {
+		logError(ctx, "save checkpoint failed", "error", saveErr)
+	}
+	rs.report.finish(status, err)
+	logInfo(ctx, "workflow background finished", "status", status, "error", err)
+}
+
+// withStepFrame 进入一个新的节点
+func withStepFrame(ctx context.Context) (context.Context, *stepFrame) {
+	parent, _ := ctx.Value(stepFrameKey{}).(*stepFrame)
+	frame := &stepFrame{parent: parent}
+	return context.WithValue(ctx, stepFrameKey{}, frame), frame
+}
+
+// markDetached 后续流程转到后台执行，当前节点以及所有上层节点都没有执行完
+func markDetached(ctx context.Context) {
+	frame, _ := ctx.Value(stepFrameKey{}).(*stepFrame)
+	for ; frame != nil; frame = frame.parent {
+		frame.detached.Store(true)
+	}
+}
+
+// RunID 获取当前执行的 runID，不在工作流中执行时为空
+func RunID(ctx context.Context) string {
+	if rs := getRunState(ctx); rs != nil {
+		return rs.runID
+	}
+	return ""
+}
+
+// newChildContext 子流程只继承父流程的取消、超时和调用方设置的值，执行状态相互独立
+func newChildContext(ctx context.Context) context.Context {
+	ctx = withDependsChain(ctx, nil)
+	ctx = context.WithValue(ctx, stepFrameKey{}, (*stepFrame)(nil))
+	ctx = withBranchWrites(ctx, nil)
+	return context.WithValue(ctx, loopIterationKey{}, "")
+}
+
+func (e *stepError) Error() string {
+	return e.err.Error()
+}
+
+func (e *stepError) Unwrap() error {
+	return e.err
+}
+
+// wrapStepError 给错误加上出错节点的路径，内层已经有路径时不再覆盖
+func (rs *runState) wrapStepError(ctx context.Context, s *Statement, err error) error {
+	if findStepError(err) != nil {
+		return err
+	}
+	path, ok := rs.statementPath(ctx, s)
+	if !ok {
+		return err
+	}
+	return &stepError{path: path, err: err}
+}
+
+// failedPath 获取最内层出错节点的路径
+func failedPath(err error) string {
+	if se := findStepError(err); se != nil {
+		return se.path
+	}
+	return ""
+}
+
+// findStepError 查找当前工作流中出错节点的路径，不进入子流程的错误
+func findStepError(err error) *stepError {
+	for err != nil {
+		switch e := err.(type) {
+		case *stepError:
+			return e
+		case *errorflow.ChildWorkflowError:
+			return nil
+		case interface{ Unwrap() []error }:
+			for _, one := range e.Unwrap() {
+				if se := findStepError(one); se != nil {
+					return se
+				}
+			}
+			return nil
+		}
+		err = errors.Unwrap(err)
+	}
+	return nil
+}
+
+// statementPath 节点的路径，循环中的节点带上下标
+func (rs *runState) statementPath(ctx context.Context, s *Statement) (string, bool) {
+	if rs == nil {
+		return "", false
+	}
+	path, ok := rs.stmtPaths[s]
+	if !ok {
+		return "", false
+	}
+	return path + loopIteration(ctx), true
+}
+
+// completedStatement Resume 时已经执行完的节点直接返回保存的结果
+func (rs *runState) completedStatement(ctx context.Context, s *Statement) (map[string]any, bool) {
+	if rs == nil || rs.checkpoint == nil {
+		return nil, false
+	}
+	path, ok := rs.statementPath(ctx, s)
+	if !ok {
+		return nil, false
+	}
+	rs.cpMu.Lock()
+	defer rs.cpMu.Unlock()
+	out, ok := rs.checkpoint.Statements[path]
+	return out, ok
+}
+
+// saveStatement 节点执行完后保存进度
+func (rs *runState) saveStatement(ctx context.Context, s *Statement, out map[string]any) error {
+	if rs == nil || rs.checkpoint == nil {
+		return nil
+	}
+	path, ok := rs.statementPath(ctx, s)
+	if !ok {
+		return nil
+	}
+	rs.cpMu.Lock()
+	defer rs.cpMu.Unlock()
+	rs.checkpoint.Statements[path] = out
+	rs.checkpoint.Variables = out
+	return rs.saveLocked(ctx)
+}
+
+// activityPath activity 在流程中的路径，不包括循环下标
+func (rs *runState) activityPath(ac *Activity) (string, bool) {
+	if rs == nil {
+		return "", false
+	}
+	path, ok := rs.acPaths[ac]
+	return path, ok
+}
+
+// completedActivity Resume 时已经执行成功的 update 类型 activity 不再重复执行
+func (rs *runState) completedActivity(ctx context.Context, ac *Activity) (map[string]any, bool) {
+	if rs == nil || rs.checkpoint == nil {
+		return nil, false
+	}
+	path, ok := rs.acPaths[ac]
+	if !ok {
+		return nil, false
+	}
+	path += loopIteration(ctx)
+	rs.cpMu.Lock()
+	defer rs.cpMu.Unlock()
+	out, ok := rs.checkpoint.Activities[path]
+	return out, ok
+}
+
+// saveActivity 保存执行成功的 update 类型 activity，query 类型没有副作用，Resume 时重新执行
+func (rs *runState) saveActivity(ctx context.Context, ac *Activity, out map[string]any) error {
+	if rs == nil || rs.checkpoint == nil {
+		return nil
+	}
+	path, ok := rs.acPaths[ac]
+	if !ok || !rs.isUpdateAction(ac) {
+		return nil
+	}
+	path += loopIteration(ctx)
+	rs.cpMu.Lock()
+	defer rs.cpMu.Unlock()
+	rs.checkpoint.Activities[path] = out
+	return rs.saveLocked(ctx)
+}
+
+func (rs *runState) isUpdateAction(ac *Activity) bool {
+	resolved, err := resolveActivityTemplate(ac, rs.workflow.Templates)
+	if err != nil {
+		return false
+	}
+	actIns, err := GetAction(resolved.Namespace, resolved.Activity)
+	if err != nil || actIns.ActionMetadata() == nil {
+		return false
+	}
+	return actIns.ActionMetadata().ActionType == ActionTypeUpdate
+}
+
+// finish 保存整个工作流的执行结果
+func (rs *runState) finish(ctx context.Context, status RunStatus, result map[string]any, runErr error) error {
+	if rs == nil || rs.checkpoint == nil {
+		return nil
+	}
+	rs.cpMu.Lock()
+	defer rs.cpMu.Unlock()
+	rs.checkpoint.Status = status
+	rs.checkpoint.Result = result
+	rs.checkpoint.Error = ""
+	if runErr != nil {
+		rs.checkpoint.Error = runErr.Error()
+	}
+	return rs.saveLocked(ctx)
+}
+
+func (rs *runState) saveLocked(ctx context.Context) error {
+	rs.checkpoint.UpdatedAt = time.Now()
+	if err := rs.workflow.Store.Save(context.WithoutCancel(ctx), rs.checkpoint); err != nil {
+		return fmt.Errorf("save checkpoint failed: %w", err)
+	}
+	return nil
+}
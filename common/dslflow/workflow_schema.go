@@ -0,0 +1,203 @@
+package dslflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/samber/lo"
+	"os"
+	"reflect"
+)
+
+//go:generate go run ./internal/schemagen workflow.schema.json
+
+const (
+	workflowSchemaDraft = "http://json-schema.org/draft-07/schema#"
+	durationPattern     = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+	secondsPattern      = `^([0-9]+(h|m|s))+$` // Activity.Timeout 只支持整秒
+)
+
+var (
+	lifecycleHooksType = reflect.TypeOf(LifecycleHooks{})
+	parallelModeType   = reflect.TypeOf(ParallelMode(""))
+
+	// schemaEnums 取值固定的字段，枚举值来自代码中的常量
+	schemaEnums = map[reflect.Type][]string{
+		reflect.TypeOf(OrderType("")):      enumStrings(orderTypeList),
+		reflect.TypeOf(OnErrorType("")):    enumStrings(onErrorTypeList),
+		reflect.TypeOf(OnExitType("")):     enumStrings(onExitTypeList),
+		reflect.TypeOf(LifecycleEvent("")): enumStrings(lifecycleEventList),
+		reflect.TypeOf(HookPolicy("")):     enumStrings(hookPolicyList),
+		reflect.TypeOf(CacheScope("")):     enumStrings(cacheScopeList),
+		reflect.TypeOf(ParallelMerge("")):  enumStrings(parallelMergeList),
+		reflect.TypeOf(ValidationMode("")): enumStrings(validationModeList),
+	}
+)
+
+// WorkflowJSONSchema 根据工作流的结构体定义生成 JSON Schema（draft-07），可以给 yaml-language-server 等编辑器插件使用
+// yaml 文件第一行加上 # yaml-language-server: $schema=<workflow.schema.json 的路径或地址> 即可获得补全和校验
+func WorkflowJSONSchema() ([]byte, error) {
+	b := &schemaBuilder{defs: make(map[string]any)}
+	root := b.typeSchema(reflect.TypeOf(Workflow{}))
+	schema := map[string]any{
+		"$schema":     workflowSchemaDraft,
+		"title":       "dslflow workflow",
+		"$ref":        root["$ref"],
+		"definitions": b.defs,
+	}
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal workflow schema failed: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// WriteWorkflowJSONSchema 生成 JSON Schema 并写入文件
+func WriteWorkflowJSONSchema(fileName string) error {
+	data, err := WorkflowJSONSchema()
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(fileName, data, 0o644); err != nil {
+		return fmt.Errorf("write workflow schema failed: %w", err)
+	}
+	return nil
+}
+
+// schemaBuilder 结构体按类型名放到 definitions 中，Statement 等递归结构通过 $ref 引用
+type schemaBuilder struct {
+	defs map[string]any
+}
+
+func (b *schemaBuilder) typeSchema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == durationType {
+		return durationSchema("duration, such as 50ms, 5s, 1m, or nanoseconds as an integer", durationPattern)
+	}
+	if t == parallelModeType {
+		return map[string]any{"anyOf": []any{
+			map[string]any{"enum": enumStrings(parallelModeList)},
+			map[string]any{"type": "string", "pattern": "^" + parallelModeQuorum + "[1-9][0-9]*$"},
+		}}
+	}
+	if values, ok := schemaEnums[t]; ok {
+		return map[string]any{"type": "string", "enum": values}
+	}
+	if t == lifecycleHooksType {
+		return b.define(t, b.hooksSchema)
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return b.define(t, b.structSchema)
+	case reflect.Map:
+		schema := map[string]any{"type": "object"}
+		if t.Elem().Kind() != reflect.Interface {
+			schema["additionalProperties"] = b.typeSchema(t.Elem())
+		}
+		return schema
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": b.typeSchema(t.Elem())}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	}
+	return map[string]any{}
+}
+
+// define 第一次遇到的类型先占位再生成，避免递归结构无限展开
+func (b *schemaBuilder) define(t reflect.Type, build func(t reflect.Type) map[string]any) map[string]any {
+	ref := map[string]any{"$ref": "#/definitions/" + t.Name()}
+	if _, ok := b.defs[t.Name()]; ok {
+		return ref
+	}
+	b.defs[t.Name()] = nil
+	b.defs[t.Name()] = build(t)
+	return ref
+}
+
+// structSchema 字段和 strictLoader 一致，不认识的字段报错，所有字段都可以写成 null
+func (b *schemaBuilder) structSchema(t reflect.Type) map[string]any {
+	fields := yamlFields(t)
+	properties := make(map[string]any, len(fields))
+	for name, field := range fields {
+		var schema map[string]any
+		switch {
+		case t == activityType && field.Name == "DependsOn":
+			schema = b.dependsOnSchema()
+		case t == activityType && field.Name == "Timeout":
+			schema = durationSchema("timeout in seconds, such as 30, or a duration of whole seconds, such as 30s", secondsPattern)
+		default:
+			schema = b.typeSchema(field.Type)
+		}
+		properties[name] = nullable(schema)
+	}
+	return map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
+
+// hooksSchema 钩子的 key 只能是生命周期事件
+func (b *schemaBuilder) hooksSchema(t reflect.Type) map[string]any {
+	hook := b.typeSchema(t.Elem())
+	events := enumStrings(lifecycleEventList)
+	properties := make(map[string]any, len(events))
+	for _, e := range events {
+		properties[e] = nullable(hook)
+	}
+	return map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"propertyNames":        map[string]any{"enum": events},
+		"additionalProperties": nullable(hook),
+	}
+}
+
+// dependsOnSchema 依赖支持名称、名称列表、{namespace,activity} 列表、流程节点列表
+func (b *schemaBuilder) dependsOnSchema() map[string]any {
+	return map[string]any{"anyOf": []any{
+		map[string]any{"type": "string"},
+		map[string]any{"type": "array", "items": map[string]any{"anyOf": []any{
+			map[string]any{"type": "string"},
+			b.typeSchema(reflect.TypeOf(ActivityMetadata{})),
+			b.typeSchema(statementType),
+		}}},
+	}}
+}
+
+func durationSchema(description string, pattern string) map[string]any {
+	return map[string]any{
+		"description": description,
+		"anyOf": []any{
+			map[string]any{"type": "integer"},
+			map[string]any{"type": "string", "pattern": pattern},
+		},
+	}
+}
+
+// nullable yaml 中只写了 key 没有值时为 null，和没有配置一样
+func nullable(schema map[string]any) map[string]any {
+	if typ, ok := schema["type"].(string); ok {
+		schema = lo.Assign(schema)
+		schema["type"] = []string{typ, "null"}
+		if values, ok := schema["enum"].([]string); ok {
+			schema["enum"] = append(append([]any{}, lo.ToAnySlice(values)...), nil)
+		}
+		return schema
+	}
+	return map[string]any{"anyOf": []any{schema, map[string]any{"type": "null"}}}
+}
+
+func enumStrings[T ~string](values []T) []string {
+	return lo.Map(values, func(v T, _ int) string { return string(v) })
+}
@@ -13,7 +13,10 @@ type (
 )
 
 // Execute 执行串行流程（按顺序执行每个子节点）
-func (seq Sequence) Execute(ctx context.Context, vars map[string]any) (map[string]any, error) {
+func (seq Sequence) Execute(ctx context.Context, vars map[string]any) (_ map[string]any, multiErr error) {
+	ctx, span := startSpan(ctx, "sequence", "sequence.length", len(seq))
+	defer func() { endSpan(span, multiErr) }()
+
 	// 需要复制参数列表，防止出现并发修改的问题
 	newVars := cloneMap(vars)
 
@@ -21,7 +24,6 @@ func (seq Sequence) Execute(ctx context.Context, vars map[string]any) (map[strin
 	defer cancel()
 
 	// 前面执行的结果，可能成为后面的参数
-	var multiErr error
 	for i, stmt := range seq {
 		// 检查上下文是否已取消
 		if ctx.Err() != nil {
@@ -42,10 +44,13 @@ func (seq Sequence) Execute(ctx context.Context, vars map[string]any) (map[strin
 			newVars = lo.Assign(newVars, resultVars)
 		}
 		if stmt.Control.shouldExitOnExecute() {
-			//后续流程异步执行
+			//后续流程异步执行，保留执行状态，后台执行的节点也会保存进度
+			markDetached(ctx)
+			finished := getRunState(ctx).startBackground(ctx)
 			goroutines.GoAsync(func(params ...any) {
-				asyncCtx := context.Background()
 				var multiErrTemp error
+				defer func() { finished(multiErrTemp) }()
+				asyncCtx := context.WithoutCancel(ctx)
 				index := params[0].(int)
 				newVarsTemp := params[1].(map[string]any)
 				for j := index + 1; j < len(seq); j++ {
@@ -2,6 +2,7 @@ package dslflow
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/magic-lib/go-plat-utils/goroutines"
 	"github.com/samber/lo"
@@ -10,17 +11,62 @@ import (
 
 type (
 	Statement struct {
-		Control  Control   `yaml:"control" json:"control,omitempty"`   //控制配置
-		Activity *Activity `yaml:"activity" json:"activity,omitempty"` //单个活动
-		Sequence Sequence  `yaml:"sequence" json:"sequence,omitempty"` //串行情况
-		Parallel Parallel  `yaml:"parallel" json:"parallel,omitempty"` //并发情况
+		Control  Control        `yaml:"control" json:"control,omitempty"`   //控制配置
+		Activity *Activity      `yaml:"activity" json:"activity,omitempty"` //单个活动
+		Sequence Sequence       `yaml:"sequence" json:"sequence,omitempty"` //串行情况
+		Parallel Parallel       `yaml:"parallel" json:"parallel,omitempty"` //并发情况
+		ForEach  *ForEach       `yaml:"foreach" json:"foreach,omitempty"`   //遍历集合，每个元素执行一次子节点
+		Switch   *Switch        `yaml:"switch" json:"switch,omitempty"`     //多分支条件，只执行第一个满足条件的分支
+		Loop     *Loop          `yaml:"loop" json:"loop,omitempty"`         //循环执行子节点，比如轮询异步任务的状态
+		Workflow *ChildWorkflow `yaml:"workflow" json:"workflow,omitempty"` //调用注册的子流程
+
+		ParallelPolicy *ParallelPolicy `yaml:"parallel_policy" json:"parallel_policy,omitempty"` //并发情况的执行策略：最大并发数、完成策略
 	}
 )
 
-// Execute 执行单个流程节点（核心流程控制逻辑）
-func (s *Statement) Execute(ctx context.Context, vars map[string]any) (map[string]any, error) {
+// Execute 执行单个流程节点，配置了 StateStore 时执行完保存进度，Resume 时已执行完的节点直接返回保存的结果
+func (s *Statement) Execute(ctx context.Context, vars map[string]any) (_ map[string]any, err error) {
+	rs := getRunState(ctx)
+	path, _ := rs.statementPath(ctx, s)
+	ctx, entry := rs.startStatementEntry(ctx, path)
+	defer func() {
+		if err != nil && s.Control.shouldIgnoreOnError() {
+			entry.mark(ReportIgnored, err)
+		}
+		entry.finish(err)
+	}()
+	if out, ok := rs.completedStatement(ctx, s); ok {
+		entry.mark(ReportCached, nil)
+		return out, nil
+	}
+
+	if path != "" {
+		ctx = withLogAttrs(ctx, "path", path)
+	}
+	ctx, span := startSpan(ctx, "statement", "path", path)
+	defer func() { endSpan(span, err) }()
+
+	ctx, frame := withStepFrame(ctx)
+	resultVars, err := s.execute(ctx, vars)
+	if err != nil {
+		return resultVars, rs.wrapStepError(ctx, s, err)
+	}
+	if frame.detached.Load() {
+		return resultVars, nil
+	}
+	if err = rs.saveStatement(ctx, s, resultVars); err != nil {
+		return resultVars, err
+	}
+	return resultVars, nil
+}
+
+// execute 核心流程控制逻辑
+func (s *Statement) execute(ctx context.Context, vars map[string]any) (map[string]any, error) {
 	checked, err := s.Control.checkControlCondition(ctx, vars)
 	if err != nil || !checked {
+		if err == nil {
+			currentReportEntry(ctx).mark(ReportSkipped, nil)
+		}
 		return vars, err
 	}
 
@@ -39,14 +85,28 @@ func (s *Statement) Execute(ctx context.Context, vars map[string]any) (map[strin
 		} else if orderName == sequence {
 			resultVarsTemp, err = s.Sequence.Execute(ctx, resultVars)
 		} else if orderName == parallel {
-			resultVarsTemp, err = s.Parallel.Execute(ctx, resultVars)
+			resultVarsTemp, err = s.Parallel.ExecuteWithPolicy(ctx, resultVars, s.ParallelPolicy)
+		} else if orderName == foreach {
+			resultVarsTemp, err = s.ForEach.Execute(ctx, resultVars)
+		} else if orderName == switcher {
+			resultVarsTemp, err = s.Switch.Execute(ctx, resultVars)
+		} else if orderName == loop {
+			resultVarsTemp, err = s.Loop.Execute(ctx, resultVars)
+		} else if orderName == subWorkflow {
+			resultVarsTemp, err = s.Workflow.Execute(ctx, resultVars)
 		}
 		if err != nil {
 			if s.Control.shouldIgnoreOnError() {
+				currentReportEntry(ctx).mark(ReportIgnored, err)
+				// 忽略的失败也记录每次执行的错误
+				var ae *attemptsError
+				if errors.As(err, &ae) {
+					resultVars = recordAttempts(resultVars, ae.key, ae.attempts)
+				}
 				return true
 			}
 			retErr = multierr.Append(retErr, fmt.Errorf("activity %s execute failed: %w", orderName, err))
-			fmt.Printf("警告：节点执行出错但继续流程: %v\n", err)
+			logError(ctx, "statement failed", "order", orderName, "error", err)
 			return false
 		} else {
 			if len(resultVarsTemp) > 0 {
@@ -54,22 +114,34 @@ func (s *Statement) Execute(ctx context.Context, vars map[string]any) (map[strin
 			}
 
 			if s.Control.shouldExitOnExecute() {
-				//后续流程异步执行
+				//后续流程异步执行，保留执行状态，后台执行的节点也会保存进度
+				markDetached(ctx)
+				finished := getRunState(ctx).startBackground(ctx)
 				goroutines.GoAsync(func(params ...any) {
-					asyncCtx := context.Background()
 					var multiErrTemp error
+					defer func() { finished(multiErrTemp) }()
+					asyncCtx := context.WithoutCancel(ctx)
 					indexTemp := params[0].(int)
 					newVarsTemp := params[1].(map[string]any)
 					activityExcByOrderTemp := params[2].([]OrderType)
 					for j := indexTemp + 1; j < len(activityExcByOrderTemp); j++ {
 						var err error
 						var resultVarsTemp map[string]any
+						orderName := activityExcByOrderTemp[j]
 						if orderName == activity {
 							resultVarsTemp, err = s.Activity.Execute(asyncCtx, newVarsTemp)
 						} else if orderName == sequence {
 							resultVarsTemp, err = s.Sequence.Execute(asyncCtx, newVarsTemp)
 						} else if orderName == parallel {
-							resultVarsTemp, err = s.Parallel.Execute(asyncCtx, newVarsTemp)
+							resultVarsTemp, err = s.Parallel.ExecuteWithPolicy(asyncCtx, newVarsTemp, s.ParallelPolicy)
+						} else if orderName == foreach {
+							resultVarsTemp, err = s.ForEach.Execute(asyncCtx, newVarsTemp)
+						} else if orderName == switcher {
+							resultVarsTemp, err = s.Switch.Execute(asyncCtx, newVarsTemp)
+						} else if orderName == loop {
+							resultVarsTemp, err = s.Loop.Execute(asyncCtx, newVarsTemp)
+						} else if orderName == subWorkflow {
+							resultVarsTemp, err = s.Workflow.Execute(asyncCtx, newVarsTemp)
 						}
 						if err != nil {
 							multiErrTemp = multierr.Append(multiErrTemp, fmt.Errorf("activity %s execute failed: %w", orderName, err))
@@ -0,0 +1,68 @@
+package dslflow
+
+import (
+	"context"
+	"fmt"
+	"github.com/samber/lo"
+)
+
+const (
+	defaultSwitchResultVar = "switch_case"
+	switchDefaultCase      = "default"
+)
+
+type (
+	// Switch 多分支条件，按顺序计算每个分支的条件，只执行第一个满足条件的分支，都不满足时执行 Default
+	Switch struct {
+		Cases     []*SwitchCase `yaml:"cases" json:"cases"`
+		Default   *Statement    `yaml:"default" json:"default,omitempty"`
+		ResultVar string        `yaml:"result_var" json:"result_var,omitempty"` // 记录执行的分支名称，默认 switch_case，没有分支执行时为空
+	}
+
+	// SwitchCase 单个分支
+	SwitchCase struct {
+		Name string     `yaml:"name" json:"name,omitempty"` // 分支名称，默认为 cases[下标]
+		When string     `yaml:"when" json:"when"`           // ruleengine 条件，支持模版 {{name}}
+		Do   *Statement `yaml:"do" json:"do"`               // 满足条件时执行的子节点
+	}
+)
+
+func (sw *Switch) resultVar() string {
+	return lo.Ternary(sw.ResultVar != "", sw.ResultVar, defaultSwitchResultVar)
+}
+
+func (c *SwitchCase) caseName(index int) string {
+	return lo.Ternary(c.Name != "", c.Name, fmt.Sprintf("cases[%d]", index))
+}
+
+// Execute 执行第一个满足条件的分支，执行的分支名称记录到 ResultVar 中
+func (sw *Switch) Execute(ctx context.Context, vars map[string]any) (map[string]any, error) {
+	for i, c := range sw.Cases {
+		if c == nil {
+			continue
+		}
+		matched, err := evalCondition(ctx, c.When, vars, vars)
+		if err != nil {
+			return vars, fmt.Errorf("switch case %s: %w", c.caseName(i), err)
+		}
+		if matched {
+			return sw.executeCase(ctx, vars, c.caseName(i), c.Do)
+		}
+	}
+	if sw.Default != nil {
+		return sw.executeCase(ctx, vars, switchDefaultCase, sw.Default)
+	}
+	return lo.Assign(vars, map[string]any{sw.resultVar(): ""}), nil
+}
+
+func (sw *Switch) executeCase(ctx context.Context, vars map[string]any, name string, do *Statement) (map[string]any, error) {
+	resultVars := vars
+	if do != nil {
+		var err error
+		resultVars, err = do.Execute(ctx, vars)
+		if err != nil {
+			return resultVars, fmt.Errorf("switch case %s: %w", name, err)
+		}
+	}
+	return lo.Assign(resultVars, map[string]any{sw.resultVar(): name}), nil
+}
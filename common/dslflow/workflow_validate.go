@@ -0,0 +1,551 @@
+package dslflow
+
+import (
+	"fmt"
+	"github.com/magic-lib/go-plat-utils/conv"
+	"github.com/magic-lib/go-plat-utils/templates/ruleengine"
+	"github.com/magic-lib/workflow/common/errorflow"
+	"github.com/samber/lo"
+	"go.uber.org/multierr"
+	"regexp"
+	"strings"
+)
+
+type (
+	// ActionRegistry 查找已注册的 action，静态校验时使用
+	ActionRegistry interface {
+		GetAction(ns string, activity string) (ActionInterface, error)
+	}
+
+	actionRegistryFunc func(ns string, activity string) (ActionInterface, error)
+)
+
+var (
+	// DefaultActionRegistry 通过 RegisterAction 注册的全局 action
+	DefaultActionRegistry ActionRegistry = actionRegistryFunc(GetAction)
+
+	templateRefRegexp = regexp.MustCompile(`{{\s*([^{}]*?)\s*}}`)
+	simpleRefRegexp   = regexp.MustCompile(`^\.?[\w\-/]+(\.[\w\-/]+|\[\d+])*$`)
+)
+
+func (f actionRegistryFunc) GetAction(ns string, activity string) (ActionInterface, error) {
+	return f(ns, activity)
+}
+
+// Validate 静态校验工作流定义，一次性返回所有问题，每个问题都带有节点路径
+// inputKeys 为调用 Execute 时会传入的参数名，Variables 中声明的变量会自动加入
+func (w *Workflow) Validate(registry ActionRegistry, inputKeys ...string) error {
+	if registry == nil {
+		registry = DefaultActionRegistry
+	}
+	v := &validator{
+		registry:  registry,
+		templates: w.Templates,
+		ids:       make(map[string]string),
+		idActs:    make(map[string]*Activity),
+		actions:   make(map[string]*Activity),
+	}
+
+	// 先收集所有 id，依赖中按名称引用时需要用到
+	walkStatement("root", &w.Root, func(path string, ac *Activity) {
+		actionKey := getActionKey(ac.Namespace, ac.Activity)
+		if resolved, err := resolveActivityTemplate(ac, w.Templates); err == nil {
+			actionKey = getActionKey(resolved.Namespace, resolved.Activity)
+		}
+		if _, ok := v.actions[actionKey]; !ok {
+			v.actions[actionKey] = ac
+		}
+		if ac.Id == "" {
+			return
+		}
+		if firstPath, ok := v.ids[ac.Id]; ok {
+			v.errorf(path, "duplicate activity id %q, first defined at %s", ac.Id, firstPath)
+			return
+		}
+		v.ids[ac.Id] = path
+		v.idActs[ac.Id] = ac
+	})
+
+	v.checkDependsOnCycle(&w.Root)
+
+	scope := newRefScope()
+	scope.add(inputKeys...)
+	scope.add(lo.Keys(w.Variables)...)
+
+	v.statement("root", &w.Root, scope)
+
+	for k, val := range w.Responses {
+		v.checkRefs(fmt.Sprintf("responses.%s", k), conv.String(val), scope)
+	}
+	return v.errs
+}
+
+type validator struct {
+	registry  ActionRegistry
+	templates map[string]*Activity
+	ids       map[string]string    // activity id 对应第一次出现的路径
+	idActs    map[string]*Activity // activity id 对应第一次出现的 activity
+	actions   map[string]*Activity // action 对应第一次出现的 activity，和执行时按名称解析依赖一致
+	errs      error
+}
+
+func (v *validator) errorf(path string, format string, args ...any) {
+	v.errs = multierr.Append(v.errs, &errorflow.DefinitionError{Path: path, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) statement(path string, s *Statement, scope *refScope) {
+	if s == nil {
+		v.errorf(path, "statement is nil")
+		return
+	}
+
+	seen := make(map[OrderType]bool)
+	for i, order := range s.Control.ExecutionOrder {
+		orderPath := fmt.Sprintf("%s.control.execution_order[%d]", path, i)
+		switch order {
+		case activity, sequence, parallel, foreach, switcher, loop, subWorkflow:
+		default:
+			v.errorf(orderPath, "invalid execution order %q, must be one of activity/sequence/parallel/foreach/switch/loop/workflow", order)
+			continue
+		}
+		if seen[order] {
+			v.errorf(orderPath, "duplicate execution order %q", order)
+		}
+		seen[order] = true
+	}
+
+	// 依赖在 when 之前执行，结果会合并到后续的参数中
+	for i, ac := range s.Control.DependsOn {
+		v.activity(fmt.Sprintf("%s.control.depends_on[%d]", path, i), ac, scope)
+	}
+	if s.Control.When != "" {
+		v.checkWhen(path+".control.when", s.Control.When, scope)
+	}
+
+	orderList := s.Control.resolveExecutionOrder(s)
+	if s.ParallelPolicy != nil && len(s.Parallel) == 0 {
+		v.errorf(path+".parallel_policy", "parallel_policy requires parallel")
+	}
+	if len(orderList) == 0 {
+		v.errorf(path, "empty statement, one of activity/sequence/parallel/foreach/switch/loop/workflow is required")
+		return
+	}
+	for _, order := range orderList {
+		switch order {
+		case activity:
+			v.activity(path+".activity", s.Activity, scope)
+		case sequence:
+			for i, stmt := range s.Sequence {
+				v.statement(fmt.Sprintf("%s.sequence[%d]", path, i), stmt, scope)
+			}
+		case parallel:
+			v.parallelPolicy(path+".parallel_policy", s.ParallelPolicy, len(s.Parallel))
+			// 并行分支之间互相看不到对方的结果，执行完后统一合并
+			branchScopes := make([]*refScope, 0, len(s.Parallel))
+			for i, stmt := range s.Parallel {
+				branchScope := scope.clone()
+				v.statement(fmt.Sprintf("%s.parallel[%d]", path, i), stmt, branchScope)
+				branchScopes = append(branchScopes, branchScope)
+			}
+			if s.ParallelPolicy != nil && s.ParallelPolicy.Merge == ParallelMergeNamespaced {
+				for i := range s.Parallel {
+					scope.add(s.Parallel.branchName(i))
+				}
+				break
+			}
+			for _, branchScope := range branchScopes {
+				scope.merge(branchScope)
+			}
+		case foreach:
+			v.forEach(path+".foreach", s.ForEach, scope)
+		case switcher:
+			v.switchCases(path+".switch", s.Switch, scope)
+		case loop:
+			v.loop(path+".loop", s.Loop, scope)
+		case subWorkflow:
+			v.childWorkflow(path+".workflow", s.Workflow, scope)
+		}
+	}
+}
+
+// retryPolicy 检查重试策略的取值范围
+func (v *validator) retryPolicy(path string, rp RetryPolicyConfig) {
+	if rp.MaximumAttempts < 0 {
+		v.errorf(path+".maximum_attempts", "maximum_attempts must not be negative")
+	}
+	if rp.InitialInterval < 0 || rp.MaximumInterval < 0 || rp.Deadline < 0 {
+		v.errorf(path, "initial_interval, maximum_interval and deadline must not be negative")
+	}
+	if rp.BackoffCoefficient != 0 && rp.BackoffCoefficient < 1 {
+		v.errorf(path+".backoff_coefficient", "backoff_coefficient must be at least 1")
+	}
+	if rp.Jitter < 0 || rp.Jitter > 1 {
+		v.errorf(path+".jitter", "jitter must be between 0 and 1")
+	}
+}
+
+// parallelPolicy 检查并行节点的执行策略
+func (v *validator) parallelPolicy(path string, policy *ParallelPolicy, branches int) {
+	if policy == nil {
+		return
+	}
+	if _, _, err := policy.resolve(branches); err != nil {
+		v.errorf(path+".mode", "%v", err)
+	}
+	if _, err := policy.mergeStrategy(); err != nil {
+		v.errorf(path+".merge", "%v", err)
+	}
+	if policy.MaxConcurrency < 0 {
+		v.errorf(path+".max_concurrency", "max_concurrency must not be negative")
+	}
+}
+
+// switchCases 每个分支的条件按顺序计算，分支的结果和并行分支一样统一合并
+func (v *validator) switchCases(path string, sw *Switch, scope *refScope) {
+	if len(sw.Cases) == 0 && sw.Default == nil {
+		v.errorf(path, "switch requires at least one case or default")
+	}
+	names := make(map[string]string)
+	branchScopes := make([]*refScope, 0, len(sw.Cases)+1)
+	for i, c := range sw.Cases {
+		casePath := fmt.Sprintf("%s.cases[%d]", path, i)
+		if c == nil {
+			v.errorf(casePath, "switch case is nil")
+			continue
+		}
+		name := c.caseName(i)
+		if firstPath, ok := names[name]; ok {
+			v.errorf(casePath+".name", "duplicate switch case name %q, first defined at %s", name, firstPath)
+		} else {
+			names[name] = casePath
+		}
+		if c.When == "" {
+			v.errorf(casePath+".when", "switch case when is empty")
+		} else {
+			v.checkWhen(casePath+".when", c.When, scope)
+		}
+		if c.Do == nil {
+			v.errorf(casePath+".do", "switch case do is empty")
+			continue
+		}
+		branchScope := scope.clone()
+		v.statement(casePath+".do", c.Do, branchScope)
+		branchScopes = append(branchScopes, branchScope)
+	}
+	if sw.Default != nil {
+		branchScope := scope.clone()
+		v.statement(path+".default", sw.Default, branchScope)
+		branchScopes = append(branchScopes, branchScope)
+	}
+	for _, branchScope := range branchScopes {
+		scope.merge(branchScope)
+	}
+	scope.add(sw.resultVar())
+}
+
+// loop while 在第一次执行前判断，只能使用上游的变量；until 在执行后判断，可以使用子节点的结果
+func (v *validator) loop(path string, l *Loop, scope *refScope) {
+	if l.While == "" && l.Until == "" {
+		v.errorf(path, "loop requires while or until")
+	}
+	if l.MaxIterations < 0 {
+		v.errorf(path+".max_iterations", "max_iterations must not be negative")
+	}
+	if l.Delay < 0 {
+		v.errorf(path+".delay", "delay must not be negative")
+	}
+	scope.add(l.indexVar())
+	if l.While != "" {
+		v.checkWhen(path+".while", l.While, scope)
+	}
+	if l.Do == nil {
+		v.errorf(path+".do", "loop do is empty")
+	} else {
+		v.statement(path+".do", l.Do, scope)
+	}
+	if l.Until != "" {
+		v.checkWhen(path+".until", l.Until, scope)
+	}
+}
+
+// childWorkflow 子流程必须已经注册，子流程本身的定义单独校验
+func (v *validator) childWorkflow(path string, cw *ChildWorkflow, scope *refScope) {
+	if cw.Name == "" {
+		v.errorf(path+".name", "workflow name is empty")
+	} else if _, err := GetWorkflow(cw.Name, cw.Version); err != nil {
+		v.errorf(path, "%v", err)
+	}
+	for k, val := range cw.Inputs {
+		v.checkRefs(fmt.Sprintf("%s.inputs.%s", path, k), conv.String(val), scope)
+	}
+	scope.add(cw.resultVar())
+}
+
+// forEach 子节点可以使用元素和下标变量，执行结果只通过 ResultVar 返回
+func (v *validator) forEach(path string, fe *ForEach, scope *refScope) {
+	items := strings.TrimSpace(fe.Items)
+	if items == "" {
+		v.errorf(path+".items", "foreach items is empty")
+	} else if m := templateRefRegexp.FindStringSubmatch(items); m != nil && m[0] == items {
+		v.checkRefs(path+".items", items, scope)
+	} else if _, err := toItemList(fe.Items, items); err != nil {
+		v.errorf(path+".items", "foreach items must be a template reference like {{list}} or a json array")
+	}
+	if fe.MaxConcurrency < 0 {
+		v.errorf(path+".max_concurrency", "max_concurrency must not be negative")
+	}
+	if fe.Do == nil {
+		v.errorf(path+".do", "foreach do is empty")
+	} else {
+		itemScope := scope.clone()
+		itemScope.add(fe.itemVar(), fe.indexVar())
+		v.statement(path+".do", fe.Do, itemScope)
+		scope.open = scope.open || itemScope.open
+	}
+	scope.add(fe.resultVar())
+}
+
+func (v *validator) activity(path string, ac *Activity, scope *refScope) {
+	if ac == nil {
+		v.errorf(path, "activity is nil")
+		return
+	}
+	if ac.Template != "" {
+		resolved, err := resolveActivityTemplate(ac, v.templates)
+		if err != nil {
+			v.errorf(path+".template", "%v", err)
+			return
+		}
+		ac = resolved
+	}
+	if ac.Activity == "" {
+		v.errorf(path, "activity name is empty")
+	}
+
+	var meta *ActionMetadata
+	if ac.Activity != "" {
+		actIns, err := v.registry.GetAction(ac.Namespace, ac.Activity)
+		if err != nil || actIns == nil {
+			v.errorf(path, "action %s is not registered", getActionKey(ac.Namespace, ac.Activity))
+		} else {
+			meta = actIns.ActionMetadata()
+		}
+	}
+
+	// 当前 activity 可以使用的参数：上游结果 + 默认参数 + 依赖的结果
+	local := scope.clone()
+	local.add(lo.Map(lo.Keys(ac.ArgsForce), func(k string, _ int) string { return refRoot(k) })...)
+	local.add(lo.Map(lo.Keys(ac.ArgsFallback), func(k string, _ int) string { return refRoot(k) })...)
+
+	switch deps := ac.DependsOn.(type) {
+	case nil:
+	case []ActivityMetadata:
+		for i, dep := range deps {
+			v.checkDependsOnName(fmt.Sprintf("%s.depends_on[%d]", path, i), dep)
+			local.add(v.dependencyOutputs(dep)...)
+		}
+	case Sequence:
+		for i, stmt := range deps {
+			v.statement(fmt.Sprintf("%s.depends_on[%d]", path, i), stmt, local)
+		}
+	default:
+		v.errorf(path+".depends_on", "unsupported depends_on type %T", deps)
+	}
+
+	v.checkRefs(path+".arguments", ac.Arguments, local)
+	v.retryPolicy(path+".retry_policy", ac.RetryPolicy)
+	if ac.CacheScope != "" && !lo.Contains(cacheScopeList, ac.CacheScope) {
+		v.errorf(path+".cache_scope", "invalid cache_scope %q, must be one of run/workflow/global", ac.CacheScope)
+	}
+	if ac.CacheTTL < 0 {
+		v.errorf(path+".cache_ttl", "cache_ttl must not be negative")
+	}
+	if ac.HookPolicy != "" && !lo.Contains(hookPolicyList, ac.HookPolicy) {
+		v.errorf(path+".hook_policy", "invalid hook_policy %q, must be one of ignore/abort", ac.HookPolicy)
+	}
+	if ac.Validation != "" && !lo.Contains(validationModeList, ac.Validation) {
+		v.errorf(path+".validation", "invalid validation %q, must be one of strict/warn/off", ac.Validation)
+	}
+
+	for _, e := range ac.Hooks.sortedEvents() {
+		if !isLifecycleEvent(e) {
+			v.errorf(fmt.Sprintf("%s.hooks.%s", path, e), "unknown lifecycle event %q", e)
+		}
+		hookScope := local.clone()
+		hookScope.add(Hook)
+		v.activity(fmt.Sprintf("%s.hooks.%s", path, e), ac.Hooks[e], hookScope)
+	}
+	if ac.Compensate != nil {
+		compensateScope := local.clone()
+		compensateScope.add(Compensation)
+		v.activity(path+".compensate", ac.Compensate, compensateScope)
+	}
+
+	// 执行后的结果：请求参数、id、action返回值
+	local.add(ac.Id, getActionKey(ac.Namespace, ac.Activity))
+	local.add(lo.Keys(createMap(ac.Arguments))...)
+	if meta == nil || len(meta.Responses) == 0 {
+		// action 没有声明返回结构，返回的 json 对象里有什么字段无法确定
+		local.open = true
+	} else {
+		for _, rc := range meta.Responses {
+			local.add(refRoot(rc.Name))
+		}
+	}
+
+	for k, val := range ac.Responses {
+		v.checkRefs(fmt.Sprintf("%s.responses.%s", path, k), conv.String(val), local)
+	}
+	for k := range ac.Responses {
+		local.add(refRoot(k))
+	}
+
+	scope.merge(local)
+}
+
+// checkDependsOnName 按名称的依赖必须是 workflow 中的 activity id，或者已注册的 action
+func (v *validator) checkDependsOnName(path string, dep ActivityMetadata) {
+	if dep.Namespace == "" {
+		if _, ok := v.ids[dep.Activity]; ok {
+			return
+		}
+	}
+	if _, err := v.registry.GetAction(dep.Namespace, dep.Activity); err != nil {
+		v.errorf(path, "depends_on %q is neither an activity id nor a registered action", getActionKey(dep.Namespace, dep.Activity))
+	}
+}
+
+// dependencyOutputs 按名称的依赖合并到当前 activity 的变量：依赖的 id、action 和声明的 responses
+func (v *validator) dependencyOutputs(dep ActivityMetadata) []string {
+	actionKey := getActionKey(dep.Namespace, dep.Activity)
+	depAc, ok := v.idActs[dep.Activity]
+	if dep.Namespace != "" || !ok {
+		if depAc, ok = v.actions[actionKey]; !ok {
+			return []string{actionKey}
+		}
+	}
+	if resolved, err := resolveActivityTemplate(depAc, v.templates); err == nil {
+		depAc = resolved
+	}
+	keys := []string{getActionKey(depAc.Namespace, depAc.Activity)}
+	if depAc.Id != "" {
+		keys = append(keys, depAc.Id)
+	}
+	for k := range depAc.Responses {
+		keys = append(keys, refRoot(k))
+	}
+	return keys
+}
+
+// checkDependsOnCycle 按 id 引用的依赖不能形成环
+func (v *validator) checkDependsOnCycle(root *Statement) {
+	ids := make(map[string]*Activity)
+	paths := make(map[*Activity]string)
+	activityList := make([]*Activity, 0)
+	walkStatement("root", root, func(path string, ac *Activity) {
+		if ac.Id != "" && ids[ac.Id] == nil {
+			ids[ac.Id] = ac
+		}
+		paths[ac] = path
+		activityList = append(activityList, ac)
+	})
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[*Activity]int)
+	var visit func(ac *Activity, chain []*Activity)
+	visit = func(ac *Activity, chain []*Activity) {
+		state[ac] = visiting
+		chain = append(chain, ac)
+		deps, _ := ac.DependsOn.([]ActivityMetadata)
+		for _, dep := range deps {
+			depAc, ok := ids[dep.Activity]
+			if dep.Namespace != "" || !ok {
+				continue
+			}
+			switch state[depAc] {
+			case visiting:
+				v.errorf(paths[ac]+".depends_on", "circular dependency: %s", dependsChainString(append(chain, depAc)))
+			case 0:
+				visit(depAc, chain)
+			}
+		}
+		state[ac] = visited
+	}
+	for _, ac := range activityList {
+		if state[ac] == 0 {
+			visit(ac, nil)
+		}
+	}
+}
+
+// checkWhen 条件中的模版会在执行前替换，这里先替换为常量再检查语法
+func (v *validator) checkWhen(path string, when string, scope *refScope) {
+	v.checkRefs(path, when, scope)
+
+	expr := templateRefRegexp.ReplaceAllString(when, "0")
+	if _, err := ruleengine.NewEngineLogic().Vars(expr); err != nil {
+		v.errorf(path, "invalid when expression %q: %v", when, err)
+	}
+}
+
+// checkRefs 检查模版中引用的变量是否有上游节点能够提供
+func (v *validator) checkRefs(path string, tpl string, scope *refScope) {
+	if scope.open || !strings.Contains(tpl, "{{") {
+		return
+	}
+	for _, m := range templateRefRegexp.FindAllStringSubmatch(tpl, -1) {
+		ref := m[1]
+		if !simpleRefRegexp.MatchString(ref) {
+			continue
+		}
+		if !scope.has(refRoot(ref)) {
+			v.errorf(path, "template reference {{%s}} is not produced by any upstream step", ref)
+		}
+	}
+}
+
+// refScope 当前节点可以引用的变量名（只记录第一级）
+type refScope struct {
+	keys map[string]struct{}
+	open bool // 上游有没有声明返回结构的 action，无法确定有哪些变量，不再检查引用
+}
+
+func newRefScope() *refScope {
+	return &refScope{keys: make(map[string]struct{})}
+}
+
+func (s *refScope) add(keys ...string) {
+	for _, k := range keys {
+		if k != "" {
+			s.keys[k] = struct{}{}
+		}
+	}
+}
+
+func (s *refScope) has(key string) bool {
+	_, ok := s.keys[key]
+	return ok
+}
+
+func (s *refScope) clone() *refScope {
+	return &refScope{keys: lo.Assign(s.keys), open: s.open}
+}
+
+func (s *refScope) merge(other *refScope) {
+	for k := range other.keys {
+		s.keys[k] = struct{}{}
+	}
+	s.open = s.open || other.open
+}
+
+// refRoot 获取引用路径的第一级，比如 .name.age[0] => name
+func refRoot(ref string) string {
+	ref = strings.TrimPrefix(ref, ".")
+	if idx := strings.IndexAny(ref, ".["); idx >= 0 {
+		return ref[:idx]
+	}
+	return ref
+}
@@ -0,0 +1,85 @@
+package dslflow
+
+import (
+	"fmt"
+	"sort"
+)
+
+type walker struct {
+	stmtFn func(path string, s *Statement)
+	acFn   func(path string, ac *Activity)
+}
+
+// walkStatement 深度遍历流程节点下的所有 activity，包括依赖、钩子和补偿中定义的 activity
+func walkStatement(path string, s *Statement, fn func(path string, ac *Activity)) {
+	(&walker{acFn: fn}).statement(path, s)
+}
+
+// walkStatementNodes 深度遍历流程节点下的所有节点，包括 activity 依赖中定义的节点
+func walkStatementNodes(path string, s *Statement, fn func(path string, s *Statement)) {
+	(&walker{stmtFn: fn}).statement(path, s)
+}
+
+func (w *walker) statement(path string, s *Statement) {
+	if s == nil {
+		return
+	}
+	if w.stmtFn != nil {
+		w.stmtFn(path, s)
+	}
+	for i, ac := range s.Control.DependsOn {
+		w.activity(fmt.Sprintf("%s.control.depends_on[%d]", path, i), ac)
+	}
+	w.activity(path+".activity", s.Activity)
+	for i, stmt := range s.Sequence {
+		w.statement(fmt.Sprintf("%s.sequence[%d]", path, i), stmt)
+	}
+	for i, stmt := range s.Parallel {
+		w.statement(fmt.Sprintf("%s.parallel[%d]", path, i), stmt)
+	}
+	if s.ForEach != nil {
+		w.statement(path+".foreach.do", s.ForEach.Do)
+	}
+	if s.Switch != nil {
+		for i, c := range s.Switch.Cases {
+			if c != nil {
+				w.statement(fmt.Sprintf("%s.switch.cases[%d].do", path, i), c.Do)
+			}
+		}
+		w.statement(path+".switch.default", s.Switch.Default)
+	}
+	if s.Loop != nil {
+		w.statement(path+".loop.do", s.Loop.Do)
+	}
+}
+
+// activity 遍历 activity 本身以及它的依赖、钩子、补偿动作
+func (w *walker) activity(path string, ac *Activity) {
+	if ac == nil {
+		return
+	}
+	if w.acFn != nil {
+		w.acFn(path, ac)
+	}
+	if seq, ok := ac.DependsOn.(Sequence); ok {
+		for i, stmt := range seq {
+			w.statement(fmt.Sprintf("%s.depends_on[%d]", path, i), stmt)
+		}
+	}
+	for _, e := range ac.Hooks.sortedEvents() {
+		w.activity(fmt.Sprintf("%s.hooks.%s", path, e), ac.Hooks[e])
+	}
+	w.activity(path+".compensate", ac.Compensate)
+}
+
+// sortedEvents 按名称排序的事件列表，保证遍历顺序稳定
+func (lhs LifecycleHooks) sortedEvents() []LifecycleEvent {
+	events := make([]LifecycleEvent, 0, len(lhs))
+	for e := range lhs {
+		events = append(events, e)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i] < events[j]
+	})
+	return events
+}
@@ -0,0 +1,182 @@
+package dslflow_test_all
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/magic-lib/workflow/common/dslflow"
+	"strings"
+	"testing"
+)
+
+// typedActionResult test/Typed 的返回，重复执行测试时 action 只注册一次
+var typedActionResult any
+
+func TestActionResponseTypes(t *testing.T) {
+	meta := &dslflow.ActionMetadata{
+		Namespace: "test",
+		Activity:  "Typed",
+		Responses: []dslflow.ReturnConfig{
+			{Name: "name", Type: "string", Required: true},
+			{Name: "age", Type: "int"},
+			{Name: "score", Type: "float64"},
+			{Name: "vip", Type: "bool"},
+			{Name: "tags", Type: "[]string"},
+			{Name: "user.address.city", Type: "string", Required: true},
+			{Name: "items.id", Type: "int", Required: true},
+			{Name: "items.0.sku", Type: "string"},
+			{Name: "extra", Type: "object"},
+		},
+	}
+	ai, err := dslflow.ChangeActionInterface[map[string]any, any](func(ctx context.Context, param map[string]any) (any, error) {
+		return typedActionResult, nil
+	}, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = dslflow.RegisterAction(ai)
+	ctx := context.Background()
+
+	typedActionResult = map[string]any{
+		"name": "tom", "age": 18, "score": 1.5, "vip": true, "tags": []string{"a"},
+		"user":  map[string]any{"address": map[string]any{"city": "sz"}},
+		"items": []any{map[string]any{"id": 1, "sku": "s1"}, map[string]any{"id": 2}},
+		"extra": map[string]any{},
+	}
+	if _, err = meta.Execute(ctx, map[string]any{}); err != nil {
+		t.Errorf("valid response: %v", err)
+	}
+
+	typedActionResult = map[string]any{
+		"name": 1, "age": "18", "score": "high", "vip": "yes", "tags": []any{"a", 2},
+		"user":  map[string]any{"address": map[string]any{}},
+		"items": []any{map[string]any{"id": "x", "sku": 1}, map[string]any{}},
+		"extra": []any{},
+	}
+	_, err = meta.Execute(ctx, map[string]any{})
+	if err == nil {
+		t.Fatal("invalid response should fail")
+	}
+	for _, want := range []string{
+		"name: expected string, got integer",
+		"age: expected int, got string",
+		"score: expected float64, got string",
+		"vip: expected bool, got string",
+		"tags[1]: expected string, got integer",
+		"user.address.city: required field is missing, expected string",
+		"items[0].id: expected int, got string",
+		"items[1].id: required field is missing, expected int",
+		"items[0].sku: expected string, got integer",
+		"extra: expected object, got array",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q should contain %q", err, want)
+		}
+	}
+
+	// 不是 json 对象的返回也要检查
+	typedActionResult = "ok"
+	if _, err = meta.Execute(ctx, map[string]any{}); err == nil || !strings.Contains(err.Error(), "expected an object response, got string") {
+		t.Errorf("non-object response: %v", err)
+	}
+
+	// 不支持的类型注册时报错
+	_, err = dslflow.ChangeActionInterface[map[string]any, any](func(ctx context.Context, param map[string]any) (any, error) {
+		return nil, nil
+	}, &dslflow.ActionMetadata{Activity: "BadType", Responses: []dslflow.ReturnConfig{{Name: "a", Type: "datetime"}}})
+	if err == nil || !strings.Contains(err.Error(), `unknown response type "datetime"`) {
+		t.Errorf("unknown type: %v", err)
+	}
+}
+
+func TestActionResponseCoerce(t *testing.T) {
+	meta := &dslflow.ActionMetadata{
+		Namespace: "test",
+		Activity:  "Coerce",
+		Responses: []dslflow.ReturnConfig{
+			{Name: "id", Type: "string", Coerce: true},
+			{Name: "count", Type: "int", Coerce: true},
+			{Name: "ok", Type: "bool", Coerce: true},
+			{Name: "ids", Type: "[]string", Coerce: true},
+			{Name: "name", Type: "int", Coerce: true},
+		},
+	}
+	ai, err := dslflow.ChangeActionInterface[map[string]any, map[string]any](func(ctx context.Context, param map[string]any) (map[string]any, error) {
+		return param, nil
+	}, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = dslflow.RegisterAction(ai)
+
+	ctx := context.Background()
+	ret, err := meta.Execute(ctx, map[string]any{"id": 12, "count": "3", "ok": "true", "ids": []any{1, "2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(ret)
+	if string(data) != `{"count":3,"id":"12","ids":["1","2"],"ok":true}` {
+		t.Errorf("coerced response = %s", data)
+	}
+	if _, err = meta.Execute(ctx, map[string]any{"name": "tom"}); err == nil || !strings.Contains(err.Error(), "name: expected int, got string") {
+		t.Errorf("name cannot be coerced: %v", err)
+	}
+}
+
+type coercedResponse struct {
+	Name  string `json:"name"`
+	Count any    `json:"count"`
+}
+
+// TestActionResponseKeepType 转换后的返回保持 action 返回的类型，返回字段都是可选时不检查非对象的返回
+func TestActionResponseKeepType(t *testing.T) {
+	ctx := context.Background()
+	structMeta := &dslflow.ActionMetadata{
+		Namespace: "test",
+		Activity:  "CoerceStruct",
+		Responses: []dslflow.ReturnConfig{{Name: "count", Type: "int", Coerce: true}},
+	}
+	ai, err := dslflow.ChangeActionInterface[map[string]any, coercedResponse](func(ctx context.Context, param map[string]any) (coercedResponse, error) {
+		return coercedResponse{Name: "tom", Count: param["count"]}, nil
+	}, structMeta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = dslflow.RegisterAction(ai)
+	ret, err := structMeta.Execute(ctx, map[string]any{"count": "3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := ret.(coercedResponse); !ok || got.Name != "tom" || got.Count != float64(3) {
+		t.Errorf("coerced response = %#v", ret)
+	}
+
+	stringMeta := &dslflow.ActionMetadata{
+		Namespace: "test",
+		Activity:  "CoerceString",
+		Responses: []dslflow.ReturnConfig{{Name: "count", Type: "int", Coerce: true}},
+	}
+	if ai, err = dslflow.ChangeActionInterface[map[string]any, string](func(ctx context.Context, param map[string]any) (string, error) {
+		return `{"count":"3"}`, nil
+	}, stringMeta); err != nil {
+		t.Fatal(err)
+	}
+	_ = dslflow.RegisterAction(ai)
+	if ret, err = stringMeta.Execute(ctx, map[string]any{}); err != nil || ret != `{"count":3}` {
+		t.Errorf("coerced json string = %#v, %v", ret, err)
+	}
+
+	optionalMeta := &dslflow.ActionMetadata{
+		Namespace: "test",
+		Activity:  "Optional",
+		Responses: []dslflow.ReturnConfig{{Name: "count", Type: "int"}},
+	}
+	if ai, err = dslflow.ChangeActionInterface[map[string]any, string](func(ctx context.Context, param map[string]any) (string, error) {
+		return "ok", nil
+	}, optionalMeta); err != nil {
+		t.Fatal(err)
+	}
+	_ = dslflow.RegisterAction(ai)
+	if ret, err = optionalMeta.Execute(ctx, map[string]any{}); err != nil || ret != "ok" {
+		t.Errorf("optional fields with non-object response = %#v, %v", ret, err)
+	}
+}
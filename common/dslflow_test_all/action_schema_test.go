@@ -0,0 +1,115 @@
+package dslflow_test_all
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/magic-lib/workflow/common/dslflow"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type (
+	schemaAddress struct {
+		City string   `json:"city" validate:"required"`
+		Tags []string `json:"tags,omitempty"`
+	}
+	schemaBase struct {
+		TraceId string `json:"trace_id"`
+	}
+	schemaRequest struct {
+		schemaBase
+		Id      int            `json:"id" binding:"required" description:"订单 id"`
+		Amount  float64        `json:"amount"`
+		Address *schemaAddress `json:"address,omitempty"`
+		Extra   map[string]int `json:"extra,omitempty"`
+		Secret  string         `json:"-"`
+	}
+	schemaResponse struct {
+		Name      string    `json:"name" validate:"required"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+)
+
+func TestActionJSONSchema(t *testing.T) {
+	meta := &dslflow.ActionMetadata{Namespace: "test", Activity: "Schema"}
+	ai, err := dslflow.ChangeActionInterface[schemaRequest, *schemaResponse](func(ctx context.Context, req schemaRequest) (*schemaResponse, error) {
+		if req.Id < 0 {
+			return nil, nil
+		}
+		return &schemaResponse{Name: "order", CreatedAt: time.Unix(0, 0)}, nil
+	}, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = dslflow.RegisterAction(ai)
+
+	if meta.ResponseType != reflect.TypeOf(&schemaResponse{}) {
+		t.Errorf("response type = %v", meta.ResponseType)
+	}
+	argSchema, _ := json.Marshal(meta.ArgumentSchema)
+	if want := `{"properties":{` +
+		`"address":{"properties":{"city":{"type":"string"},"tags":{"items":{"type":"string"},"type":"array"}},"required":["city"],"type":["object","null"]},` +
+		`"amount":{"type":"number"},` +
+		`"extra":{"additionalProperties":{"type":"integer"},"type":"object"},` +
+		`"id":{"description":"订单 id","type":"integer"},` +
+		`"trace_id":{"type":"string"}},` +
+		`"required":["id"],"type":"object"}`; string(argSchema) != want {
+		t.Errorf("argument schema = %s\nwant %s", argSchema, want)
+	}
+	respSchema, _ := json.Marshal(meta.ResponseSchema)
+	if want := `{"properties":{"created_at":{"format":"date-time","type":"string"},"name":{"type":"string"}},"required":["name"],"type":["object","null"]}`; string(respSchema) != want {
+		t.Errorf("response schema = %s", respSchema)
+	}
+	// GetAllAction 的使用方通过 json 拿到 schema
+	data, _ := json.Marshal(dslflow.GetAllAction()["test/Schema"].ActionMetadata())
+	if !strings.Contains(string(data), `"argument_schema":{`) || !strings.Contains(string(data), `"response_schema":{`) {
+		t.Errorf("metadata json: %s", data)
+	}
+
+	ctx := context.Background()
+	if _, err = meta.Execute(ctx, `{"id":1,"address":{"city":"sz"},"extra":{"a":1}}`); err != nil {
+		t.Errorf("valid arguments: %v", err)
+	}
+	if _, err = meta.Execute(ctx, map[string]any{"id": 2, "amount": 1.5}); err != nil {
+		t.Errorf("valid map arguments: %v", err)
+	}
+	_, err = meta.Execute(ctx, `{"id":1.5,"amount":"x","address":{"tags":[1]},"extra":{"a":"b"}}`)
+	if err == nil {
+		t.Fatal("invalid arguments should fail")
+	}
+	for _, want := range []string{
+		"$.id: expected integer, got number",
+		"$.amount: expected number, got string",
+		"$.address.city: required field is missing",
+		"$.address.tags[0]: expected string, got integer",
+		"$.extra.a: expected integer, got string",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q should contain %q", err, want)
+		}
+	}
+	if _, err = meta.Execute(ctx, `{"amount":1}`); err == nil || !strings.Contains(err.Error(), "$.id: required field is missing") {
+		t.Errorf("missing id: %v", err)
+	}
+
+	// 手动配置的 schema 不会被覆盖，返回数据也按 schema 检查
+	custom := &dslflow.ActionMetadata{
+		Namespace: "test", Activity: "SchemaCustom",
+		ResponseSchema: dslflow.JSONSchema{"type": "object", "required": []any{"code"}},
+	}
+	ai, err = dslflow.ChangeActionInterface[map[string]any, map[string]any](func(ctx context.Context, param map[string]any) (map[string]any, error) {
+		return param, nil
+	}, custom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = dslflow.RegisterAction(ai)
+	if _, err = custom.Execute(ctx, map[string]any{"code": 0}); err != nil {
+		t.Errorf("custom schema: %v", err)
+	}
+	if _, err = custom.Execute(ctx, map[string]any{"msg": "x"}); err == nil || !strings.Contains(err.Error(), "$.code: required field is missing") {
+		t.Errorf("custom schema should reject response: %v", err)
+	}
+}
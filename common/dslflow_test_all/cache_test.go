@@ -0,0 +1,241 @@
+package dslflow_test_all
+
+import (
+	"context"
+	"fmt"
+	"github.com/magic-lib/go-plat-utils/conv"
+	"github.com/magic-lib/workflow/common/dslflow"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var (
+	lookupActionOnce sync.Once
+	lookupCounter    atomic.Int32
+)
+
+// registerLookupAction 注册一个执行较慢的查询 action，记录执行次数
+func registerLookupAction(t testing.TB) {
+	lookupActionOnce.Do(func() {
+		registerTestAction(t, func(ctx context.Context, param map[string]any) (map[string]any, error) {
+			lookupCounter.Add(1)
+			time.Sleep(20 * time.Millisecond)
+			return map[string]any{"owner": "owner-" + conv.String(param["id"])}, nil
+		}, &dslflow.ActionMetadata{Namespace: "test", Activity: "Lookup"})
+	})
+}
+
+// localCache 代替 redis 的本地缓存，只保存字符串
+type localCache struct {
+	mu   sync.Mutex
+	data map[string]string
+	ttl  map[string]time.Duration
+}
+
+func newLocalCache() *localCache {
+	return &localCache{data: make(map[string]string), ttl: make(map[string]time.Duration)}
+}
+
+func (c *localCache) Get(_ context.Context, key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.data[key], nil
+}
+
+func (c *localCache) Set(_ context.Context, key string, val string, timeout time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data[key] = val
+	c.ttl[key] = timeout
+	return true, nil
+}
+
+func (c *localCache) Del(_ context.Context, key string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.data, key)
+	return true, nil
+}
+
+// cacheWorkflow 三个并行分支用相同的 id 查询，trace 不同
+func cacheWorkflow(t *testing.T, scope string) *dslflow.Workflow {
+	branch := `
+    - activity:
+        namespace: test
+        activity: Lookup
+        arguments: '{"id":"{{id}}","trace":"%d"}'
+        cached: true
+        cache_scope: ` + scope + `
+        cache_ttl: 1m
+        cache_key: "{{id}}"`
+	wf, err := dslflow.LoadWorkflowBytes([]byte("root:\n  parallel:" + fmt.Sprintf(branch, 1) + fmt.Sprintf(branch, 2) + fmt.Sprintf(branch, 3) + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = wf.Validate(nil, "id"); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	return wf
+}
+
+func TestActivityCacheScope(t *testing.T) {
+	registerLookupAction(t)
+
+	execute := func(wf *dslflow.Workflow, id string) {
+		ret, err := wf.Execute(context.Background(), map[string]any{"id": id})
+		if err != nil || ret["owner"] != "owner-"+id {
+			t.Errorf("execute: %v, %v", ret, err)
+		}
+	}
+
+	// 并发的相同请求只执行一次，下一次执行不复用
+	lookupCounter.Store(0)
+	wf := cacheWorkflow(t, "run")
+	execute(wf, "run-1")
+	if lookupCounter.Load() != 1 {
+		t.Errorf("run scope: executed %d times in one run, want 1", lookupCounter.Load())
+	}
+	execute(wf, "run-1")
+	if lookupCounter.Load() != 2 {
+		t.Errorf("run scope: executed %d times in two runs, want 2", lookupCounter.Load())
+	}
+
+	lookupCounter.Store(0)
+	wf = cacheWorkflow(t, "workflow")
+	wf.Name = "cache-workflow"
+	execute(wf, "wf-1")
+	execute(wf, "wf-1")
+	other := cacheWorkflow(t, "workflow")
+	other.Name = "other-workflow"
+	execute(other, "wf-1")
+	if lookupCounter.Load() != 2 {
+		t.Errorf("workflow scope: executed %d times, want 2", lookupCounter.Load())
+	}
+
+	lookupCounter.Store(0)
+	execute(cacheWorkflow(t, "global"), "global-1")
+	execute(cacheWorkflow(t, "global"), "global-1")
+	if lookupCounter.Load() != 1 {
+		t.Errorf("global scope: executed %d times, want 1", lookupCounter.Load())
+	}
+}
+
+func TestActivityCacheBackend(t *testing.T) {
+	registerLookupAction(t)
+	lookupCounter.Store(0)
+
+	backend := newLocalCache()
+	wf := cacheWorkflow(t, "global")
+	wf.Cache = backend
+	for i := 0; i < 2; i++ {
+		ret, err := wf.Execute(context.Background(), map[string]any{"id": "backend-1"})
+		if err != nil || ret["owner"] != "owner-backend-1" {
+			t.Errorf("execute: %v, %v", ret, err)
+		}
+	}
+	if lookupCounter.Load() != 1 || len(backend.data) != 1 {
+		t.Fatalf("executed %d times, cached %v", lookupCounter.Load(), backend.data)
+	}
+	for k, ttl := range backend.ttl {
+		if !strings.HasPrefix(k, "dslflow:global:test/Lookup:") || ttl != time.Minute {
+			t.Errorf("key = %s, ttl = %v", k, ttl)
+		}
+	}
+
+	wf.Root.Parallel[0].Activity.CacheScope = "tenant"
+	if err := wf.Validate(nil, "id"); err == nil {
+		t.Error("want invalid cache_scope error")
+	}
+}
+
+var (
+	stockActionOnce sync.Once
+	stockCounter    atomic.Int32
+)
+
+// registerStockActions 注册库存查询，以及会使库存缓存失效的预占和不相关的支付
+func registerStockActions(t testing.TB) {
+	stockActionOnce.Do(func() {
+		registerTestAction(t, func(ctx context.Context, param map[string]any) (map[string]any, error) {
+			return map[string]any{"stock": 10 - stockCounter.Add(1)}, nil
+		}, &dslflow.ActionMetadata{ActionType: dslflow.ActionTypeQuery, Namespace: "inventory", Activity: "Stock", CacheTags: []string{"stock"}})
+		registerTestAction(t, func(ctx context.Context, param map[string]any) (map[string]any, error) {
+			return map[string]any{"reserved": true}, nil
+		}, &dslflow.ActionMetadata{ActionType: dslflow.ActionTypeUpdate, Namespace: "order", Activity: "Reserve", Invalidates: []string{"stock"}})
+		registerTestAction(t, func(ctx context.Context, param map[string]any) (map[string]any, error) {
+			return map[string]any{"paid": true}, nil
+		}, &dslflow.ActionMetadata{ActionType: dslflow.ActionTypeUpdate, Namespace: "billing", Activity: "Pay"})
+	})
+}
+
+func TestActivityCacheInvalidation(t *testing.T) {
+	registerStockActions(t)
+	stockCounter.Store(0)
+
+	stockStep := `
+    - activity:
+        namespace: inventory
+        activity: Stock
+        arguments: '{"sku":"{{sku}}"}'
+        cached: true`
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  sequence:` + stockStep + stockStep + `
+    - activity:
+        namespace: billing
+        activity: Pay` + stockStep + `
+    - activity:
+        namespace: order
+        activity: Reserve` + stockStep + `
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wf.Cache = newLocalCache()
+	ret, err := wf.Execute(context.Background(), map[string]any{"sku": "A1"})
+	fmt.Println(ret, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 支付不影响库存缓存，预占后重新查询
+	if stockCounter.Load() != 2 || conv.String(ret["stock"]) != "8" {
+		t.Errorf("stock queried %d times, stock = %v", stockCounter.Load(), ret["stock"])
+	}
+}
+
+// cache_key 引用的参数不存在时不缓存，不会退回使用全部参数
+func TestActivityCacheKeyNotFound(t *testing.T) {
+	registerLookupAction(t)
+	lookupCounter.Store(0)
+
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  activity:
+    namespace: test
+    activity: Lookup
+    arguments: '{"id":"{{id}}"}'
+    cached: true
+    cache_scope: global
+    cache_key: "{{order_id}}"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := newLocalCache()
+	wf.Cache = backend
+	for i := 0; i < 2; i++ {
+		ret, err := wf.Execute(context.Background(), map[string]any{"id": "not-found-1"})
+		if err != nil || ret["owner"] != "owner-not-found-1" {
+			t.Errorf("execute: %v, %v", ret, err)
+		}
+	}
+	if lookupCounter.Load() != 2 {
+		t.Errorf("executed %d times, want 2", lookupCounter.Load())
+	}
+	if len(backend.data) != 0 {
+		t.Errorf("cached %v, want nothing", backend.data)
+	}
+}
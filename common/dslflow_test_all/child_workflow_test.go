@@ -0,0 +1,127 @@
+package dslflow_test_all
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/magic-lib/workflow/common/dslflow"
+	"github.com/magic-lib/workflow/common/errorflow"
+	"sync"
+	"testing"
+	"time"
+)
+
+var childWorkflowOnce sync.Once
+
+// registerChildWorkflows 注册测试用的子流程：cd-delete 按参数决定是否失败，cd-wait 一直轮询
+func registerChildWorkflows(t *testing.T) {
+	childWorkflowOnce.Do(func() {
+		child, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  sequence:
+    - activity:
+        namespace: test
+        activity: Record
+        arguments: '{"project":"{{project}}"}'
+    - switch:
+        cases:
+          - when: "'{{fail}}' == 'true'"
+            do:
+              activity:
+                namespace: test
+                activity: Fail
+responses:
+  deleted_project: "{{project}}"
+`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = dslflow.RegisterWorkflow("cd-delete", "v1", child); err != nil {
+			t.Fatal(err)
+		}
+
+		wait, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  loop:
+    while: "true"
+    delay: 1s
+    do:
+      activity:
+        namespace: test
+        activity: Record
+`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = dslflow.RegisterWorkflow("cd-wait", "", wait); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestChildWorkflow(t *testing.T) {
+	registerHookActions(t)
+	registerChildWorkflows(t)
+
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  workflow:
+    name: cd-delete
+    inputs:
+      project: "{{project_name}}"
+      fail: "{{fail}}"
+    result_var: deleted
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = wf.Validate(nil, "project_name", "fail"); err != nil {
+		t.Errorf("validate: %v", err)
+	}
+
+	ret, err := wf.Execute(context.Background(), map[string]any{"project_name": "p1", "fail": false})
+	fmt.Println(ret, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted, _ := ret["deleted"].(map[string]any)
+	if deleted["deleted_project"] != "p1" {
+		t.Errorf("deleted = %v", ret["deleted"])
+	}
+
+	_, err = wf.ExecuteRun(context.Background(), "parent-1", map[string]any{"project_name": "p1", "fail": true})
+	fmt.Println(err)
+	var ce *errorflow.ChildWorkflowError
+	if !errors.As(err, &ce) {
+		t.Fatalf("want child workflow error, got %v", err)
+	}
+	if ce.RunID != "parent-1#root.workflow" || ce.Path != "root.sequence[1].switch.cases[0].do" {
+		t.Errorf("run id = %s, path = %s", ce.RunID, ce.Path)
+	}
+}
+
+func TestChildWorkflowCancel(t *testing.T) {
+	registerHookActions(t)
+	registerChildWorkflows(t)
+
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  workflow:
+    name: cd-wait
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = wf.Execute(ctx, map[string]any{})
+	fmt.Println(err)
+	if !errors.Is(err, context.DeadlineExceeded) || !errorflow.IsChildWorkflowError(err) {
+		t.Errorf("want child workflow deadline error, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("child workflow is not cancelled with parent")
+	}
+}
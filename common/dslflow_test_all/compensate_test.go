@@ -0,0 +1,208 @@
+package dslflow_test_all
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/magic-lib/go-plat-utils/conv"
+	"github.com/magic-lib/workflow/common/dslflow"
+	"github.com/magic-lib/workflow/common/errorflow"
+	"github.com/samber/lo"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestSagaCompensation(t *testing.T) {
+	registerHookActions(t)
+	hookRecords = nil
+
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  sequence:
+    - activity:
+        id: charge
+        namespace: test
+        activity: Record
+        arguments: '{"step":"charge","amount":"{{amount}}"}'
+        compensate:
+          namespace: test
+          activity: Record
+          arguments: '{"step":"refund","amount":"{{compensation.arguments.amount}}","charged":"{{compensation.responses.step}}"}'
+    - parallel:
+        - activity:
+            id: reserve-a
+            namespace: test
+            activity: Record
+            arguments: '{"step":"reserve-a"}'
+            compensate:
+              namespace: test
+              activity: Record
+              arguments: '{"step":"release-a"}'
+        - activity:
+            id: reserve-b
+            namespace: test
+            activity: Record
+            arguments: '{"step":"reserve-b"}'
+            compensate:
+              namespace: test
+              activity: Fail
+    - activity:
+        id: ship
+        namespace: test
+        activity: Fail
+        compensate:
+          namespace: test
+          activity: Record
+          arguments: '{"step":"unship"}'
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = wf.Validate(nil, "amount"); err != nil {
+		t.Errorf("validate: %v", err)
+	}
+
+	_, err = wf.Execute(context.Background(), map[string]any{"amount": 100})
+	fmt.Println(err)
+	var ce *errorflow.CompensationError
+	if !errors.As(err, &ce) {
+		t.Fatalf("want compensation error, got %v", err)
+	}
+	if len(ce.Failures) != 1 || ce.Failures[0].Activity != "reserve-b" {
+		t.Errorf("failures = %v", ce)
+	}
+
+	steps := make([]string, 0)
+	for _, record := range hookRecords {
+		steps = append(steps, conv.String(record["step"]))
+	}
+	fmt.Println(steps)
+	// ship 执行失败不需要补偿；并行分支补偿完成后才补偿 charge
+	if len(steps) != 5 || steps[3] != "release-a" || steps[4] != "refund" {
+		t.Fatalf("steps = %v", steps)
+	}
+	refund := hookRecords[4]
+	if conv.String(refund["amount"]) != "100" || refund["charged"] != "charge" {
+		t.Errorf("refund = %v", refund)
+	}
+}
+
+var sagaChildOnce sync.Once
+
+// registerSagaChild 注册一个带补偿动作的子流程
+func registerSagaChild(t *testing.T) {
+	sagaChildOnce.Do(func() {
+		child, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  activity:
+    namespace: test
+    activity: Record
+    arguments: '{"step":"child-charge"}'
+    compensate:
+      namespace: test
+      activity: Record
+      arguments: '{"step":"child-refund"}'
+`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = dslflow.RegisterWorkflow("saga-child", "", child); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+const sagaParentWorkflow = `
+root:
+  sequence:
+    - activity:
+        id: charge
+        namespace: test
+        activity: Record
+        arguments: '{"step":"charge"}'
+        compensate:
+          namespace: test
+          activity: Record
+          arguments: '{"step":"refund"}'
+    - workflow:
+        name: saga-child
+    - activity:
+        namespace: test
+        activity: Fail
+`
+
+func recordedSteps() []string {
+	hookMu.Lock()
+	defer hookMu.Unlock()
+	return lo.Map(hookRecords, func(record map[string]any, _ int) string { return conv.String(record["step"]) })
+}
+
+// TestSagaCompensationChild 子流程执行成功后父流程失败，子流程中的 activity 也要补偿
+func TestSagaCompensationChild(t *testing.T) {
+	registerHookActions(t)
+	registerSagaChild(t)
+	hookRecords = nil
+
+	wf, err := dslflow.LoadWorkflowBytes([]byte(sagaParentWorkflow))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = wf.Execute(context.Background(), map[string]any{})
+	if err == nil {
+		t.Fatal("want error")
+	}
+	want := []string{"charge", "child-charge", "child-refund", "refund"}
+	if steps := recordedSteps(); !reflect.DeepEqual(steps, want) {
+		t.Errorf("steps = %v, want %v", steps, want)
+	}
+}
+
+// crashStateStore 只保存执行中的进度，模拟进程在工作流失败前退出
+type crashStateStore struct {
+	*dslflow.MemoryStateStore
+}
+
+func (c *crashStateStore) Save(ctx context.Context, cp *dslflow.Checkpoint) error {
+	if cp.Status != dslflow.RunStatusRunning {
+		return nil
+	}
+	return c.MemoryStateStore.Save(ctx, cp)
+}
+
+// TestSagaCompensationResume Resume 时不再执行的 activity 和子流程，失败时也要补偿
+func TestSagaCompensationResume(t *testing.T) {
+	registerHookActions(t)
+	registerSagaChild(t)
+	hookRecords = nil
+
+	wf, err := dslflow.LoadWorkflowBytes([]byte(sagaParentWorkflow))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &crashStateStore{MemoryStateStore: dslflow.NewMemoryStateStore()}
+	wf.Store = store
+	if _, err = wf.ExecuteRun(context.Background(), "saga-1", map[string]any{}); err == nil {
+		t.Fatal("want error")
+	}
+	cp, err := store.Load(context.Background(), "saga-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := lo.Map(cp.Compensations, func(r *dslflow.CompensationRecord, _ int) string { return r.Key })
+	fmt.Println(keys)
+	if len(keys) != 2 || keys[1] != "root.sequence[1].workflow#root.activity" {
+		t.Errorf("compensation keys = %v", keys)
+	}
+
+	hookRecords = nil
+	_, err = wf.Resume(context.Background(), "saga-1")
+	fmt.Println(err)
+	if err == nil {
+		t.Fatal("want error")
+	}
+	want := []string{"child-refund", "refund"}
+	if steps := recordedSteps(); !reflect.DeepEqual(steps, want) {
+		t.Errorf("steps = %v, want %v", steps, want)
+	}
+}
@@ -0,0 +1,151 @@
+package dslflow_test_all
+
+import (
+	"context"
+	"fmt"
+	"github.com/magic-lib/go-plat-utils/conv"
+	"github.com/magic-lib/workflow/common/dslflow"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+var (
+	dependsActionOnce sync.Once
+	dependsCounter    atomic.Int32
+)
+
+// registerDependsAction 注册一个记录执行次数的 action
+func registerDependsAction(t testing.TB) {
+	dependsActionOnce.Do(func() {
+		registerTestAction(t, func(ctx context.Context, param map[string]any) (map[string]any, error) {
+			count := dependsCounter.Add(1)
+			return map[string]any{"count": count}, nil
+		}, &dslflow.ActionMetadata{
+			Namespace: "test",
+			Activity:  "Count",
+		})
+	})
+}
+
+func TestDependsOnByName(t *testing.T) {
+	registerDependsAction(t)
+	dependsCounter.Store(0)
+
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  sequence:
+    - activity:
+        id: delete
+        namespace: test
+        activity: Count
+        depends_on: [recycle]
+        responses:
+          recycled: "{{recycle.responses.count}}"
+    - activity:
+        id: recycle
+        namespace: test
+        activity: Count
+    - activity:
+        id: notify
+        namespace: test
+        activity: Count
+        depends_on: [recycle, test/Count]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ret, err := wf.Execute(context.Background(), map[string]any{})
+	fmt.Println(conv.String(ret), err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// recycle 只执行一次，test/Count 解析为第一个 delete，也已经执行过
+	if got := dependsCounter.Load(); got != 3 {
+		t.Errorf("action executed %d times, want 3", got)
+	}
+	if conv.String(ret["recycled"]) != "1" {
+		t.Errorf("recycled = %v, want 1", ret["recycled"])
+	}
+	// 复用依赖结果时只合并 recycle 自己的变量，不会把 count 改回 recycle 执行时的值
+	if args, _ := ret["delete"].(map[string]any)["arguments"].(map[string]any); args["count"] != nil {
+		t.Errorf("delete arguments count = %v, want not merged from recycle", args["count"])
+	}
+}
+
+// TestDependsOnRunning 依赖的 activity 正在其他分支中执行时等待它的结果，不再执行一次
+func TestDependsOnRunning(t *testing.T) {
+	registerSleepAction(t)
+	before := sleepSucceeded.Load()
+
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  parallel:
+    - activity:
+        id: slow
+        namespace: test
+        activity: Sleep
+        arguments: '{"name":"slow","ms":50}'
+    - sequence:
+        - activity:
+            namespace: test
+            activity: Sleep
+            arguments: '{"name":"wait","ms":10}'
+        - activity:
+            id: after
+            namespace: test
+            activity: Sleep
+            arguments: '{"name":"after","ms":0}'
+            depends_on: [slow]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ret, err := wf.Execute(context.Background(), map[string]any{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sleepSucceeded.Load() - before; got != 3 {
+		t.Errorf("action executed %d times, want 3", got)
+	}
+	if ret["slow"] == nil || ret["after"] == nil {
+		t.Errorf("missing results: %v", conv.String(ret))
+	}
+}
+
+func TestDependsOnCycle(t *testing.T) {
+	registerDependsAction(t)
+
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  parallel:
+    - activity:
+        id: a
+        namespace: test
+        activity: Count
+        depends_on: [b]
+    - activity:
+        id: b
+        namespace: test
+        activity: Count
+        depends_on: [a]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = wf.Validate(nil)
+	fmt.Println(err)
+	if err == nil || !strings.Contains(err.Error(), "circular dependency") {
+		t.Errorf("want circular dependency from Validate, got %v", err)
+	}
+
+	_, err = wf.Execute(context.Background(), map[string]any{})
+	fmt.Println(err)
+	if err == nil || !strings.Contains(err.Error(), "循环依赖") {
+		t.Errorf("want cycle error, got %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package dslflow_test_all
+
+import (
+	"context"
+	"fmt"
+	"github.com/magic-lib/go-plat-utils/conv"
+	"github.com/magic-lib/workflow/common/dslflow"
+	"testing"
+)
+
+func TestForEach(t *testing.T) {
+	registerHookActions(t)
+
+	modes := map[string]string{
+		"sequential": "parallel: false",
+		"parallel":   "parallel: true\n    max_concurrency: 2",
+	}
+	for mode, modeConfig := range modes {
+		hookRecords = nil
+		wf, err := dslflow.LoadWorkflowBytes([]byte(fmt.Sprintf(`
+root:
+  foreach:
+    items: "{{clusters}}"
+    item_var: cluster
+    result_var: deleted
+    %s
+    do:
+      activity:
+        namespace: test
+        activity: Record
+        arguments: '{"name":"{{cluster.name}}","index":"{{index}}"}'
+        responses:
+          deleted_name: "{{name}}"
+`, modeConfig)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = wf.Validate(nil, "clusters"); err != nil {
+			t.Errorf("validate: %v", err)
+		}
+
+		ret, err := wf.Execute(context.Background(), map[string]any{
+			"clusters": []map[string]any{{"name": "c1"}, {"name": "c2"}, {"name": "c3"}},
+		})
+		fmt.Println(conv.String(ret["deleted"]), err)
+		if err != nil {
+			t.Fatal(err)
+		}
+		deleted, _ := ret["deleted"].([]any)
+		if len(deleted) != 3 || len(hookRecords) != 3 {
+			t.Fatalf("%s: deleted = %v", mode, ret["deleted"])
+		}
+		for i, res := range deleted {
+			resMap, _ := res.(map[string]any)
+			if resMap["deleted_name"] != fmt.Sprintf("c%d", i+1) || resMap["name"] != resMap["deleted_name"] {
+				t.Errorf("%s: result[%d] = %v", mode, i, res)
+			}
+			if _, ok := resMap["cluster"]; ok {
+				t.Errorf("%s: result[%d] should not contain item var", mode, i)
+			}
+			if _, ok := resMap["index"]; ok {
+				t.Errorf("%s: result[%d] should not contain index var", mode, i)
+			}
+		}
+		if _, ok := ret["cluster"]; ok {
+			t.Errorf("%s: item var leaked into workflow vars", mode)
+		}
+	}
+
+	wf, _ := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  foreach:
+    items: "{{clusters}}"
+    do:
+      activity:
+        namespace: test
+        activity: Record
+`))
+	_, err := wf.Execute(context.Background(), map[string]any{"clusters": "c1"})
+	fmt.Println(err)
+	if err == nil {
+		t.Error("want not an array error")
+	}
+}
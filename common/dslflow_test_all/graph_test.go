@@ -0,0 +1,156 @@
+package dslflow_test_all
+
+import (
+	"context"
+	"github.com/magic-lib/workflow/common/dslflow"
+	"strings"
+	"testing"
+)
+
+func TestWorkflowGraph(t *testing.T) {
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+name: order
+root:
+  sequence:
+    - activity:
+        id: user
+        namespace: user
+        activity: Get
+    - control:
+        when: "{{vip}} == 1"
+      activity:
+        id: coupon
+        namespace: coupon
+        activity: Issue
+        depends_on: [user]
+        hooks:
+          start:
+            namespace: audit
+            activity: Log
+    - parallel:
+        - activity:
+            namespace: stock
+            activity: Reserve
+        - activity:
+            namespace: billing
+            activity: Pay
+    - switch:
+        cases:
+          - name: big
+            when: "{{amount}} > 100"
+            do:
+              activity:
+                namespace: notify
+                activity: Manager
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dot := wf.ToDOT(nil)
+	if !strings.HasPrefix(dot, `digraph "order" {`+"\n") {
+		t.Errorf("dot header: %s", dot)
+	}
+	for _, want := range []string{
+		`n0 [label="start", shape=oval];`,
+		`n1 [label="user\nuser/Get", shape=box, style="rounded"];`,
+		`n2 [label="coupon\ncoupon/Issue", shape=box, style="rounded"];`,
+		`n3 [label="audit/Log", shape=box, style="rounded"];`,
+		`n4 [label="{{vip}} == 1", shape=diamond];`,
+		`n5 [label="fork", shape=circle];`,
+		`n6 [label="join", shape=circle];`,
+		`n9 [label="switch", shape=diamond];`,
+		`n2 -> n3 [label="start", style=dashed];`,
+		`n1 -> n4;`,
+		`n4 -> n2 [label="true"];`,
+		`n4 -> n5 [label="false"];`,
+		`n2 -> n5;`,
+		`n5 -> n7;`,
+		`n5 -> n8;`,
+		`n7 -> n6;`,
+		`n6 -> n9;`,
+		`n9 -> n10 [label="big: {{amount}} > 100"];`,
+		`n9 -> n11 [label="default"];`,
+		`n10 -> n11;`,
+		`n1 -> n2 [label="depends_on", style=dotted];`,
+	} {
+		if !strings.Contains(dot, "  "+want+"\n") {
+			t.Errorf("dot missing %s\n%s", want, dot)
+		}
+	}
+
+	mermaid := wf.ToMermaid(nil)
+	if !strings.HasPrefix(mermaid, "flowchart TD\n") {
+		t.Errorf("mermaid header: %s", mermaid)
+	}
+	for _, want := range []string{
+		`n0(["start"])`,
+		`n1["user<br/>user/Get"]`,
+		`n4{"{{vip}} == 1"}`,
+		`n5(("fork"))`,
+		`n2 -.->|"start"| n3`,
+		`n4 -->|"true"| n2`,
+		`n1 -.->|"depends_on"| n2`,
+		`n0 --> n1`,
+	} {
+		if !strings.Contains(mermaid, want+"\n") {
+			t.Errorf("mermaid missing %s\n%s", want, mermaid)
+		}
+	}
+}
+
+func TestWorkflowGraphReport(t *testing.T) {
+	registerFlakyAction(t)
+	registerLookupAction(t)
+	flakyCounter.Store(0)
+
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  sequence:
+    - activity:
+        namespace: test
+        activity: Flaky
+        arguments: '{"fail_times":0}'
+    - control:
+        when: "{{skip}} == 1"
+      activity:
+        namespace: test
+        activity: Lookup
+        arguments: '{"id":"graph"}'
+    - control:
+        onerror: ignore
+      activity:
+        namespace: test
+        activity: Flaky
+        arguments: '{"fail_times":9,"error":"business"}'
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, report, err := wf.ExecuteWithReport(context.Background(), "", map[string]any{"skip": 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dot := wf.ToDOT(report)
+	for _, want := range []string{
+		`n1 [label="test/Flaky", shape=box, fillcolor="#c8e6c9", color="#2e7d32", style="rounded,filled"];`,
+		`n2 [label="test/Lookup", shape=box, fillcolor="#eeeeee", color="#9e9e9e", style="rounded,filled"];`,
+		`n4 [label="test/Flaky", shape=box, fillcolor="#ffcdd2", color="#c62828", style="rounded,filled"];`,
+	} {
+		if !strings.Contains(dot, "  "+want+"\n") {
+			t.Errorf("dot missing %s\n%s", want, dot)
+		}
+	}
+	mermaid := wf.ToMermaid(report)
+	for _, want := range []string{
+		"classDef succeeded fill:#c8e6c9,stroke:#2e7d32",
+		"class n1 succeeded",
+		"class n2 skipped",
+		"class n4 failed",
+	} {
+		if !strings.Contains(mermaid, "  "+want+"\n") {
+			t.Errorf("mermaid missing %s\n%s", want, mermaid)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package dslflow_test_all
+
+import (
+	"context"
+	"github.com/magic-lib/workflow/common/dslflow"
+	"testing"
+)
+
+// registerTestAction 把 fn 转换成 action 并注册，失败时结束测试
+func registerTestAction[I, O any](t testing.TB, fn func(ctx context.Context, req I) (O, error), meta *dslflow.ActionMetadata) {
+	t.Helper()
+	ai, err := dslflow.ChangeActionInterface[I, O](fn, meta)
+	if err == nil {
+		err = dslflow.RegisterAction(ai)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
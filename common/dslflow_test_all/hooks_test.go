@@ -0,0 +1,154 @@
+package dslflow_test_all
+
+import (
+	"context"
+	"fmt"
+	"github.com/magic-lib/go-plat-utils/conv"
+	"github.com/magic-lib/workflow/common/dslflow"
+	"github.com/magic-lib/workflow/common/errorflow"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	hookActionOnce sync.Once
+	hookMu         sync.Mutex
+	hookRecords    []map[string]any
+)
+
+// registerHookActions 注册钩子测试用的 action：Record 记录参数，Fail 总是失败
+func registerHookActions(t testing.TB) {
+	hookActionOnce.Do(func() {
+		registerTestAction(t, func(ctx context.Context, param map[string]any) (map[string]any, error) {
+			hookMu.Lock()
+			defer hookMu.Unlock()
+			hookRecords = append(hookRecords, param)
+			return param, nil
+		}, &dslflow.ActionMetadata{Namespace: "test", Activity: "Record"})
+		registerTestAction(t, func(ctx context.Context, param map[string]any) (map[string]any, error) {
+			return nil, fmt.Errorf("disk full")
+		}, &dslflow.ActionMetadata{Namespace: "test", Activity: "Fail"})
+	})
+}
+
+func TestLifecycleHooks(t *testing.T) {
+	registerHookActions(t)
+	hookRecords = nil
+
+	act := &dslflow.Activity{
+		Id: "del",
+		ActivityMetadata: dslflow.ActivityMetadata{
+			Namespace: "test",
+			Activity:  "Fail",
+			Arguments: `{"name":"{{name}}"}`,
+		},
+		Hooks: dslflow.LifecycleHooks{
+			dslflow.LifecycleEventOnStart: {ActivityMetadata: dslflow.ActivityMetadata{
+				Namespace: "test", Activity: "Record",
+				Arguments: `{"event":"{{hook.event}}","name":"{{name}}"}`,
+			}},
+			dslflow.LifecycleEventOnError: {ActivityMetadata: dslflow.ActivityMetadata{
+				Namespace: "test", Activity: "Record",
+				Arguments: `{"event":"{{hook.event}}","error":"{{hook.error}}"}`,
+			}},
+			dslflow.LifecycleEventOnComplete: {Timeout: 1, ActivityMetadata: dslflow.ActivityMetadata{
+				Namespace: "test", Activity: "Record",
+				Arguments: `{"event":"{{hook.event}}","arg":"{{hook.arguments.name}}"}`,
+			}},
+		},
+	}
+
+	_, err := act.Execute(context.Background(), map[string]any{"name": "cd-1"})
+	fmt.Println(conv.String(hookRecords), err)
+	if err == nil {
+		t.Fatal("want error from Fail action")
+	}
+	want := []map[string]any{
+		{"event": "start", "name": "cd-1"},
+		{"event": "error", "error": "disk full"},
+		{"event": "complete", "arg": "cd-1"},
+	}
+	if !reflect.DeepEqual(hookRecords, want) {
+		t.Errorf("hook records = %s, want %s", conv.String(hookRecords), conv.String(want))
+	}
+}
+
+func TestLifecycleHooksAbort(t *testing.T) {
+	registerHookActions(t)
+	hookRecords = nil
+
+	act := &dslflow.Activity{
+		ActivityMetadata: dslflow.ActivityMetadata{Namespace: "test", Activity: "Record"},
+		HookPolicy:       dslflow.HookPolicyAbort,
+		Hooks: dslflow.LifecycleHooks{
+			dslflow.LifecycleEventOnStart: {ActivityMetadata: dslflow.ActivityMetadata{Namespace: "test", Activity: "Fail"}},
+		},
+	}
+	_, err := act.Execute(context.Background(), map[string]any{"name": "cd-1"})
+	fmt.Println(err)
+	if err == nil || len(hookRecords) != 0 {
+		t.Errorf("main action should be aborted, err=%v records=%v", err, hookRecords)
+	}
+
+	act.HookPolicy = dslflow.HookPolicyIgnore
+	_, err = act.Execute(context.Background(), map[string]any{"name": "cd-1"})
+	if err != nil || len(hookRecords) != 1 {
+		t.Errorf("main action should run, err=%v records=%v", err, hookRecords)
+	}
+}
+
+// TestLifecycleHooksRetry 重试多次时钩子只触发一次，error 钩子拿到最后一次的错误
+func TestLifecycleHooksRetry(t *testing.T) {
+	registerHookActions(t)
+	registerFlakyAction(t)
+	hookRecords = nil
+	flakyCounter.Store(0)
+
+	act := &dslflow.Activity{
+		ActivityMetadata: dslflow.ActivityMetadata{
+			Namespace: "test",
+			Activity:  "Flaky",
+			Arguments: `{"fail_times":5}`,
+		},
+		RetryPolicy: dslflow.RetryPolicyConfig{MaximumAttempts: 2, InitialInterval: time.Millisecond},
+		Hooks: dslflow.LifecycleHooks{
+			dslflow.LifecycleEventOnStart: {ActivityMetadata: dslflow.ActivityMetadata{
+				Namespace: "test", Activity: "Record", Arguments: `{"event":"{{hook.event}}"}`,
+			}},
+			dslflow.LifecycleEventOnError: {ActivityMetadata: dslflow.ActivityMetadata{
+				Namespace: "test", Activity: "Record", Arguments: `{"event":"{{hook.event}}","error":"{{hook.error}}"}`,
+			}},
+		},
+	}
+	_, err := act.Execute(context.Background(), map[string]any{})
+	fmt.Println(conv.String(hookRecords), err)
+	if !errorflow.IsRetryError(err) || flakyCounter.Load() != 3 {
+		t.Fatalf("want retry error after 3 attempts, got %v (%d attempts)", err, flakyCounter.Load())
+	}
+	want := []map[string]any{
+		{"event": "start"},
+		{"event": "error", "error": "service unavailable"},
+	}
+	if !reflect.DeepEqual(hookRecords, want) {
+		t.Errorf("hook records = %s, want %s", conv.String(hookRecords), conv.String(want))
+	}
+}
+
+func TestLifecycleHooksInvalidPolicy(t *testing.T) {
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  activity:
+    namespace: test
+    activity: Record
+    hook_policy: stop
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = wf.Validate(nil); !errorflow.IsDefinitionError(err) || !strings.Contains(err.Error(), `invalid hook_policy "stop"`) {
+		t.Errorf("want invalid hook_policy error, got %v", err)
+	}
+}
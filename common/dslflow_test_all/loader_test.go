@@ -0,0 +1,152 @@
+package dslflow_test_all
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/magic-lib/go-plat-utils/conv"
+	"github.com/magic-lib/workflow/common/dslflow"
+	"github.com/magic-lib/workflow/common/errorflow"
+	"go.uber.org/multierr"
+	"testing"
+	"time"
+)
+
+func TestLoadWorkflowFile(t *testing.T) {
+	wf, err := dslflow.LoadWorkflowFile("workflow_config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println(conv.String(wf))
+
+	act := wf.Root.Activity
+	if act.Timeout != 600 {
+		t.Errorf("timeout = %d, want 600", act.Timeout)
+	}
+	if act.RetryPolicy.InitialInterval != 500*time.Millisecond {
+		t.Errorf("initial_interval = %v, want 500ms", act.RetryPolicy.InitialInterval)
+	}
+	deps, ok := act.DependsOn.([]dslflow.ActivityMetadata)
+	if !ok || len(deps) != 1 || deps[0].Activity != "del-cd-recycling" {
+		t.Errorf("depends_on = %#v", act.DependsOn)
+	}
+	if len(wf.Root.Sequence) != 8 {
+		t.Errorf("sequence len = %d, want 8", len(wf.Root.Sequence))
+	}
+}
+
+func TestLoadWorkflowUnknownField(t *testing.T) {
+	_, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  activity:
+    activity: del-cd
+    default_arguments_force: del-cd
+    timeout: abc
+  control:
+    onerorr: ignore
+`))
+	fmt.Println(err)
+	errList := multierr.Errors(err)
+	if len(errList) != 3 {
+		t.Fatalf("got %d errors, want 3: %v", len(errList), err)
+	}
+	var pe *errorflow.ParseError
+	if !errors.As(errList[0], &pe) || pe.Line != 5 || pe.Column != 5 {
+		t.Errorf("first error = %v, want line 5 column 5", errList[0])
+	}
+}
+
+func TestLoadWorkflowJson(t *testing.T) {
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`{
+	"root": {
+		"sequence": [
+			{"activity": {"id": "a1", "activity": "GetOrderName", "timeout": "30s",
+				"depends_on": [{"activity": {"activity": "GetOrderName"}}]}}
+		]
+	}
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	act := wf.Root.Sequence[0].Activity
+	if act.Timeout != 30 {
+		t.Errorf("timeout = %d, want 30", act.Timeout)
+	}
+	if _, ok := act.DependsOn.(dslflow.Sequence); !ok {
+		t.Errorf("depends_on = %T, want Sequence", act.DependsOn)
+	}
+
+	_, err = dslflow.LoadWorkflowBytes([]byte("{\n  \"root\": {\n    \"activity\": {,}\n  }\n}"))
+	fmt.Println(err)
+	if !errorflow.IsParseError(err) {
+		t.Errorf("want parse error, got %v", err)
+	}
+}
+
+// 时间字段的整数为纳秒，和 encoding/json 编码 time.Duration 一致
+func TestLoadWorkflowDuration(t *testing.T) {
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  loop:
+    delay: 1000000000
+    max_iterations: 1
+    do:
+      activity:
+        activity: del-cd
+        cache_ttl: 60000000000
+        retry_policy:
+          initial_interval: 100
+          maximum_interval: 2s
+          deadline: 0
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	act := wf.Root.Loop.Do.Activity
+	if wf.Root.Loop.Delay != time.Second || act.CacheTTL != time.Minute {
+		t.Errorf("delay = %v, cache_ttl = %v", wf.Root.Loop.Delay, act.CacheTTL)
+	}
+	if act.RetryPolicy.InitialInterval != 100 || act.RetryPolicy.MaximumInterval != 2*time.Second || act.RetryPolicy.Deadline != 0 {
+		t.Errorf("retry_policy = %+v", act.RetryPolicy)
+	}
+
+	_, err = dslflow.LoadWorkflowBytes([]byte(`
+root:
+  loop:
+    delay: true
+    do:
+      activity:
+        activity: del-cd
+`))
+	fmt.Println(err)
+	var pe *errorflow.ParseError
+	if !errors.As(err, &pe) || pe.Line != 4 || pe.Column != 12 {
+		t.Errorf("want parse error at line 4 column 12, got %v", err)
+	}
+}
+
+// encoding/json 编码的工作流可以重新加载
+func TestLoadWorkflowJsonRoundTrip(t *testing.T) {
+	wf, err := dslflow.LoadWorkflowFile("workflow_config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(wf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := dslflow.LoadWorkflowBytes(data)
+	if err != nil {
+		t.Fatalf("load json: %v", err)
+	}
+	reloaded, err := json.Marshal(loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(reloaded) != string(data) {
+		t.Errorf("round trip = %s, want %s", reloaded, data)
+	}
+	if loaded.Root.Activity.RetryPolicy.InitialInterval != 500*time.Millisecond {
+		t.Errorf("initial_interval = %v, want 500ms", loaded.Root.Activity.RetryPolicy.InitialInterval)
+	}
+}
@@ -0,0 +1,109 @@
+package dslflow_test_all
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/magic-lib/workflow/common/dslflow"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogLogger(t *testing.T) {
+	registerFlakyAction(t)
+	flakyCounter.Store(0)
+
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  sequence:
+    - activity:
+        id: flaky
+        namespace: test
+        activity: Flaky
+        arguments: '{"fail_times":1}'
+        retry_policy:
+          maximum_attempts: 2
+          initial_interval: 1ms
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 单次执行设置的日志优先于工作流的日志
+	engineBuf, runBuf := &bytes.Buffer{}, &bytes.Buffer{}
+	wf.Logger = dslflow.NewSlogLogger(slog.New(slog.NewJSONHandler(engineBuf, nil)))
+	ctx := dslflow.WithLogger(context.Background(), dslflow.NewSlogLogger(slog.New(slog.NewJSONHandler(runBuf, &slog.HandlerOptions{Level: slog.LevelDebug}))))
+	if _, err = wf.ExecuteRun(ctx, "log-run", map[string]any{}); err != nil {
+		t.Fatal(err)
+	}
+	if engineBuf.Len() > 0 {
+		t.Errorf("workflow logger should not be used: %s", engineBuf.String())
+	}
+
+	var retryLine map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(runBuf.String()), "\n") {
+		m := make(map[string]any)
+		if err = json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("invalid log line %s: %v", line, err)
+		}
+		if m["msg"] == "action failed, retrying" {
+			retryLine = m
+		}
+	}
+	if retryLine == nil {
+		t.Fatalf("retry log not found: %s", runBuf.String())
+	}
+	want := map[string]any{
+		"level":       "WARN",
+		"run_id":      "log-run",
+		"path":        "root.sequence[0]",
+		"activity_id": "flaky",
+		"action":      "test/Flaky",
+		"attempt":     float64(1),
+	}
+	for k, v := range want {
+		if retryLine[k] != v {
+			t.Errorf("%s = %v, want %v", k, retryLine[k], v)
+		}
+	}
+
+	// 没有设置日志时不输出
+	wf.Logger = nil
+	flakyCounter.Store(0)
+	if _, err = wf.Execute(context.Background(), map[string]any{}); err != nil {
+		t.Fatal(err)
+	}
+	wf.Logger = dslflow.NopLogger()
+	flakyCounter.Store(0)
+	if _, err = wf.Execute(context.Background(), map[string]any{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestWorkflowLoggerChild 工作流设置的日志传给子流程
+func TestWorkflowLoggerChild(t *testing.T) {
+	registerHookActions(t)
+	registerChildWorkflows(t)
+
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  workflow:
+    name: cd-delete
+    inputs:
+      project: p1
+      fail: false
+    result_var: deleted
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	wf.Logger = dslflow.NewSlogLogger(slog.New(slog.NewJSONHandler(buf, nil)))
+	if _, err = wf.ExecuteRun(context.Background(), "log-parent", map[string]any{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"run_id":"log-parent#root.workflow"`) {
+		t.Errorf("child workflow log not found: %s", buf.String())
+	}
+}
@@ -0,0 +1,126 @@
+package dslflow_test_all
+
+import (
+	"context"
+	"fmt"
+	"github.com/magic-lib/go-plat-utils/conv"
+	"github.com/magic-lib/workflow/common/dslflow"
+	"github.com/magic-lib/workflow/common/errorflow"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var (
+	pollActionOnce sync.Once
+	pollCounter    atomic.Int32
+)
+
+// registerPollAction 注册一个轮询的 action，第3次调用时返回完成
+func registerPollAction(t testing.TB) {
+	pollActionOnce.Do(func() {
+		registerTestAction(t, func(ctx context.Context, param map[string]any) (map[string]any, error) {
+			count := pollCounter.Add(1)
+			return map[string]any{"polled": count, "done": count >= 3}, nil
+		}, &dslflow.ActionMetadata{Namespace: "test", Activity: "Poll"})
+	})
+}
+
+func TestLoopUntil(t *testing.T) {
+	registerPollAction(t)
+	pollCounter.Store(0)
+
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  loop:
+    until: "{{done}}"
+    delay: 10ms
+    max_iterations: 5
+    do:
+      activity:
+        namespace: test
+        activity: Poll
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = wf.Validate(nil); err != nil {
+		t.Errorf("validate: %v", err)
+	}
+
+	start := time.Now()
+	ret, err := wf.Execute(context.Background(), map[string]any{})
+	fmt.Println(ret, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conv.String(ret["polled"]) != "3" || conv.String(ret["iteration"]) != "3" {
+		t.Errorf("polled = %v, iteration = %v, want 3", ret["polled"], ret["iteration"])
+	}
+	if time.Since(start) < 20*time.Millisecond {
+		t.Errorf("delay between iterations is not applied")
+	}
+}
+
+func TestLoopWhile(t *testing.T) {
+	registerHookActions(t)
+
+	// 每次执行把当前次数写入 count，上一次的 count 在下一次判断条件时可见
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  loop:
+    while: "{{count}} < 2"
+    index_var: round
+    do:
+      activity:
+        namespace: test
+        activity: Record
+        arguments: '{"round":"{{round}}"}'
+        responses:
+          count: "{{round}}"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = wf.Validate(nil, "count"); err != nil {
+		t.Errorf("validate: %v", err)
+	}
+
+	ret, err := wf.Execute(context.Background(), map[string]any{"count": 0})
+	fmt.Println(ret, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// round 0 => count 0，round 1 => count 1，round 2 => count 2 后条件不满足
+	if conv.String(ret["round"]) != "3" || conv.String(ret["count"]) != "2" {
+		t.Errorf("round = %v, count = %v", ret["round"], ret["count"])
+	}
+}
+
+func TestLoopMaxIterations(t *testing.T) {
+	registerPollAction(t)
+	pollCounter.Store(-100)
+
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  loop:
+    until: "{{done}}"
+    max_iterations: 2
+    do:
+      activity:
+        namespace: test
+        activity: Poll
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = wf.Execute(context.Background(), map[string]any{})
+	fmt.Println(err)
+	if !errorflow.IsMaxIterationsError(err) {
+		t.Errorf("want max iterations error, got %v", err)
+	}
+	if pollCounter.Load() != -98 {
+		t.Errorf("poll executed %d times, want 2", pollCounter.Load()+100)
+	}
+}
@@ -0,0 +1,112 @@
+package dslflow_test_all
+
+import (
+	"context"
+	"github.com/magic-lib/workflow/common/dslflow"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryMetrics(t *testing.T) {
+	registerFlakyAction(t)
+	registerLookupAction(t)
+	registerSleepAction(t)
+	flakyCounter.Store(0)
+
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+name: metrics
+root:
+  sequence:
+    - activity:
+        namespace: test
+        activity: Flaky
+        arguments: '{"fail_times":1}'
+        retry_policy:
+          maximum_attempts: 2
+          initial_interval: 1ms
+    - activity:
+        namespace: test
+        activity: Lookup
+        arguments: '{"id":"metrics"}'
+        cached: true
+    - activity:
+        namespace: test
+        activity: Lookup
+        arguments: '{"id":"metrics"}'
+        cached: true
+    - control:
+        onexit: exit
+      activity:
+        namespace: test
+        activity: Sleep
+        arguments: '{"name":"front","ms":1}'
+    - activity:
+        namespace: test
+        activity: Sleep
+        arguments: '{"name":"background","ms":100}'
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := dslflow.NewMemoryMetrics()
+	wf.Metrics = metrics
+	if _, err = wf.Execute(context.Background(), map[string]any{}); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(metrics)
+	defer server.Close()
+	scrape := func() string {
+		resp, err := http.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+			t.Errorf("content type = %s", ct)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	// 后台流程还在执行
+	body := scrape()
+	for _, line := range []string{
+		"# TYPE dslflow_action_executions_total counter",
+		`dslflow_action_executions_total{action="test/Flaky"} 2`,
+		`dslflow_action_failures_total{action="test/Flaky"} 1`,
+		`dslflow_action_retries_total{action="test/Flaky"} 1`,
+		`dslflow_action_executions_total{action="test/Lookup"} 1`,
+		`dslflow_action_duration_seconds_bucket{action="test/Lookup",le="+Inf"} 1`,
+		`dslflow_action_duration_seconds_count{action="test/Flaky"} 2`,
+		`dslflow_activity_cache_requests_total{activity="test/Lookup",result="hit"} 1`,
+		`dslflow_activity_cache_requests_total{activity="test/Lookup",result="miss"} 1`,
+		`dslflow_workflow_runs_total{workflow="metrics",status="exited"} 1`,
+		`dslflow_workflow_runs_in_flight{workflow="metrics"} 0`,
+		`dslflow_workflow_duration_seconds_count{workflow="metrics"} 1`,
+		`dslflow_workflow_background_in_flight{workflow="metrics"} 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing %s in\n%s", line, body)
+		}
+	}
+	if ratio := metrics.CacheHitRatio("test/Lookup"); ratio != 0.5 {
+		t.Errorf("cache hit ratio = %v, want 0.5", ratio)
+	}
+
+	// 后台流程结束
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(scrape(), `dslflow_workflow_background_in_flight{workflow="metrics"} 0`) {
+		if time.Now().After(deadline) {
+			t.Fatalf("background continuation not finished:\n%s", scrape())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if body = scrape(); !strings.Contains(body, `dslflow_action_executions_total{action="test/Sleep"} 2`) {
+		t.Errorf("background action not recorded:\n%s", body)
+	}
+}
@@ -0,0 +1,266 @@
+package dslflow_test_all
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/magic-lib/go-plat-utils/conv"
+	"github.com/magic-lib/workflow/common/dslflow"
+	"github.com/magic-lib/workflow/common/errorflow"
+	"go.uber.org/multierr"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var (
+	sleepActionOnce sync.Once
+	sleepRunning    atomic.Int32
+	sleepMaxRunning atomic.Int32
+	sleepSucceeded  atomic.Int32
+)
+
+// registerSleepAction 注册一个等待 ms 毫秒后返回 {name: done} 的 action，fail 为 true 时返回错误
+func registerSleepAction(t testing.TB) {
+	sleepActionOnce.Do(func() {
+		registerTestAction(t, func(ctx context.Context, param map[string]any) (map[string]any, error) {
+			running := sleepRunning.Add(1)
+			defer sleepRunning.Add(-1)
+			for {
+				maxRunning := sleepMaxRunning.Load()
+				if running <= maxRunning || sleepMaxRunning.CompareAndSwap(maxRunning, running) {
+					break
+				}
+			}
+
+			ms, _ := strconv.Atoi(conv.String(param["ms"]))
+			select {
+			case <-time.After(time.Duration(ms) * time.Millisecond):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if conv.String(param["fail"]) == "true" {
+				return nil, errors.New("sleep failed")
+			}
+			sleepSucceeded.Add(1)
+			return map[string]any{conv.String(param["name"]): "done"}, nil
+		}, &dslflow.ActionMetadata{Namespace: "test", Activity: "Sleep"})
+	})
+}
+
+// parallelWorkflow 每个分支等待对应的毫秒数，名字以 fail 开头的分支返回错误
+func parallelWorkflow(t *testing.T, policy string, branches map[string]int) *dslflow.Workflow {
+	yamlStr := "root:\n  parallel_policy: " + policy + "\n  parallel:\n"
+	for name, ms := range branches {
+		yamlStr += fmt.Sprintf("    - activity:\n        namespace: test\n        activity: Sleep\n        arguments: '{\"name\":\"%s\",\"ms\":%d,\"fail\":%t}'\n",
+			name, ms, len(name) >= 4 && name[:4] == "fail")
+	}
+	wf, err := dslflow.LoadWorkflowBytes([]byte(yamlStr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = wf.Validate(nil); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	return wf
+}
+
+func TestParallelPolicy(t *testing.T) {
+	registerSleepAction(t)
+
+	t.Run("all with max_concurrency", func(t *testing.T) {
+		sleepMaxRunning.Store(0)
+		sleepSucceeded.Store(0)
+		wf := parallelWorkflow(t, "{mode: all, max_concurrency: 2}", map[string]int{"a": 30, "b": 30, "c": 30, "fail-d": 10})
+		_, err := wf.Execute(context.Background(), map[string]any{})
+		fmt.Println(err)
+		if err == nil {
+			t.Error("want error of fail-d")
+		}
+		if sleepSucceeded.Load() != 3 {
+			t.Errorf("all branches should finish, %d succeeded", sleepSucceeded.Load())
+		}
+		if sleepMaxRunning.Load() > 2 {
+			t.Errorf("max running = %d, want <= 2", sleepMaxRunning.Load())
+		}
+	})
+
+	t.Run("fail_fast", func(t *testing.T) {
+		wf := parallelWorkflow(t, "{}", map[string]int{"slow": 1000, "fail-fast": 10})
+		start := time.Now()
+		_, err := wf.Execute(context.Background(), map[string]any{})
+		if err == nil || time.Since(start) > 500*time.Millisecond {
+			t.Errorf("want fail fast, got %v after %v", err, time.Since(start))
+		}
+	})
+
+	t.Run("race", func(t *testing.T) {
+		wf := parallelWorkflow(t, "{mode: race}", map[string]int{"slow": 1000, "fast": 10, "fail-early": 1})
+		start := time.Now()
+		ret, err := wf.Execute(context.Background(), map[string]any{})
+		fmt.Println(ret, err)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ret["fast"] != "done" || ret["slow"] != nil || time.Since(start) > 500*time.Millisecond {
+			t.Errorf("fast branch should win, got %v after %v", ret, time.Since(start))
+		}
+	})
+
+	t.Run("quorum", func(t *testing.T) {
+		wf := parallelWorkflow(t, "{mode: 'quorum:2'}", map[string]int{"a": 10, "b": 20, "fail-c": 5, "slow": 1000})
+		ret, err := wf.Execute(context.Background(), map[string]any{})
+		if err != nil || ret["a"] != "done" || ret["b"] != "done" || ret["slow"] != nil {
+			t.Errorf("quorum:2 = %v, %v", ret, err)
+		}
+
+		wf = parallelWorkflow(t, "{mode: 'quorum:2'}", map[string]int{"a": 10, "fail-b": 5, "fail-c": 5})
+		_, err = wf.Execute(context.Background(), map[string]any{})
+		fmt.Println(err)
+		if err == nil {
+			t.Error("want quorum not reached error")
+		}
+	})
+
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  parallel_policy:
+    mode: quorum:3
+    max_concurrency: -1
+  parallel:
+    - activity:
+        namespace: test
+        activity: Sleep
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wf.Validate(nil)
+	fmt.Println(err)
+	if err == nil {
+		t.Error("want invalid parallel_policy error")
+	}
+}
+
+func TestParallelMerge(t *testing.T) {
+	registerSleepAction(t)
+	registerHookActions(t)
+
+	// 两个分支写入相同的变量 name、ms，first 后完成
+	mergeWorkflow := func(merge string) *dslflow.Workflow {
+		wf, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  parallel_policy:
+    merge: ` + merge + `
+  parallel:
+    - activity:
+        id: first
+        namespace: test
+        activity: Sleep
+        arguments: '{"name":"a","ms":30}'
+    - activity:
+        id: second
+        namespace: test
+        activity: Sleep
+        arguments: '{"name":"b","ms":1}'
+`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = wf.Validate(nil); err != nil {
+			t.Fatalf("validate: %v", err)
+		}
+		return wf
+	}
+
+	ret, err := mergeWorkflow("last-wins").Execute(context.Background(), map[string]any{})
+	if err != nil || ret["name"] != "a" {
+		t.Errorf("last-wins: %v, %v", ret, err)
+	}
+	ret, err = mergeWorkflow("branch-order").Execute(context.Background(), map[string]any{})
+	if err != nil || ret["name"] != "b" {
+		t.Errorf("branch-order: %v, %v", ret, err)
+	}
+	ret, err = mergeWorkflow("namespaced").Execute(context.Background(), map[string]any{})
+	fmt.Println(conv.String(ret), err)
+	first, _ := ret["first"].(map[string]any)
+	second, _ := ret["second"].(map[string]any)
+	if err != nil || ret["name"] != nil || first["name"] != "a" || second["name"] != "b" {
+		t.Errorf("namespaced: %v, %v", ret, err)
+	}
+
+	// 回显到结果中的请求参数 name、ms 不是分支写入的变量，不算冲突
+	ret, err = mergeWorkflow("error-on-conflict").Execute(context.Background(), map[string]any{})
+	if err != nil || ret["a"] != "done" || ret["b"] != "done" {
+		t.Errorf("error-on-conflict: %v, %v", ret, err)
+	}
+
+	conflictWorkflow, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  parallel_policy:
+    merge: error-on-conflict
+  parallel:
+    - activity:
+        id: first
+        namespace: test
+        activity: Sleep
+        arguments: '{"name":"a","ms":1}'
+        responses:
+          winner: first
+    - sequence:
+        - activity:
+            namespace: test
+            activity: Sleep
+            arguments: '{"name":"a","ms":1}'
+        - activity:
+            namespace: test
+            activity: Sleep
+            arguments: '{"name":"b","ms":1}'
+            responses:
+              winner: second
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conflictWorkflow.Execute(context.Background(), map[string]any{})
+	fmt.Println(err)
+	var ce *errorflow.MergeConflictError
+	if !errors.As(err, &ce) || ce.Key != "winner" || !reflect.DeepEqual(ce.Branches, []string{"first", "1"}) {
+		t.Errorf("want merge conflict on winner, got %v", err)
+	}
+	if len(multierr.Errors(err)) != 1 {
+		t.Errorf("want only one conflict, got %v", err)
+	}
+
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  parallel_policy:
+    merge: deep-merge
+  parallel:
+    - activity:
+        namespace: test
+        activity: Record
+        arguments: '{"cluster":{"a":1}}'
+    - activity:
+        namespace: test
+        activity: Record
+        arguments: '{"cluster":{"b":2}}'
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret, err = wf.Execute(context.Background(), map[string]any{"cluster": map[string]any{"name": "cd"}})
+	fmt.Println(conv.String(ret), err)
+	cluster, _ := ret["cluster"].(map[string]any)
+	if err != nil || cluster["name"] != "cd" || conv.String(cluster["a"]) != "1" || conv.String(cluster["b"]) != "2" {
+		t.Errorf("deep-merge: %v, %v", ret, err)
+	}
+
+	wf.Root.ParallelPolicy.Merge = "first-wins"
+	if err = wf.Validate(nil); err == nil {
+		t.Error("want invalid merge error")
+	}
+}
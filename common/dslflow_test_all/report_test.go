@@ -0,0 +1,199 @@
+package dslflow_test_all
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/magic-lib/workflow/common/dslflow"
+	"testing"
+)
+
+func TestRunReport(t *testing.T) {
+	registerFlakyAction(t)
+	registerLookupAction(t)
+	registerHookActions(t)
+	registerChildWorkflows(t)
+	flakyCounter.Store(0)
+
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+name: report
+root:
+  sequence:
+    - activity:
+        id: flaky
+        namespace: test
+        activity: Flaky
+        arguments: '{"fail_times":1}'
+        retry_policy:
+          maximum_attempts: 2
+          initial_interval: 1ms
+    - control:
+        when: "{{skip}} == 1"
+      activity:
+        namespace: test
+        activity: Lookup
+        arguments: '{"id":"skipped"}'
+    - activity:
+        id: lookup1
+        namespace: test
+        activity: Lookup
+        arguments: '{"id":"report"}'
+        cached: true
+    - activity:
+        id: lookup2
+        namespace: test
+        activity: Lookup
+        arguments: '{"id":"report"}'
+        cached: true
+    - control:
+        onerror: ignore
+      activity:
+        id: broken
+        namespace: test
+        activity: Flaky
+        arguments: '{"fail_times":9,"error":"business"}'
+    - workflow:
+        name: cd-delete
+        version: v1
+        inputs:
+          project: p1
+          fail: "{{fail}}"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, report, err := wf.ExecuteWithReport(context.Background(), "", map[string]any{"skip": 0, "fail": false})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.RunID == "" || report.Workflow != "report" || report.Status != dslflow.RunStatusCompleted || report.EndTime.Before(report.StartTime) {
+		t.Errorf("report: %+v", report)
+	}
+
+	entries := make(map[string]*dslflow.ReportEntry)
+	for _, entry := range report.Entries {
+		entries[string(entry.Kind)+" "+entry.Path] = entry
+		if entry.EndTime.Before(entry.StartTime) {
+			t.Errorf("%s %s not finished", entry.Kind, entry.Path)
+		}
+	}
+	if report.Entries[0].Path != "root" || report.Entries[1].Path != "root.sequence[0]" {
+		t.Errorf("entries should be in visit order: %s, %s", report.Entries[0].Path, report.Entries[1].Path)
+	}
+	for key, status := range map[string]dslflow.ReportStatus{
+		"statement root":             dslflow.ReportSucceeded,
+		"statement root.sequence[1]": dslflow.ReportSkipped,
+		"statement root.sequence[3]": dslflow.ReportSucceeded,
+		"statement root.sequence[4]": dslflow.ReportIgnored,
+		"statement root.sequence[5]": dslflow.ReportSucceeded,
+	} {
+		if entries[key] == nil || entries[key].Status != status {
+			t.Errorf("%s = %+v, want %s", key, entries[key], status)
+		}
+	}
+
+	flaky := findReportEntry(report, "flaky")
+	flakyResp, _ := json.Marshal(flaky.Response)
+	if flaky.Status != dslflow.ReportSucceeded || flaky.Attempts != 2 || flaky.Action != "test/Flaky" ||
+		fmt.Sprint(flaky.Arguments) != `{"fail_times":1}` || string(flakyResp) != `{"flaky":"ok"}` {
+		t.Errorf("flaky entry: %+v", flaky)
+	}
+	if lookup := findReportEntry(report, "lookup1"); lookup.Status != dslflow.ReportSucceeded {
+		t.Errorf("lookup1 entry: %+v", lookup)
+	}
+	if lookup := findReportEntry(report, "lookup2"); lookup.Status != dslflow.ReportCached {
+		t.Errorf("lookup2 entry: %+v", lookup)
+	}
+	if broken := findReportEntry(report, "broken"); broken.Status != dslflow.ReportFailed || broken.Error == "" || broken.Attempts != 1 {
+		t.Errorf("broken entry: %+v", broken)
+	}
+	if entries["statement root.sequence[4]"].Error == "" {
+		t.Errorf("ignored statement should keep the error")
+	}
+	if child := entries["statement root.sequence[5]"].Child; child == nil || child.Status != dslflow.RunStatusCompleted || len(child.Entries) == 0 {
+		t.Errorf("child report: %+v", child)
+	}
+	if _, err = json.Marshal(report); err != nil {
+		t.Errorf("marshal report: %v", err)
+	}
+
+	// 子流程失败时，报告中记录出错的节点
+	flakyCounter.Store(0)
+	_, report, err = wf.ExecuteWithReport(context.Background(), "", map[string]any{"skip": 1, "fail": true})
+	if err == nil || report == nil || report.Status != dslflow.RunStatusFailed || report.Error == "" {
+		t.Fatalf("failed report: %+v, %v", report, err)
+	}
+	entries = make(map[string]*dslflow.ReportEntry)
+	for _, entry := range report.Entries {
+		entries[string(entry.Kind)+" "+entry.Path] = entry
+	}
+	if entries["statement root.sequence[1]"].Status != dslflow.ReportSucceeded {
+		t.Errorf("when satisfied: %+v", entries["statement root.sequence[1]"])
+	}
+	failed := entries["statement root.sequence[5]"]
+	if failed.Status != dslflow.ReportFailed || failed.Child == nil || failed.Child.Status != dslflow.RunStatusFailed {
+		t.Errorf("failed child statement: %+v", failed)
+	}
+
+	// 没有通过 ExecuteWithReport 执行时不记录
+	flakyCounter.Store(0)
+	if _, err = wf.Execute(context.Background(), map[string]any{"skip": 0, "fail": false}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func findReportEntry(report *dslflow.RunReport, id string) *dslflow.ReportEntry {
+	for _, entry := range report.Entries {
+		if entry.Kind == dslflow.ReportKindActivity && entry.ActivityId == id {
+			return entry
+		}
+	}
+	return &dslflow.ReportEntry{}
+}
+
+// TestRunReportWait onexit: exit 返回的报告是副本，Wait 返回后台流程结束后的报告
+func TestRunReportWait(t *testing.T) {
+	registerSleepAction(t)
+
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  sequence:
+    - control:
+        onexit: exit
+      activity:
+        namespace: test
+        activity: Sleep
+        arguments: '{"name":"front","ms":1}'
+    - activity:
+        id: background
+        namespace: test
+        activity: Sleep
+        arguments: '{"name":"background","ms":20}'
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, report, err := wf.ExecuteWithReport(context.Background(), "", map[string]any{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Status != dslflow.RunStatusExited {
+		t.Errorf("status = %s, want exited", report.Status)
+	}
+	entries := len(report.Entries)
+
+	final, err := report.Wait(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if final.Status != dslflow.RunStatusCompleted || len(final.Entries) <= entries {
+		t.Errorf("final report status = %s, entries %d -> %d", final.Status, entries, len(final.Entries))
+	}
+	if len(report.Entries) != entries {
+		t.Error("returned report should not be modified by background work")
+	}
+	if _, err = json.Marshal(final); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,192 @@
+package dslflow_test_all
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/magic-lib/go-plat-utils/conv"
+	"github.com/magic-lib/workflow/common/dslflow"
+	"github.com/magic-lib/workflow/common/errorflow"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var (
+	flakyActionOnce sync.Once
+	flakyCounter    atomic.Int32
+)
+
+// quotaError 带错误码的错误
+type quotaError struct{}
+
+func (e *quotaError) Error() string     { return "quota exceeded" }
+func (e *quotaError) ErrorCode() string { return "E_QUOTA" }
+
+// registerFlakyAction 注册一个前 fail_times 次失败的 action，error 指定返回的错误类型
+func registerFlakyAction(t testing.TB) {
+	flakyActionOnce.Do(func() {
+		registerTestAction(t, func(ctx context.Context, param map[string]any) (map[string]any, error) {
+			failTimes, _ := strconv.Atoi(conv.String(param["fail_times"]))
+			if int(flakyCounter.Add(1)) > failTimes {
+				return map[string]any{"flaky": "ok"}, nil
+			}
+			switch param["error"] {
+			case "business":
+				return nil, &errorflow.BusinessError{Code: 400, Message: "invalid order"}
+			case "timeout":
+				return nil, &errorflow.TimeoutError{Msg: "upstream timeout"}
+			case "quota":
+				return nil, &quotaError{}
+			}
+			return nil, errors.New("service unavailable")
+		}, &dslflow.ActionMetadata{Namespace: "test", Activity: "Flaky"})
+	})
+}
+
+func retryWorkflow(t *testing.T, arguments string, retryPolicy string) *dslflow.Workflow {
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  activity:
+    id: flaky
+    namespace: test
+    activity: Flaky
+    arguments: '` + arguments + `'
+    retry_policy: ` + retryPolicy + `
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = wf.Validate(nil); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	return wf
+}
+
+func TestRetryPolicy(t *testing.T) {
+	registerFlakyAction(t)
+
+	t.Run("attempts recorded", func(t *testing.T) {
+		flakyCounter.Store(0)
+		wf := retryWorkflow(t, `{"fail_times":2}`, `{maximum_attempts: 3, initial_interval: 1ms, maximum_interval: 2ms, backoff_coefficient: 3, jitter: 0.5}`)
+		ret, err := wf.Execute(context.Background(), map[string]any{})
+		fmt.Println(conv.String(ret), err)
+		if err != nil {
+			t.Fatal(err)
+		}
+		flaky, _ := ret["flaky"].(map[string]any)
+		attempts := make([]map[string]any, 0)
+		_ = conv.Unmarshal(conv.String(flaky["attempts"]), &attempts)
+		if flakyCounter.Load() != 3 || len(attempts) != 3 {
+			t.Fatalf("attempts = %v", flaky["attempts"])
+		}
+		if conv.String(attempts[0]["attempt"]) != "1" || attempts[0]["error"] == nil || attempts[2]["error"] != nil {
+			t.Errorf("attempts = %v", attempts)
+		}
+	})
+
+	// 没有 id 时记录在 action 名称下，onerror: ignore 忽略的失败也记录
+	t.Run("attempts without id and ignored", func(t *testing.T) {
+		flakyCounter.Store(0)
+		wf, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  sequence:
+    - activity:
+        namespace: test
+        activity: Flaky
+        arguments: '{"fail_times":1}'
+        retry_policy: {maximum_attempts: 2, initial_interval: 1ms}
+    - control:
+        onerror: ignore
+      activity:
+        id: ignored
+        namespace: test
+        activity: Flaky
+        arguments: '{"fail_times":100}'
+        retry_policy: {maximum_attempts: 1, initial_interval: 1ms}
+`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ret, err := wf.Execute(context.Background(), map[string]any{})
+		fmt.Println(conv.String(ret), err)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for key, want := range map[string]string{
+			"test/Flaky": `[{"attempt":1,"error":"主动作执行失败: service unavailable"},{"attempt":2}]`,
+			"ignored":    `[{"attempt":1,"error":"主动作执行失败: service unavailable"},{"attempt":2,"error":"主动作执行失败: service unavailable"}]`,
+		} {
+			keyVars, _ := ret[key].(map[string]any)
+			if got, _ := json.Marshal(keyVars["attempts"]); string(got) != want {
+				t.Errorf("%s.attempts = %s, want %s", key, got, want)
+			}
+		}
+	})
+
+	t.Run("non retryable", func(t *testing.T) {
+		for errType, nonRetryable := range map[string]string{
+			"business": "[]",
+			"timeout":  "[TimeoutError]",
+			"quota":    "[E_QUOTA]",
+		} {
+			flakyCounter.Store(0)
+			wf := retryWorkflow(t, `{"fail_times":5,"error":"`+errType+`"}`, `{maximum_attempts: 3, initial_interval: 1ms, non_retryable_errors: `+nonRetryable+`}`)
+			_, err := wf.Execute(context.Background(), map[string]any{})
+			if err == nil || flakyCounter.Load() != 1 || errorflow.IsRetryError(err) {
+				t.Errorf("%s: executed %d times, err = %v", errType, flakyCounter.Load(), err)
+			}
+		}
+
+		flakyCounter.Store(0)
+		wf := retryWorkflow(t, `{"fail_times":5,"error":"timeout"}`, `{maximum_attempts: 2, initial_interval: 1ms, non_retryable_errors: [E_QUOTA]}`)
+		_, err := wf.Execute(context.Background(), map[string]any{})
+		var re *errorflow.RetryError
+		if !errors.As(err, &re) || len(re.Attempts) != 3 || !errorflow.IsTimeoutError(err) {
+			t.Errorf("want 3 attempts, got %v", err)
+		}
+	})
+
+	t.Run("context canceled while waiting", func(t *testing.T) {
+		flakyCounter.Store(0)
+		wf := retryWorkflow(t, `{"fail_times":5}`, `{maximum_attempts: 3, initial_interval: 10s}`)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err := wf.Execute(ctx, map[string]any{})
+		fmt.Println(err)
+		if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > time.Second {
+			t.Errorf("want context deadline exceeded, got %v after %v", err, time.Since(start))
+		}
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		flakyCounter.Store(0)
+		wf := retryWorkflow(t, `{"fail_times":5}`, `{maximum_attempts: 10, initial_interval: 20ms, deadline: 50ms}`)
+		_, err := wf.Execute(context.Background(), map[string]any{})
+		fmt.Println(err)
+		var re *errorflow.RetryError
+		if !errors.As(err, &re) || re.Cause == nil || flakyCounter.Load() != 2 {
+			t.Errorf("executed %d times, err = %v", flakyCounter.Load(), err)
+		}
+	})
+
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  activity:
+    namespace: test
+    activity: Flaky
+    retry_policy:
+      backoff_coefficient: 0.5
+      jitter: 2
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = wf.Validate(nil); err == nil {
+		t.Error("want invalid retry_policy error")
+	}
+}
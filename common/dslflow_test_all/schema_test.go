@@ -0,0 +1,176 @@
+package dslflow_test_all
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/magic-lib/workflow/common/dslflow"
+	"gopkg.in/yaml.v3"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWorkflowJSONSchema(t *testing.T) {
+	data, err := dslflow.WorkflowJSONSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	committed, err := os.ReadFile("../dslflow/workflow.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, committed) {
+		t.Errorf("workflow.schema.json is out of date, run go generate ./common/dslflow")
+	}
+
+	var schema map[string]any
+	if err = json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+	defs := schema["definitions"].(map[string]any)
+	for _, name := range []string{"Workflow", "Statement", "Control", "Activity", "ActivityMetadata", "RetryPolicyConfig", "LifecycleHooks"} {
+		if defs[name] == nil {
+			t.Errorf("missing definition %s", name)
+		}
+	}
+	for path, want := range map[string]string{
+		"Control.execution_order": `["activity","sequence","parallel","foreach","switch","loop","workflow"]`,
+		"Control.onerror":         `["ignore",null]`,
+		"Control.onexit":          `["exit",null]`,
+		"Activity.hook_policy":    `["ignore","abort",null]`,
+	} {
+		def, field, _ := strings.Cut(path, ".")
+		prop := defs[def].(map[string]any)["properties"].(map[string]any)[field].(map[string]any)
+		if items, ok := prop["items"].(map[string]any); ok {
+			prop = items
+		}
+		if got, _ := json.Marshal(prop["enum"]); string(got) != want {
+			t.Errorf("%s enum = %s, want %s", path, got, want)
+		}
+	}
+	if got, _ := json.Marshal(defs["LifecycleHooks"].(map[string]any)["propertyNames"]); string(got) != `{"enum":["start","complete","success","error","timeout"]}` {
+		t.Errorf("hooks propertyNames = %s", got)
+	}
+
+	// 示例配置满足 schema，不认识的字段和错误的枚举值不满足
+	sample, err := os.ReadFile("workflow_config.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = checkSchema(schema, sample); err != nil {
+		t.Errorf("sample workflow: %v", err)
+	}
+	for _, doc := range []string{
+		"root:\n  activity:\n    namespace: a\n    activity: b\n    retry:\n      maximum_attempts: 1\n",
+		"root:\n  control:\n    onerror: skip\n",
+		"root:\n  activity:\n    hooks:\n      before: {namespace: a}\n",
+		"root:\n  activity:\n    timeout: soon\n",
+		"root:\n  activity:\n    timeout: 1.5s\n",
+		"root:\n  parallel_policy:\n    mode: quorum:0\n",
+	} {
+		if err = checkSchema(schema, []byte(doc)); err == nil {
+			t.Errorf("schema should reject:\n%s", doc)
+		}
+	}
+	if err = checkSchema(schema, []byte("root:\n  parallel_policy:\n    mode: quorum:2\n  activity:\n    timeout: 1m30s\n    depends_on: [user]\n    retry_policy:\n      initial_interval: 100\n")); err != nil {
+		t.Errorf("valid workflow rejected: %v", err)
+	}
+}
+
+// checkSchema 只实现了 schema 中用到的关键字，用来检查生成的 schema 和 yaml 配置是否一致
+func checkSchema(schema map[string]any, data []byte) error {
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	defs := schema["definitions"].(map[string]any)
+	var check func(s map[string]any, v any, path string) error
+	check = func(s map[string]any, v any, path string) error {
+		if ref, ok := s["$ref"].(string); ok {
+			return check(defs[strings.TrimPrefix(ref, "#/definitions/")].(map[string]any), v, path)
+		}
+		if anyOf, ok := s["anyOf"].([]any); ok {
+			for _, sub := range anyOf {
+				if check(sub.(map[string]any), v, path) == nil {
+					return nil
+				}
+			}
+			return fmt.Errorf("%s: %v matches none of anyOf", path, v)
+		}
+		if enum, ok := s["enum"].([]any); ok && !slices.Contains(enum, v) {
+			return fmt.Errorf("%s: %v not in %v", path, v, enum)
+		}
+		if pattern, ok := s["pattern"].(string); ok {
+			if str, isStr := v.(string); isStr && !regexp.MustCompile(pattern).MatchString(str) {
+				return fmt.Errorf("%s: %q does not match %s", path, str, pattern)
+			}
+		}
+		typ := fmt.Sprint(s["type"])
+		switch val := v.(type) {
+		case nil:
+			if s["type"] != nil && !strings.Contains(typ, "null") {
+				return fmt.Errorf("%s: null is not allowed", path)
+			}
+		case map[string]any:
+			if s["type"] != nil && !strings.Contains(typ, "object") {
+				return fmt.Errorf("%s: object is not allowed", path)
+			}
+			props, _ := s["properties"].(map[string]any)
+			for k, item := range val {
+				if names, ok := s["propertyNames"].(map[string]any); ok {
+					if err := check(names, k, path+"."+k); err != nil {
+						return err
+					}
+				}
+				if prop, ok := props[k].(map[string]any); ok {
+					if err := check(prop, item, path+"."+k); err != nil {
+						return err
+					}
+					continue
+				}
+				switch extra := s["additionalProperties"].(type) {
+				case bool:
+					if !extra {
+						return fmt.Errorf("%s: unknown field %s", path, k)
+					}
+				case map[string]any:
+					if err := check(extra, item, path+"."+k); err != nil {
+						return err
+					}
+				}
+			}
+		case []any:
+			if s["type"] != nil && !strings.Contains(typ, "array") {
+				return fmt.Errorf("%s: array is not allowed", path)
+			}
+			if items, ok := s["items"].(map[string]any); ok {
+				for i, item := range val {
+					if err := check(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+						return err
+					}
+				}
+			}
+		case string:
+			if s["type"] != nil && !strings.Contains(typ, "string") {
+				return fmt.Errorf("%s: string is not allowed", path)
+			}
+		case int:
+			if s["type"] != nil && !strings.Contains(typ, "integer") && !strings.Contains(typ, "number") {
+				return fmt.Errorf("%s: integer is not allowed", path)
+			}
+		case float64:
+			if s["type"] != nil && !strings.Contains(typ, "number") {
+				return fmt.Errorf("%s: number is not allowed", path)
+			}
+		case bool:
+			if s["type"] != nil && !strings.Contains(typ, "boolean") {
+				return fmt.Errorf("%s: boolean is not allowed", path)
+			}
+		}
+		return nil
+	}
+	return check(map[string]any{"$ref": schema["$ref"]}, doc, "$")
+}
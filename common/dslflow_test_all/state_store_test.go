@@ -0,0 +1,320 @@
+package dslflow_test_all
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/magic-lib/go-plat-utils/conv"
+	"github.com/magic-lib/workflow/common/dslflow"
+	_ "github.com/mattn/go-sqlite3"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var (
+	durableActionOnce sync.Once
+	chargeCounter     atomic.Int32
+	notifyCounter     atomic.Int32
+	notifyFail        atomic.Bool
+)
+
+// registerDurableActions 注册一个 update 类型的扣款和一个可以控制失败的通知
+func registerDurableActions(t testing.TB) {
+	durableActionOnce.Do(func() {
+		registerTestAction(t, func(ctx context.Context, param map[string]any) (map[string]any, error) {
+			return map[string]any{"charged": chargeCounter.Add(1)}, nil
+		}, &dslflow.ActionMetadata{
+			ActionType: dslflow.ActionTypeUpdate,
+			Namespace:  "test",
+			Activity:   "Charge",
+		})
+
+		registerTestAction(t, func(ctx context.Context, param map[string]any) (map[string]any, error) {
+			notifyCounter.Add(1)
+			if notifyFail.Load() {
+				return nil, errors.New("notify service unavailable")
+			}
+			return map[string]any{"notified": true}, nil
+		}, &dslflow.ActionMetadata{
+			Namespace: "test",
+			Activity:  "Notify",
+		})
+	})
+}
+
+const durableWorkflow = `
+root:
+  sequence:
+    - activity:
+        id: charge
+        namespace: test
+        activity: Charge
+    - activity:
+        id: notify
+        namespace: test
+        activity: Notify
+`
+
+func TestResumeAfterFailure(t *testing.T) {
+	registerDurableActions(t)
+
+	fileStore, err := dslflow.NewFileStateStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqliteStore, err := newSQLiteStateStore(t, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := map[string]dslflow.StateStore{
+		"memory": dslflow.NewMemoryStateStore(),
+		"file":   fileStore,
+		"sqlite": sqliteStore,
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			chargeCounter.Store(0)
+			notifyCounter.Store(0)
+			notifyFail.Store(true)
+
+			wf, err := dslflow.LoadWorkflowBytes([]byte(durableWorkflow))
+			if err != nil {
+				t.Fatal(err)
+			}
+			wf.Store = store
+			_, err = wf.ExecuteRun(context.Background(), "order-1", map[string]any{"order_id": "1"})
+			fmt.Println(err)
+			if err == nil {
+				t.Fatal("want notify error")
+			}
+			cp, err := store.Load(context.Background(), "order-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cp.Status != dslflow.RunStatusFailed || len(cp.Activities) != 1 {
+				t.Errorf("checkpoint = %s", conv.String(cp))
+			}
+
+			// 模拟进程重启：重新加载工作流后继续执行
+			notifyFail.Store(false)
+			wf, _ = dslflow.LoadWorkflowBytes([]byte(durableWorkflow))
+			wf.Store = store
+			ret, err := wf.Resume(context.Background(), "order-1")
+			fmt.Println(conv.String(ret), err)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if chargeCounter.Load() != 1 {
+				t.Errorf("charge executed %d times, want 1", chargeCounter.Load())
+			}
+			if ret["order_id"] != "1" || ret["notified"] != true || conv.String(ret["charged"]) != "1" {
+				t.Errorf("result = %v", ret)
+			}
+
+			// 已经完成的执行直接返回结果
+			ret, err = wf.Resume(context.Background(), "order-1")
+			if err != nil || notifyCounter.Load() != 2 || ret["notified"] != true {
+				t.Errorf("resume completed run: %v, %v, notify executed %d times", ret, err, notifyCounter.Load())
+			}
+		})
+	}
+
+	wf, _ := dslflow.LoadWorkflowBytes([]byte(durableWorkflow))
+	wf.Store = dslflow.NewMemoryStateStore()
+	if _, err = wf.Resume(context.Background(), "not-exist"); !errors.Is(err, dslflow.ErrRunNotFound) {
+		t.Errorf("want ErrRunNotFound, got %v", err)
+	}
+}
+
+var storeChildOnce sync.Once
+
+func TestFileStateStoreChildRuns(t *testing.T) {
+	registerHookActions(t)
+	storeChildOnce.Do(func() {
+		child, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  activity:
+    namespace: test
+    activity: Record
+    arguments: '{"project":"{{project}}"}'
+responses:
+  project: "{{project}}"
+`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = dslflow.RegisterWorkflow("store-child", "", child); err != nil {
+			t.Fatal(err)
+		}
+	})
+	dir := t.TempDir()
+	store, err := dslflow.NewFileStateStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, _ := dslflow.GetWorkflow("store-child", "")
+	child.Store = store
+
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  workflow:
+    name: store-child
+    inputs:
+      project: "{{project}}"
+    result_var: child
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wf.Store = store
+
+	// 两次父流程执行的子流程进度保存在不同的文件中，第二次不会读到第一次的结果
+	ctx := context.Background()
+	for _, run := range []struct{ runID, project string }{{"parent/1", "p1"}, {"parent/2", "p2"}} {
+		ret, err := wf.ExecuteRun(ctx, run.runID, map[string]any{"project": run.project})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if child, _ := ret["child"].(map[string]any); child["project"] != run.project {
+			t.Errorf("%s child result = %v", run.runID, ret["child"])
+		}
+		cp, err := store.Load(ctx, run.runID+"#root.workflow")
+		if err != nil || cp.Status != dslflow.RunStatusCompleted || cp.Arguments["project"] != run.project {
+			t.Errorf("%s child checkpoint = %s, %v", run.runID, conv.String(cp), err)
+		}
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 4 {
+		t.Errorf("want 4 checkpoint files, got %d", len(entries))
+	}
+
+	// 文件中保存的 runID 和请求的不一致时报错
+	if err = store.Save(ctx, &dslflow.Checkpoint{RunID: "other", Status: dslflow.RunStatusCompleted}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "other.json"))
+	if err = os.WriteFile(filepath.Join(dir, "copied.json"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Load(ctx, "copied"); err == nil || !strings.Contains(err.Error(), "belongs to run other") {
+		t.Errorf("want run id mismatch error, got %v", err)
+	}
+}
+
+// TestBackgroundStatus onexit: exit 返回时状态为 exited，后台流程结束后记录最终状态
+func TestBackgroundStatus(t *testing.T) {
+	registerSleepAction(t)
+
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  sequence:
+    - control:
+        onexit: exit
+      activity:
+        namespace: test
+        activity: Sleep
+        arguments: '{"name":"front","ms":1}'
+    - activity:
+        namespace: test
+        activity: Sleep
+        arguments: '{"name":"background","ms":20,"fail":{{fail}}}'
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := dslflow.NewMemoryStateStore()
+	wf.Store = store
+
+	for _, tc := range []struct {
+		fail bool
+		want dslflow.RunStatus
+	}{
+		{false, dslflow.RunStatusCompleted},
+		{true, dslflow.RunStatusFailed},
+	} {
+		runID := fmt.Sprintf("background-%t", tc.fail)
+		if _, err = wf.ExecuteRun(context.Background(), runID, map[string]any{"fail": tc.fail}); err != nil {
+			t.Fatal(err)
+		}
+		cp, err := store.Load(context.Background(), runID)
+		if err != nil || cp.Status != dslflow.RunStatusExited {
+			t.Fatalf("status after exit = %v, %v", cp, err)
+		}
+		for i := 0; i < 100 && cp.Status == dslflow.RunStatusExited; i++ {
+			time.Sleep(5 * time.Millisecond)
+			cp, _ = store.Load(context.Background(), runID)
+		}
+		fmt.Println(cp.Status, cp.Error)
+		if cp.Status != tc.want {
+			t.Errorf("fail=%t: status = %s, want %s", tc.fail, cp.Status, tc.want)
+		}
+		if tc.fail && !strings.Contains(cp.Error, "sleep failed") {
+			t.Errorf("error = %q", cp.Error)
+		}
+	}
+}
+
+// openSQLiteDB 每个测试使用单独的 sqlite 临时文件
+func openSQLiteDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "state.db")+"?_busy_timeout=5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func newSQLiteStateStore(t *testing.T, table string) (*dslflow.SQLiteStateStore, error) {
+	return dslflow.NewSQLiteStateStore(context.Background(), openSQLiteDB(t), table)
+}
+
+func TestSQLiteStateStore(t *testing.T) {
+	if _, err := newSQLiteStateStore(t, "bad-name"); err == nil {
+		t.Error("want invalid table name error")
+	}
+	ctx := context.Background()
+	db := openSQLiteDB(t)
+	if _, err := dslflow.NewSQLiteStateStore(ctx, db, ""); err != nil {
+		t.Fatal(err)
+	}
+	// 表已经存在时不报错
+	store, err := dslflow.NewSQLiteStateStore(ctx, db, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = store.Load(ctx, "sqlite-1"); !errors.Is(err, dslflow.ErrRunNotFound) {
+		t.Errorf("want ErrRunNotFound, got %v", err)
+	}
+	if err = store.Save(ctx, &dslflow.Checkpoint{RunID: "sqlite-1", Status: dslflow.RunStatusRunning, Arguments: map[string]any{"id": "1"}}); err != nil {
+		t.Fatal(err)
+	}
+	cp, err := store.Load(ctx, "sqlite-1")
+	if err != nil || cp.Status != dslflow.RunStatusRunning || cp.Arguments["id"] != "1" {
+		t.Errorf("checkpoint = %s, %v", conv.String(cp), err)
+	}
+	// 相同 runID 再次保存时覆盖
+	if err = store.Save(ctx, &dslflow.Checkpoint{RunID: "sqlite-1", Status: dslflow.RunStatusCompleted, Result: map[string]any{"ok": true}}); err != nil {
+		t.Fatal(err)
+	}
+	cp, err = store.Load(ctx, "sqlite-1")
+	if err != nil || cp.Status != dslflow.RunStatusCompleted || cp.Result["ok"] != true {
+		t.Errorf("checkpoint after update = %s, %v", conv.String(cp), err)
+	}
+	var rows int
+	if err = db.QueryRow("SELECT COUNT(*) FROM dslflow_checkpoint").Scan(&rows); err != nil || rows != 1 {
+		t.Errorf("rows = %d, %v, want 1", rows, err)
+	}
+	if err = store.Delete(ctx, "sqlite-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Load(ctx, "sqlite-1"); !errors.Is(err, dslflow.ErrRunNotFound) {
+		t.Errorf("want ErrRunNotFound after delete, got %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package dslflow_test_all
+
+import (
+	"context"
+	"fmt"
+	"github.com/magic-lib/workflow/common/dslflow"
+	"testing"
+)
+
+func TestSwitch(t *testing.T) {
+	registerHookActions(t)
+
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  switch:
+    result_var: level_case
+    cases:
+      - name: excellent
+        when: "{{score}} >= 90"
+        do:
+          activity:
+            namespace: test
+            activity: Record
+            arguments: '{"level":"A"}'
+      - when: "{{score}} >= 60"
+        do:
+          activity:
+            namespace: test
+            activity: Record
+            arguments: '{"level":"B"}'
+    default:
+      activity:
+        namespace: test
+        activity: Record
+        arguments: '{"level":"C"}'
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = wf.Validate(nil, "score"); err != nil {
+		t.Errorf("validate: %v", err)
+	}
+
+	testCases := []struct {
+		score int
+		level string
+		taken string
+	}{
+		{score: 95, level: "A", taken: "excellent"},
+		{score: 90, level: "A", taken: "excellent"},
+		{score: 70, level: "B", taken: "cases[1]"},
+		{score: 10, level: "C", taken: "default"},
+	}
+	for _, tc := range testCases {
+		ret, err := wf.Execute(context.Background(), map[string]any{"score": tc.score})
+		fmt.Println(ret, err)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ret["level"] != tc.level || ret["level_case"] != tc.taken {
+			t.Errorf("score %d: level = %v, case = %v, want %s, %s", tc.score, ret["level"], ret["level_case"], tc.level, tc.taken)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package dslflow_test_all
+
+import (
+	"context"
+	"fmt"
+	"github.com/magic-lib/go-plat-utils/conv"
+	"github.com/magic-lib/workflow/common/dslflow"
+	"testing"
+)
+
+func TestActivityTemplate(t *testing.T) {
+	registerHookActions(t)
+
+	err := dslflow.RegisterActivityTemplate("record-base", &dslflow.Activity{
+		ActivityMetadata: dslflow.ActivityMetadata{
+			Namespace:    "test",
+			Activity:     "Record",
+			ArgsFallback: map[string]any{"project": "global", "env": "prod"},
+			Arguments:    `{"project":"{{project}}","env":"{{env}}","step":"{{step}}"}`,
+		},
+		Timeout: 10,
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+templates:
+  record-step:
+    template: record-base
+    args_fallback:
+      project: cd
+root:
+  sequence:
+    - activity:
+        id: step1
+        template: record-step
+        args_force:
+          step: 1
+    - activity:
+        id: step2
+        template: record-step
+        args_force:
+          step: 2
+          env: test
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = wf.Validate(nil); err != nil {
+		t.Errorf("validate: %v", err)
+	}
+
+	hookRecords = nil
+	_, err = wf.Execute(context.Background(), map[string]any{})
+	fmt.Println(conv.String(hookRecords), err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]string{
+		{"project": "cd", "env": "prod", "step": "1"},
+		{"project": "cd", "env": "test", "step": "2"},
+	}
+	if len(hookRecords) != len(want) {
+		t.Fatalf("records = %v", hookRecords)
+	}
+	for i, record := range hookRecords {
+		for k, v := range want[i] {
+			if conv.String(record[k]) != v {
+				t.Errorf("record[%d].%s = %v, want %s", i, k, record[k], v)
+			}
+		}
+	}
+
+	wf.Root.Sequence[0].Activity.Template = "not-exist"
+	_, err = wf.Execute(context.Background(), map[string]any{})
+	fmt.Println(err)
+	if err == nil {
+		t.Error("want template not found error")
+	}
+}
+
+// TestActivityTemplateZeroOverride activity 中写成零值的字段也覆盖模版，经过多层模版时也一样
+func TestActivityTemplateZeroOverride(t *testing.T) {
+	registerFlakyAction(t)
+	registerLookupAction(t)
+	flakyCounter.Store(0)
+	lookupCounter.Store(0)
+
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+templates:
+  flaky-retry:
+    namespace: test
+    activity: Flaky
+    arguments: '{"fail_times":1}'
+    retry_policy:
+      maximum_attempts: 2
+      initial_interval: 1ms
+  cached-lookup:
+    namespace: test
+    activity: Lookup
+    arguments: '{"id":"1"}'
+    cached: true
+  uncached-lookup:
+    template: cached-lookup
+    cached: false
+root:
+  sequence:
+    - activity:
+        template: uncached-lookup
+    - activity:
+        template: uncached-lookup
+    - activity:
+        template: flaky-retry
+        retry_policy:
+          maximum_attempts: 0
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = wf.Execute(context.Background(), map[string]any{})
+	fmt.Println(err)
+	if err == nil || flakyCounter.Load() != 1 {
+		t.Errorf("maximum_attempts: 0 should not retry: %v, executed %d", err, flakyCounter.Load())
+	}
+	if lookupCounter.Load() != 2 {
+		t.Errorf("cached: false should not use cache, lookup executed %d times", lookupCounter.Load())
+	}
+}
@@ -0,0 +1,260 @@
+package dslflow_test_all
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/magic-lib/workflow/common/dslflow"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+var (
+	tracedActionOnce sync.Once
+	tracedParentSpan atomic.Value
+)
+
+// registerTracedAction 注册一个在 action 中创建子 span 的 action，记录子 span 的父节点
+func registerTracedAction(t testing.TB) {
+	tracedActionOnce.Do(func() {
+		registerTestAction(t, func(ctx context.Context, param map[string]any) (map[string]any, error) {
+			inner := dslflow.NewMemoryTracer()
+			_, span := inner.Start(ctx, "inner")
+			span.End()
+			tracedParentSpan.Store(inner.Spans()[0].ParentSpanID)
+			return map[string]any{"traced": true}, nil
+		}, &dslflow.ActionMetadata{Namespace: "test", Activity: "Traced", ActionType: dslflow.ActionTypeQuery})
+	})
+}
+
+func tracedWorkflow(t *testing.T) *dslflow.Workflow {
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+name: traced
+root:
+  sequence:
+    - activity:
+        id: flaky
+        namespace: test
+        activity: Flaky
+        arguments: '{"fail_times":1}'
+        retry_policy:
+          maximum_attempts: 2
+          initial_interval: 1ms
+    - parallel:
+        - activity:
+            id: lookup1
+            namespace: test
+            activity: Lookup
+            arguments: '{"id":"1"}'
+            cached: true
+        - activity:
+            id: traced
+            namespace: test
+            activity: Traced
+    - activity:
+        id: lookup2
+        namespace: test
+        activity: Lookup
+        arguments: '{"id":"1"}'
+        cached: true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wf
+}
+
+func TestMemoryTracer(t *testing.T) {
+	registerFlakyAction(t)
+	registerLookupAction(t)
+	registerTracedAction(t)
+	flakyCounter.Store(0)
+
+	wf := tracedWorkflow(t)
+	tracer := dslflow.NewMemoryTracer()
+	wf.Tracer = tracer
+	if _, err := wf.Execute(context.Background(), map[string]any{}); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := tracer.Spans()
+	byID := make(map[string]*dslflow.RecordedSpan)
+	for _, span := range spans {
+		byID[span.SpanID] = span
+	}
+	// ancestors 从父节点到根节点的 span 名称
+	ancestors := func(span *dslflow.RecordedSpan) []string {
+		var names []string
+		for p := byID[span.ParentSpanID]; p != nil; p = byID[p.ParentSpanID] {
+			names = append(names, p.Name)
+		}
+		return names
+	}
+	find := func(name string, attr string, value any) *dslflow.RecordedSpan {
+		for _, span := range spans {
+			if span.Name == name && span.Attributes[attr] == value {
+				return span
+			}
+		}
+		t.Fatalf("span %s with %s=%v not found", name, attr, value)
+		return nil
+	}
+
+	root := find("workflow", "workflow.name", "traced")
+	if root.ParentSpanID != "" || root.Attributes["run_id"] == "" || root.Attributes["status"] != "completed" {
+		t.Errorf("workflow span: %+v", root)
+	}
+	for _, span := range spans {
+		if span.TraceID != root.TraceID {
+			t.Errorf("span %s not in the workflow trace", span.Name)
+		}
+	}
+
+	// 重试两次：两个 attempt，第一个记录错误，activity 记录重试次数
+	flaky := find("activity", "activity.id", "flaky")
+	if flaky.Attributes["retry.count"] != 1 || flaky.Attributes["action"] != "test/Flaky" {
+		t.Errorf("flaky activity span: %v", flaky.Attributes)
+	}
+	want := []string{"activity", "statement", "sequence", "statement", "workflow"}
+	for _, attempt := range []int{1, 2} {
+		span := find("attempt", "attempt", attempt)
+		if got := ancestors(span); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("attempt %d ancestors = %v, want %v", attempt, got, want)
+		}
+		if (span.Error != "") != (attempt == 1) {
+			t.Errorf("attempt %d error = %q", attempt, span.Error)
+		}
+	}
+
+	// 并行分支中的 action，ActionExecute 收到的 context 带着 action span
+	traced := find("action", "action", "test/Traced")
+	if traced.Attributes["action.type"] != "query" {
+		t.Errorf("traced action span: %v", traced.Attributes)
+	}
+	want = []string{"attempt", "activity", "statement", "parallel", "statement", "sequence", "statement", "workflow"}
+	if got := ancestors(traced); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("traced action ancestors = %v, want %v", got, want)
+	}
+	if tracedParentSpan.Load() != traced.SpanID {
+		t.Errorf("span in ActionExecute has parent %v, want %s", tracedParentSpan.Load(), traced.SpanID)
+	}
+
+	// 同一次执行中第二次查询命中缓存，不再执行 action
+	lookup1 := find("attempt", "cache", "miss")
+	lookup2 := find("attempt", "cache", "hit")
+	if byID[lookup1.ParentSpanID].Attributes["activity.id"] != "lookup1" || byID[lookup2.ParentSpanID].Attributes["activity.id"] != "lookup2" {
+		t.Errorf("cache attempts: %v, %v", lookup1, lookup2)
+	}
+	for _, span := range spans {
+		if span.ParentSpanID == lookup2.SpanID {
+			t.Errorf("cache hit should not execute action: %+v", span)
+		}
+	}
+	find("statement", "path", "root.sequence[1].parallel[0]")
+
+	// 单次执行设置的 Tracer 优先
+	runTracer := dslflow.NewMemoryTracer()
+	tracer.Reset()
+	flakyCounter.Store(0)
+	if _, err := wf.Execute(dslflow.WithTracer(context.Background(), runTracer), map[string]any{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(tracer.Spans()) != 0 || len(runTracer.Spans()) != len(spans) {
+		t.Errorf("workflow tracer: %d spans, run tracer: %d spans, want 0 and %d", len(tracer.Spans()), len(runTracer.Spans()), len(spans))
+	}
+}
+
+func TestOTLPFileExporter(t *testing.T) {
+	registerFlakyAction(t)
+	registerLookupAction(t)
+	registerTracedAction(t)
+	flakyCounter.Store(0)
+
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	exporter, err := dslflow.NewOTLPFileExporter(path, "order-service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wf := tracedWorkflow(t)
+	wf.Tracer = exporter
+	if _, err = wf.Execute(context.Background(), map[string]any{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = exporter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	type otlpSpan struct {
+		TraceID           string `json:"traceId"`
+		SpanID            string `json:"spanId"`
+		ParentSpanID      string `json:"parentSpanId"`
+		Name              string `json:"name"`
+		StartTimeUnixNano string `json:"startTimeUnixNano"`
+		Attributes        []struct {
+			Key   string         `json:"key"`
+			Value map[string]any `json:"value"`
+		} `json:"attributes"`
+		Status struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"status"`
+	}
+	type otlpRequest struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []struct {
+					Key   string         `json:"key"`
+					Value map[string]any `json:"value"`
+				} `json:"attributes"`
+			} `json:"resource"`
+			ScopeSpans []struct {
+				Spans []otlpSpan `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var spans []otlpSpan
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		req := otlpRequest{}
+		if err = json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			t.Fatalf("invalid line %s: %v", scanner.Text(), err)
+		}
+		rs := req.ResourceSpans[0]
+		if rs.Resource.Attributes[0].Key != "service.name" || rs.Resource.Attributes[0].Value["stringValue"] != "order-service" {
+			t.Errorf("resource: %+v", rs.Resource)
+		}
+		spans = append(spans, rs.ScopeSpans[0].Spans...)
+	}
+
+	var root otlpSpan
+	failedAttempts := 0
+	for _, span := range spans {
+		if len(span.TraceID) != 32 || len(span.SpanID) != 16 || span.StartTimeUnixNano == "" {
+			t.Errorf("invalid span ids: %+v", span)
+		}
+		if span.Name == "workflow" {
+			root = span
+		}
+		if span.Name == "attempt" && span.Status.Code == 2 && span.Status.Message != "" {
+			failedAttempts++
+		}
+		for _, attr := range span.Attributes {
+			if attr.Key == "retry.count" && attr.Value["intValue"] != "1" && attr.Value["intValue"] != "0" {
+				t.Errorf("retry.count = %v", attr.Value)
+			}
+		}
+	}
+	if root.SpanID == "" || root.ParentSpanID != "" || failedAttempts != 1 {
+		t.Errorf("root %+v, failed attempts %d", root, failedAttempts)
+	}
+}
@@ -0,0 +1,156 @@
+package dslflow_test_all
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/magic-lib/workflow/common/dslflow"
+	"github.com/magic-lib/workflow/common/errorflow"
+	"go.uber.org/multierr"
+	"testing"
+)
+
+type testRegistry map[string]dslflow.ActionInterface
+
+func (r testRegistry) GetAction(ns string, activity string) (dslflow.ActionInterface, error) {
+	if ai, ok := r[ns+"/"+activity]; ok {
+		return ai, nil
+	}
+	return nil, fmt.Errorf("activity %s/%s is not registered", ns, activity)
+}
+
+func TestWorkflowValidate(t *testing.T) {
+	getOrder, err := dslflow.ChangeActionInterface[int, map[string]any](func(ctx context.Context, id int) (map[string]any, error) {
+		return map[string]any{"order_name": id}, nil
+	}, &dslflow.ActionMetadata{
+		Activity: "GetOrderName",
+		Responses: []dslflow.ReturnConfig{
+			{Name: "order_name", Type: "string"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := testRegistry{"/GetOrderName": getOrder}
+
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+variables:
+  id: 1
+root:
+  control:
+    when: "{{id}} > "
+    execution_order: [sequence, parallel, retry]
+  sequence:
+    - activity:
+        id: first
+        activity: GetOrderName
+        arguments: "{{id}}"
+        responses:
+          first_name: "{{order_name}}"
+    - activity:
+        id: first
+        namespace: order
+        activity: GetOrderName
+        arguments: "{{first_name}} {{missing.name}}"
+    - control:
+        when: "true"
+  parallel:
+    - activity:
+        activity: GetOrderName
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = wf.Validate(registry)
+	fmt.Println(err)
+
+	paths := make([]string, 0)
+	for _, one := range multierr.Errors(err) {
+		var de *errorflow.DefinitionError
+		if !errors.As(one, &de) {
+			t.Fatalf("unexpected error type %T", one)
+		}
+		paths = append(paths, de.Path)
+	}
+	want := []string{
+		"root.sequence[1].activity",
+		"root.control.execution_order[2]",
+		"root.control.when",
+		"root.sequence[1].activity",
+		"root.sequence[1].activity.arguments",
+		"root.sequence[2]",
+	}
+	if fmt.Sprint(paths) != fmt.Sprint(want) {
+		t.Errorf("paths = %v, want %v", paths, want)
+	}
+}
+
+func TestWorkflowValidateUnknownResponses(t *testing.T) {
+	raw, err := dslflow.ChangeActionInterface[map[string]any, map[string]any](func(ctx context.Context, param map[string]any) (map[string]any, error) {
+		return map[string]any{"anything": 1}, nil
+	}, &dslflow.ActionMetadata{Activity: "Raw"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	known, err := dslflow.ChangeActionInterface[map[string]any, map[string]any](func(ctx context.Context, param map[string]any) (map[string]any, error) {
+		return map[string]any{"known": 1}, nil
+	}, &dslflow.ActionMetadata{Activity: "Known", Responses: []dslflow.ReturnConfig{{Name: "known"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := testRegistry{"/Raw": raw, "/Known": known}
+
+	// 没有声明返回结构的 action 之后，返回的任何字段都可能被引用，不再报错
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  sequence:
+    - activity:
+        activity: Raw
+        responses:
+          first_name: "{{anything}}"
+    - activity:
+        activity: Known
+        arguments: "{{anything}} {{first_name}}"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = wf.Validate(registry); err != nil {
+		t.Errorf("validate: %v", err)
+	}
+
+	// 按名称的依赖只合并依赖的 id、action 和 responses，上游都声明了返回结构时未知变量仍然报错
+	wf, err = dslflow.LoadWorkflowBytes([]byte(`
+root:
+  sequence:
+    - activity:
+        activity: Known
+        depends_on: [second]
+        arguments: "{{second.known}} {{second_name}} {{known}} {{other}}"
+    - activity:
+        id: second
+        activity: Known
+        responses:
+          second_name: "{{known}}"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wf.Validate(registry)
+	msgs := make([]string, 0)
+	for _, one := range multierr.Errors(err) {
+		var de *errorflow.DefinitionError
+		if !errors.As(one, &de) {
+			t.Fatalf("unexpected error type %T", one)
+		}
+		msgs = append(msgs, de.Error())
+	}
+	want := []string{
+		"root.sequence[0].activity.arguments: template reference {{known}} is not produced by any upstream step",
+		"root.sequence[0].activity.arguments: template reference {{other}} is not produced by any upstream step",
+	}
+	if fmt.Sprint(msgs) != fmt.Sprint(want) {
+		t.Errorf("errors = %v, want %v", msgs, want)
+	}
+}
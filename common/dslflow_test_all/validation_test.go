@@ -0,0 +1,185 @@
+package dslflow_test_all
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/magic-lib/workflow/common/dslflow"
+	"github.com/magic-lib/workflow/common/errorflow"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+type validatedRequest struct {
+	Id   int    `json:"id" validate:"required"`
+	Mode string `json:"mode"`
+}
+
+var (
+	validatedActionOnce sync.Once
+	validatedCounter    atomic.Int32
+)
+
+// registerValidatedAction 注册声明了参数和返回结构的 action，mode 控制返回的数据
+func registerValidatedAction(t testing.TB) {
+	validatedActionOnce.Do(func() {
+		registerTestAction(t, func(ctx context.Context, req validatedRequest) (map[string]any, error) {
+			validatedCounter.Add(1)
+			switch req.Mode {
+			case "bad":
+				return map[string]any{"name": 1}, nil
+			case "coerce":
+				return map[string]any{"name": "coerced", "count": "3"}, nil
+			}
+			return map[string]any{"name": "ok", "count": 1}, nil
+		}, &dslflow.ActionMetadata{
+			Namespace:            "test",
+			Activity:             "Validated",
+			RequiredArgumentKeys: []string{"id"},
+			Responses: []dslflow.ReturnConfig{
+				{Name: "name", Type: "string", Required: true},
+				{Name: "count", Type: "int", Coerce: true},
+			},
+		})
+	})
+}
+
+func validatedWorkflow(t *testing.T, validation string, arguments string) *dslflow.Workflow {
+	wf, err := dslflow.LoadWorkflowBytes([]byte(fmt.Sprintf(`
+root:
+  activity:
+    namespace: test
+    activity: Validated
+    arguments: '%s'
+    validation: %s
+    retry_policy:
+      maximum_attempts: 2
+      initial_interval: 1ms
+    responses:
+      total: "{{count}}"
+`, arguments, validation)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wf
+}
+
+func TestActivityValidation(t *testing.T) {
+	registerValidatedAction(t)
+	ctx := context.Background()
+
+	// strict：参数不满足时不执行 action，也不重试
+	validatedCounter.Store(0)
+	_, err := validatedWorkflow(t, "strict", `{"mode":"ok"}`).Execute(ctx, map[string]any{})
+	var verr *errorflow.ValidationError
+	if !errorflow.IsValidationError(err) || !errors.As(err, &verr) || verr.Action != "test/Validated" || verr.Stage != "arguments" {
+		t.Fatalf("strict arguments: %v", err)
+	}
+	if !strings.Contains(err.Error(), "$.id: required field is missing") || validatedCounter.Load() != 0 {
+		t.Errorf("strict arguments: %v, executed %d", err, validatedCounter.Load())
+	}
+
+	// strict：返回不满足时失败，不重试
+	validatedCounter.Store(0)
+	_, err = validatedWorkflow(t, "strict", `{"id":1,"mode":"bad"}`).Execute(ctx, map[string]any{})
+	if !errors.As(err, &verr) || verr.Stage != "response" || !strings.Contains(err.Error(), "name: expected string, got integer") {
+		t.Errorf("strict response: %v", err)
+	}
+	if validatedCounter.Load() != 1 {
+		t.Errorf("validation error should not be retried, executed %d", validatedCounter.Load())
+	}
+
+	// strict：满足声明时正常执行，coerce 的字段转换后给后续模版使用
+	result, err := validatedWorkflow(t, "strict", `{"id":1,"mode":"coerce"}`).Execute(ctx, map[string]any{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(result["total"]) != "3" || fmt.Sprint(result["name"]) != "coerced" {
+		t.Errorf("coerced result: %v", result)
+	}
+
+	// warn：打印日志后继续执行
+	buf := &bytes.Buffer{}
+	logCtx := dslflow.WithLogger(ctx, dslflow.NewSlogLogger(slog.New(slog.NewJSONHandler(buf, nil))))
+	validatedCounter.Store(0)
+	if _, err = validatedWorkflow(t, "warn", `{"mode":"bad"}`).Execute(logCtx, map[string]any{}); err != nil {
+		t.Fatalf("warn mode: %v", err)
+	}
+	if validatedCounter.Load() != 1 || strings.Count(buf.String(), `"msg":"action validation failed"`) != 2 ||
+		!strings.Contains(buf.String(), `"stage":"arguments"`) || !strings.Contains(buf.String(), `"stage":"response"`) {
+		t.Errorf("warn mode log: %s", buf.String())
+	}
+
+	// off 和默认：不校验，也不转换返回
+	for _, validation := range []string{"off", `""`} {
+		buf.Reset()
+		result, err = validatedWorkflow(t, validation, `{"id":1,"mode":"coerce"}`).Execute(logCtx, map[string]any{})
+		if err != nil {
+			t.Fatalf("%s mode: %v", validation, err)
+		}
+		if _, err = validatedWorkflow(t, validation, `{"mode":"bad"}`).Execute(logCtx, map[string]any{}); err != nil {
+			t.Fatalf("%s mode: %v", validation, err)
+		}
+		if _, uncoerced := result["count"].(string); strings.Contains(buf.String(), "action validation failed") || !uncoerced {
+			t.Errorf("%s mode should not validate: %v, %s", validation, result, buf.String())
+		}
+	}
+
+	// 静态校验检查 validation 的取值
+	if err = validatedWorkflow(t, "loose", `{"id":1}`).Validate(nil); !errorflow.IsDefinitionError(err) || !strings.Contains(err.Error(), `invalid validation "loose"`) {
+		t.Errorf("validate: %v", err)
+	}
+}
+
+// TestActivityValidationCached 命中缓存时也校验返回，并且和没有命中缓存时的结果一致
+func TestActivityValidationCached(t *testing.T) {
+	registerValidatedAction(t)
+
+	wf, err := dslflow.LoadWorkflowBytes([]byte(`
+root:
+  sequence:
+    - activity:
+        id: first
+        namespace: test
+        activity: Validated
+        arguments: '{"id":1,"mode":"ok"}'
+        validation: strict
+        cached: true
+    - activity:
+        id: second
+        namespace: test
+        activity: Validated
+        arguments: '{"id":1,"mode":"ok"}'
+        validation: strict
+        cached: true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := validatedCounter.Load()
+	_, report, err := wf.ExecuteWithReport(context.Background(), "", map[string]any{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := validatedCounter.Load() - before; got != 1 {
+		t.Errorf("action executed %d times, want 1", got)
+	}
+	responses := make(map[string]any)
+	for _, entry := range report.Entries {
+		if entry.Kind == dslflow.ReportKindActivity {
+			responses[entry.ActivityId] = entry.Response
+		}
+	}
+	fmt.Printf("%#v\n", responses)
+	if !reflect.DeepEqual(responses["first"], responses["second"]) {
+		t.Errorf("cached response %#v differs from %#v", responses["second"], responses["first"])
+	}
+	if second, _ := responses["second"].(map[string]any); second["count"] != float64(1) {
+		t.Errorf("cached response = %#v", responses["second"])
+	}
+}
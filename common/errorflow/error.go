@@ -2,6 +2,7 @@ package errorflow
 
 import "fmt"
 import "errors"
+import "strings"
 
 // TimeoutError 表示超时错误
 type TimeoutError struct {
@@ -35,3 +36,209 @@ func IsBusinessError(err error) bool {
 	var be *BusinessError
 	return errors.As(err, &be)
 }
+
+// ParseError 表示工作流定义解析错误，带有文件和行列位置
+type ParseError struct {
+	File   string // 文件名，内存中的内容为空
+	Line   int    // 行号，从1开始，0表示未知
+	Column int    // 列号，从1开始，0表示未知
+	Msg    string // 错误描述
+}
+
+// Error 实现error接口
+func (e *ParseError) Error() string {
+	pos := e.File
+	if pos == "" {
+		pos = "<bytes>"
+	}
+	if e.Line > 0 {
+		pos = fmt.Sprintf("%s:%d", pos, e.Line)
+		if e.Column > 0 {
+			pos = fmt.Sprintf("%s:%d", pos, e.Column)
+		}
+	}
+	return fmt.Sprintf("%s: %s", pos, e.Msg)
+}
+
+// IsParseError 辅助函数：判断错误是否为工作流定义解析错误
+func IsParseError(err error) bool {
+	var pe *ParseError
+	return errors.As(err, &pe)
+}
+
+// DefinitionError 表示工作流定义静态校验发现的问题，Path 为出错节点的路径
+type DefinitionError struct {
+	Path string // 节点路径，比如 root.sequence[3].activity
+	Msg  string // 错误描述
+}
+
+// Error 实现error接口
+func (e *DefinitionError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Msg)
+}
+
+// IsDefinitionError 辅助函数：判断错误是否为工作流定义错误
+func IsDefinitionError(err error) bool {
+	var de *DefinitionError
+	return errors.As(err, &de)
+}
+
+// CompensationFailure 单个补偿动作执行失败
+type CompensationFailure struct {
+	Activity string // 被补偿的 activity，优先使用 id
+	Err      error  // 补偿动作返回的错误
+}
+
+// CompensationError 表示工作流失败后，部分补偿动作执行失败
+type CompensationError struct {
+	Failures []*CompensationFailure
+}
+
+// Error 实现error接口
+func (e *CompensationError) Error() string {
+	msgList := make([]string, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		msgList = append(msgList, fmt.Sprintf("%s: %v", f.Activity, f.Err))
+	}
+	return fmt.Sprintf("补偿执行失败: %s", strings.Join(msgList, "; "))
+}
+
+// Unwrap 返回所有补偿动作的错误
+func (e *CompensationError) Unwrap() []error {
+	errList := make([]error, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		errList = append(errList, f.Err)
+	}
+	return errList
+}
+
+// IsCompensationError 辅助函数：判断错误是否为补偿执行错误
+func IsCompensationError(err error) bool {
+	var ce *CompensationError
+	return errors.As(err, &ce)
+}
+
+// MaxIterationsError 表示循环达到最大次数后条件仍然满足
+type MaxIterationsError struct {
+	MaxIterations int    // 最大循环次数
+	Condition     string // 仍然满足的条件
+}
+
+// Error 实现error接口
+func (e *MaxIterationsError) Error() string {
+	return fmt.Sprintf("循环超过最大次数 %d: %s", e.MaxIterations, e.Condition)
+}
+
+// IsMaxIterationsError 辅助函数：判断错误是否为循环超过最大次数
+func IsMaxIterationsError(err error) bool {
+	var me *MaxIterationsError
+	return errors.As(err, &me)
+}
+
+// ChildWorkflowError 表示子流程执行失败
+type ChildWorkflowError struct {
+	Workflow string // 子流程名称和版本，比如 delete-cd@v1
+	RunID    string // 子流程的 runID
+	Path     string // 子流程中出错的节点路径
+	Err      error  // 子流程返回的错误
+}
+
+// Error 实现error接口
+func (e *ChildWorkflowError) Error() string {
+	return fmt.Sprintf("子流程 %s 执行失败 (run: %s, path: %s): %v", e.Workflow, e.RunID, e.Path, e.Err)
+}
+
+// Unwrap 返回子流程的错误
+func (e *ChildWorkflowError) Unwrap() error {
+	return e.Err
+}
+
+// IsChildWorkflowError 辅助函数：判断错误是否为子流程执行错误
+func IsChildWorkflowError(err error) bool {
+	var ce *ChildWorkflowError
+	return errors.As(err, &ce)
+}
+
+// MergeConflictError 表示并行节点的多个分支写入了同一个变量
+type MergeConflictError struct {
+	Key      string   // 冲突的变量名
+	Branches []string // 写入该变量的分支，优先使用 activity id，否则为分支下标
+}
+
+// Error 实现error接口
+func (e *MergeConflictError) Error() string {
+	return fmt.Sprintf("并行分支结果冲突: %s 被分支 %s 同时写入", e.Key, strings.Join(e.Branches, ", "))
+}
+
+// IsMergeConflictError 辅助函数：判断错误是否为并行分支结果冲突
+func IsMergeConflictError(err error) bool {
+	var me *MergeConflictError
+	return errors.As(err, &me)
+}
+
+// RetryAttempt 一次执行的记录
+type RetryAttempt struct {
+	Attempt int   // 第几次执行，从1开始
+	Err     error // 执行返回的错误，成功时为 nil
+}
+
+// RetryError 表示 activity 重试后仍然失败
+type RetryError struct {
+	Attempts []*RetryAttempt // 每次执行的记录
+	Cause    error           // 提前停止重试的原因，比如 context 取消、超过重试期限
+}
+
+// Error 实现error接口
+func (e *RetryError) Error() string {
+	var lastErr error
+	if len(e.Attempts) > 0 {
+		lastErr = e.Attempts[len(e.Attempts)-1].Err
+	}
+	if e.Cause != nil {
+		return fmt.Sprintf("执行 %d 次后停止重试 (%v): %v", len(e.Attempts), e.Cause, lastErr)
+	}
+	return fmt.Sprintf("执行 %d 次后失败: %v", len(e.Attempts), lastErr)
+}
+
+// Unwrap 返回每次执行的错误和停止重试的原因
+func (e *RetryError) Unwrap() []error {
+	errList := make([]error, 0, len(e.Attempts)+1)
+	for _, a := range e.Attempts {
+		if a.Err != nil {
+			errList = append(errList, a.Err)
+		}
+	}
+	if e.Cause != nil {
+		errList = append(errList, e.Cause)
+	}
+	return errList
+}
+
+// IsRetryError 辅助函数：判断错误是否为重试后失败
+func IsRetryError(err error) bool {
+	var re *RetryError
+	return errors.As(err, &re)
+}
+
+// ValidationError 表示 action 的输入参数或返回数据不符合 ActionMetadata 的声明
+type ValidationError struct {
+	Action string // namespace/activity
+	Stage  string // arguments 或 response
+	Err    error  // 不满足的字段
+}
+
+// Error 实现error接口
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("action %s %s 校验失败: %v", e.Action, e.Stage, e.Err)
+}
+
+// Unwrap 返回具体的校验错误
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// IsValidationError 辅助函数：判断错误是否为 action 输入输出校验错误
+func IsValidationError(err error) bool {
+	var ve *ValidationError
+	return errors.As(err, &ve)
+}
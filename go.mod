@@ -5,12 +5,14 @@ go 1.24.3
 require (
 	github.com/magic-lib/go-plat-cache v1.20250722.2
 	github.com/magic-lib/go-plat-utils v1.20250721.3-0.20250901061551-ef7dd02c2ad6
+	github.com/mattn/go-sqlite3 v1.14.33
 	github.com/orcaman/concurrent-map v1.0.0
 	github.com/orcaman/concurrent-map/v2 v2.0.1
 	github.com/samber/lo v1.51.0
 	github.com/tidwall/gjson v1.18.0
 	github.com/tidwall/sjson v1.2.5
 	go.uber.org/multierr v1.11.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -84,5 +86,4 @@ require (
 	golang.org/x/text v0.23.0 // indirect
 	google.golang.org/protobuf v1.36.5 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )